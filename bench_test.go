@@ -0,0 +1,61 @@
+package parrot
+
+import (
+	"testing"
+)
+
+// benchEval times src on every backend, in an interpreter that has
+// evaluated setup.
+func benchEval(b *testing.B, setup, src string) {
+	for name, opts := range backends {
+		b.Run(name, func(b *testing.B) {
+			it := New(opts...)
+			if _, e := it.EvalString(setup); e != nil {
+				b.Fatal(e)
+			}
+			form, e := Read(src)
+			if e != nil {
+				b.Fatal(e)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, e := it.Eval(form); e != nil {
+					b.Fatal(e)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkFib(b *testing.B) {
+	benchEval(b, `(def fib (fn [n] (if (< n 2) n (+ (fib (- n 1)) (fib (- n 2))))))`, `(fib 20)`)
+}
+
+// BenchmarkTailCalls runs sum2 of test1.pr, which calls itself through a
+// global in tail position.
+func BenchmarkTailCalls(b *testing.B) {
+	benchEval(b, `(def sum2 (fn (n acc) (if (= n 0) acc (sum2 (- n 1) (+ n acc)))))`, `(sum2 100000 0)`)
+}
+
+func BenchmarkLoop(b *testing.B) {
+	benchEval(b, ``, `(loop [i 0 acc 0] (if (= i 100000) acc (recur (+ i 1) (+ acc i))))`)
+}
+
+func BenchmarkClosures(b *testing.B) {
+	benchEval(b, `(def adder (fn [n] (fn [x] (+ x n))))
+		(def run-adders (fn [i acc] (if (= i 0) acc (run-adders (- i 1) (let [f (adder i)] (f acc))))))`,
+		`(run-adders 30000 0)`)
+}
+
+func BenchmarkDestructuring(b *testing.B) {
+	benchEval(b, `(def point-sum (fn [ps]
+		  (loop [ps ps acc 0]
+		    (if (empty? ps) acc
+		      (let [[x y] (first ps)] (recur (rest ps) (+ acc x y)))))))
+		(def points (loop [i 0 ps []] (if (= i 1000) ps (recur (+ i 1) (conj ps [i i])))))`,
+		`(point-sum points)`)
+}
+
+func BenchmarkGlobalLookup(b *testing.B) {
+	benchEval(b, `(def one 1)`, `(loop [i 0 acc 0] (if (= i 10000) acc (recur (+ i one) (+ acc one))))`)
+}
@@ -0,0 +1,143 @@
+package parrot
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+import (
+	. "github.com/sllt/parrot/env"
+	"github.com/sllt/parrot/reader"
+	. "github.com/sllt/parrot/types"
+	"github.com/sllt/parrot/vm"
+)
+
+// vmHost hands the forms the bytecode compiler does not handle itself, such
+// as ns, to Eval.
+var vmHost = &vm.Host{quasiquote, Eval}
+
+// BytecodeExt is the extension of files of compiled code. LoadFile runs
+// them instead of reading them as source.
+const BytecodeExt = ".prc"
+
+// EvalBytecode is like Eval, but compiles ast to bytecode and runs it on
+// the virtual machine of package vm.
+func EvalBytecode(ast ParrotType, env EnvType) (ParrotType, error) {
+	var res ParrotType
+	for _, form := range topLevel(ast) {
+		l, e := vm.Compile(form, env, vmHost)
+		if e == nil {
+			res, e = vm.Run(l, env, vmHost)
+		}
+		if e != nil {
+			return nil, e
+		}
+	}
+	return res, nil
+}
+
+// Disassemble lists the bytecode of fn. Fns that were not compiled to
+// bytecode are compiled from their source first.
+func Disassemble(fn ParrotFunc) (string, error) {
+	if cl, ok := fn.Compiled.(*vm.Closure); ok {
+		l := *cl.Lambda
+		l.Name = fn.Name
+		return vm.Disassemble(&l), nil
+	}
+	arities := fn.Arities
+	if arities == nil {
+		arities = []Arity{{fn.Params, fn.Exp}}
+	}
+	l, e := vm.CompileFn(fn.Name, arities, fn.Env, vmHost)
+	if e != nil {
+		return "", e
+	}
+	return vm.Disassemble(l), nil
+}
+
+// CompileReader compiles the top-level forms read from in to bytecode and
+// writes them to out. Each form is also run in the current namespace of reg
+// once compiled, because the macros and namespaces it defines shape the
+// forms after it. The current namespace is restored afterwards.
+func CompileReader(in io.Reader, file string, out io.Writer, reg *Registry) error {
+	return compileReader(in, file, out, reg, reg.Budget)
+}
+
+// compileReader is CompileReader running the forms under budget.
+func compileReader(in io.Reader, file string, out io.Writer, reg *Registry, budget *Budget) error {
+	cur := reg.Current
+	defer func() { reg.Current = cur }()
+	rdr := reader.NewReader(in, file)
+	ls := []*vm.Lambda{}
+	for {
+		form, e := rdr.Read()
+		if e == io.EOF {
+			return vm.Write(out, ls)
+		}
+		if e != nil {
+			return e
+		}
+		for _, f := range topLevel(form) {
+			env := reg.Current.Env.WithBudget(budget)
+			l, e := vm.Compile(f, env, vmHost)
+			if e == nil {
+				_, e = vm.Run(l, env, vmHost)
+			}
+			if e != nil {
+				if pos, ok := GetPosition(f); ok {
+					return fmt.Errorf("%s: in %s: %w", pos, describeForm(f), e)
+				}
+				return fmt.Errorf("in %s: %w", describeForm(f), e)
+			}
+			ls = append(ls, l)
+		}
+	}
+}
+
+// CompileFile compiles the named source file to the bytecode file out.
+func CompileFile(file, out string, reg *Registry) error {
+	return compileFile(file, out, reg, reg.Budget)
+}
+
+// compileFile is CompileFile running the forms under budget.
+func compileFile(file, out string, reg *Registry, budget *Budget) error {
+	in, e := os.Open(file)
+	if e != nil {
+		return e
+	}
+	defer in.Close()
+	f, e := os.Create(out)
+	if e != nil {
+		return e
+	}
+	if e := compileReader(in, file, f, reg, budget); e != nil {
+		f.Close()
+		os.Remove(out)
+		return e
+	}
+	return f.Close()
+}
+
+// loadBytecode runs the top-level forms compiled into the named file in the
+// current namespace of reg, under budget.
+func loadBytecode(file string, reg *Registry, budget *Budget) (ParrotType, error) {
+	cur := reg.Current
+	defer func() { reg.Current = cur }()
+	ls, e := vm.ReadFile(file)
+	if e != nil {
+		return nil, e
+	}
+	var res ParrotType
+	for _, l := range ls {
+		if res, e = vm.Run(l, reg.Current.Env.WithBudget(budget), vmHost); e != nil {
+			return nil, e
+		}
+	}
+	return res, nil
+}
+
+func isBytecode(file string) bool {
+	return filepath.Ext(file) == BytecodeExt
+}
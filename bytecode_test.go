@@ -0,0 +1,117 @@
+package parrot
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sllt/parrot/printer"
+)
+
+func TestCancelledBeforeFirstStep(t *testing.T) {
+	for _, it := range []*Interpreter{New(), New(WithBytecode())} {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, e := it.EvalStringContext(ctx, `((fn [] (+ 1 2)))`); !errors.Is(e, context.Canceled) {
+			t.Errorf("got %v, want context.Canceled", e)
+		}
+	}
+}
+
+const compiledSrc = `(defmacro unless (fn [c & body] ` + "`" + `(if ~c nil (do ~@body))))
+(ns shapes)
+(defn area [{:keys [w h] :or {h 1}}] (* w h))
+(defn counter [] (let [n (atom 0)] (fn [] (swap! n + 1))))
+(def tick (counter))
+(tick)
+(ns user)
+(defn safe-div [a b] (try (/ a b) (catch e :failed)))
+[(unless false (shapes/area {:w 3 :h 4})) (shapes/area {:w 5}) (shapes/tick) (safe-div 1 0)]
+`
+
+func TestCompileFileRoundTrip(t *testing.T) {
+	src := writeFile(t, "shapes.pr", compiledSrc)
+	out := filepath.Join(t.TempDir(), "shapes"+BytecodeExt)
+	if e := New().CompileFile(src, out); e != nil {
+		t.Fatal(e)
+	}
+	for name, opts := range backends {
+		it := New(opts...)
+		res, e := it.LoadFile(out)
+		if e != nil {
+			t.Fatalf("%s: %v", name, e)
+		}
+		if got := printer.PrintStr(res, true); got != "[12 5 2 :failed]" {
+			t.Errorf("%s: got %s", name, got)
+		}
+		if got, e := it.EvalString(`[(unless false :ok) (shapes/tick)]`); e != nil || printer.PrintStr(got, true) != "[:ok 3]" {
+			t.Errorf("%s: got %v, %v after loading", name, got, e)
+		}
+	}
+}
+
+func TestCompileFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "bad"+BytecodeExt)
+	src := writeFile(t, "bad.pr", "(def a 1)\n(undefined-fn a)\n")
+	e := New().CompileFile(src, out)
+	if e == nil || !strings.Contains(e.Error(), "bad.pr:2:1") {
+		t.Errorf("got %v, want an error at bad.pr:2:1", e)
+	}
+	if _, e := os.Stat(out); !os.IsNotExist(e) {
+		t.Errorf("%s was left behind", out)
+	}
+}
+
+func TestLoadDamagedBytecode(t *testing.T) {
+	src := writeFile(t, "ok.pr", compiledSrc)
+	dir := t.TempDir()
+	good := filepath.Join(dir, "ok"+BytecodeExt)
+	if e := New().CompileFile(src, good); e != nil {
+		t.Fatal(e)
+	}
+	data, e := os.ReadFile(good)
+	if e != nil {
+		t.Fatal(e)
+	}
+	files := map[string][]byte{
+		"source":    []byte("(+ 1 2)"),
+		"truncated": data[:len(data)/2],
+		"empty":     nil,
+	}
+	for name, b := range files {
+		path := filepath.Join(dir, name+BytecodeExt)
+		if e := os.WriteFile(path, b, 0o644); e != nil {
+			t.Fatal(e)
+		}
+		if _, e := New().LoadFile(path); e == nil || !strings.Contains(e.Error(), "compiled Parrot code") {
+			t.Errorf("%s: got %v", name, e)
+		}
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	for name, opts := range backends {
+		it := New(opts...)
+		res, e := it.EvalString(`(defn sq [x] (* x x)) (disassemble sq)`)
+		if e != nil {
+			t.Fatalf("%s: %v", name, e)
+		}
+		want := []string{"sq [x] locals: 1", "GET_GLOBAL", "GET_LOCAL", "TAIL_CALL", "RETURN"}
+		for _, w := range want {
+			if !strings.Contains(res.(string), w) {
+				t.Errorf("%s: %q is missing from\n%s", name, w, res)
+			}
+		}
+		res, e = it.EvalString(`(disassemble (fn [] (fn [y] y)))`)
+		if e != nil || !strings.Contains(res.(string), "CLOSURE") || !strings.Contains(res.(string), "fn [y]") {
+			t.Errorf("%s: got %v, %v for a nested fn", name, res, e)
+		}
+	}
+	expectErrorBoth(t, map[string]string{
+		`(disassemble 1)`: "disassemble requires a fn",
+	})
+}
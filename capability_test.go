@@ -0,0 +1,71 @@
+package parrot
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sllt/parrot/core"
+	. "github.com/sllt/parrot/types"
+)
+
+func TestCapabilitiesDenied(t *testing.T) {
+	for _, src := range []string{
+		`(slurp "/etc/hostname")`,
+		`(exit)`,
+		`(system "true")`,
+		`(load-file "x.pr")`,
+		`(readline "> ")`,
+	} {
+		e := runError(t, src, WithCapabilities(core.NoCapabilities))
+		var pe *core.PermissionError
+		if !errors.As(e, &pe) {
+			t.Errorf("%s: got %v, want a PermissionError", src, e)
+		}
+	}
+}
+
+func TestRequireNeedsFSRead(t *testing.T) {
+	dir := t.TempDir()
+	src := "(ns evil) (def ran true)"
+	if e := os.WriteFile(filepath.Join(dir, "evil.pr"), []byte(src), 0644); e != nil {
+		t.Fatal(e)
+	}
+	for _, form := range []string{`(require 'evil)`, `(ns user2 (:require evil))`} {
+		it := New(WithSearchPath(dir), WithCapabilities(core.NoCapabilities))
+		_, e := it.EvalString(form)
+		var pe *core.PermissionError
+		if !errors.As(e, &pe) || pe.Capability != core.FSRead {
+			t.Errorf("%s: got %v, want a PermissionError for fs-read", form, e)
+		}
+		if it.Namespaces.Find("evil") != nil {
+			t.Errorf("%s: evil was loaded", form)
+		}
+	}
+
+	// namespaces that are not loaded from a file need no capability
+	expect(t, map[string]string{
+		`(require '[parrot.string :as s]) (s/upper-case "a")`: `"A"`,
+	}, WithCapabilities(core.NoCapabilities))
+
+	got, _ := evalSrc(t, `(require 'evil) evil/ran`, WithSearchPath(dir), WithCapabilities(core.FSRead))
+	if got != "true" {
+		t.Errorf("evil/ran = %s with fs-read, want true", got)
+	}
+}
+
+// TestExit checks that exit hands its status to the host instead of ending
+// the program, and that try does not catch it.
+func TestExit(t *testing.T) {
+	for name, opts := range backends {
+		t.Run(name, func(t *testing.T) {
+			var ee *ExitError
+			for _, src := range []string{`(do (exit 2) :after)`, `(try (exit 2) (catch e :caught))`} {
+				if e := runError(t, src, opts...); !errors.As(e, &ee) || ee.Code != 2 {
+					t.Errorf("%s: got %v, want an ExitError with status 2", src, e)
+				}
+			}
+		})
+	}
+}
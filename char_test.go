@@ -0,0 +1,30 @@
+package parrot
+
+import (
+	"testing"
+)
+
+func TestChars(t *testing.T) {
+	expectBoth(t, map[string]string{
+		`(seq "hé")`:                                    `(\h \é)`,
+		`(first "é")`:                                   `\é`,
+		`(count "héllo")`:                               "5",
+		`(str \a \b "c" \newline)`:                      `"abc\n"`,
+		`(apply str (reverse "abc"))`:                   `"cba"`,
+		`(nth "abc" 1)`:                                 `\b`,
+		`(= (seq "ab") [\a \b])`:                        "true",
+		`[(= \a \a) (= \a "a") (< \a \b) (> \b \a)]`:    "[true false true true]",
+		`[(char 955) (int \λ) (int \newline)]`:          `[\λ 955 10]`,
+		`[(char? \a) (char? "a") (string? \a)]`:         "[true false false]",
+		`[\space \tab \return \backspace \formfeed \A]`: `[\space \tab \return \backspace \formfeed \A]`,
+		`(pr-str \tab "a\tb")`:                          `"\\tab \"a\\tb\""`,
+		`"\x41é"`:                                       `"Aé"`,
+		`(read-string (pr-str "\u0001\n"))`:             `"\u0001\n"`,
+		`(get {\a 1} \a)`:                               "1",
+		`(contains? #{\x} (first "x"))`:                 "true",
+	})
+	expectErrorBoth(t, map[string]string{
+		`"\q"`:  "unsupported escape \\q",
+		`\nope`: "unsupported char \\nope",
+	})
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -12,34 +16,87 @@ import (
 	. "github.com/sllt/parrot/types"
 )
 
+func printError(e error) {
+	var ee *ExitError
+	if errors.As(e, &ee) {
+		fmt.Println("Bye !")
+		os.Exit(ee.Code)
+	}
+	fmt.Printf("Error: %v\n", e)
+	var te *EvalError
+	if errors.As(e, &te) {
+		if trace := te.StackTrace(); trace != "" {
+			fmt.Println(trace)
+		}
+	}
+}
+
 func main() {
-	if len(os.Args) > 1 {
-		args := make([]ParrotType, 0, len(os.Args)-2)
-		for _, a := range os.Args[2:] {
+	path := flag.String("path", "",
+		"directories to search for required namespaces, separated by '"+string(filepath.ListSeparator)+"'")
+	maxSteps := flag.Int64("max-steps", 0, "stop each evaluation after this many steps (0 for no limit)")
+	maxDepth := flag.Int64("max-depth", 0, "stop evaluation nested deeper than this (0 for no limit)")
+	maxMemory := flag.Int64("max-memory", 0, "stop evaluation once the heap holds this many bytes (0 for no limit)")
+	timeout := flag.Duration("timeout", 0, "stop a script that runs longer than this (0 for no limit)")
+	bytecode := flag.Bool("bytecode", false, "run code on the bytecode virtual machine")
+	compile := flag.String("c", "", "compile the script to bytecode in this file, running it once")
+	pprint := flag.Bool("pprint", false, "pretty print the values the REPL prints")
+	width := flag.Int("width", 80, "the width -pprint fits values in")
+	printLength := flag.Int("print-length", 100,
+		"how many items of each lazy sequence the REPL prints (0 for all)")
+	flag.Parse()
+	opts := []Option{WithLimits(Limits{*maxSteps, *maxDepth, *maxMemory}), WithPrintLength(*printLength)}
+	if *bytecode {
+		opts = append(opts, WithBytecode())
+	}
+	if *pprint {
+		opts = append(opts, WithPrettyPrint(*width))
+	}
+	if *path != "" {
+		opts = append(opts, WithSearchPath(append(filepath.SplitList(*path), DefaultSearchPath()...)...))
+	}
+	if *timeout > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+		opts = append(opts, WithContext(ctx))
+	}
+	it := New(opts...)
+
+	if flag.NArg() > 0 {
+		args := make([]ParrotType, 0, flag.NArg()-1)
+		for _, a := range flag.Args()[1:] {
 			args = append(args, a)
 		}
-		Repl_env.Set(Symbol{"*ARGV*"}, List{args, nil})
-		if _, e := Rep("(load-file \"" + os.Args[1] + "\")"); e != nil {
-			fmt.Printf("Error: %v\n", e)
+		it.Namespaces.Core.Env.Set(Symbol{"*ARGV*"}, List{args, nil})
+		script := flag.Arg(0)
+		it.Modules.AddPath(filepath.Dir(script))
+		var e error
+		if *compile != "" {
+			e = it.CompileFile(script, *compile)
+		} else {
+			_, e = it.LoadFile(script)
+		}
+		if e != nil {
+			printError(e)
 			os.Exit(1)
 		}
 		os.Exit(0)
 	}
 
-	Rep("(println \"Parrot 0.06-alpha [Go 1.9.4] \")")
+	it.Rep("(println \"Parrot 0.06-alpha [Go 1.9.4] \")")
 	for {
-		text, err := readline.Readline("user> ")
+		text, err := readline.Readline(it.Namespaces.Current.Name + "> ")
 		text = strings.TrimRight(text, "\n")
 		if err != nil {
 			return
 		}
 		var out ParrotType
 		var e error
-		if out, e = Rep(text); e != nil {
+		if out, e = it.Rep(text); e != nil {
 			if e.Error() == "<empty line>" {
 				continue
 			}
-			fmt.Printf("Error: %v\n", e)
+			printError(e)
 			continue
 		}
 		fmt.Printf("%v\n", out)
@@ -0,0 +1,731 @@
+package parrot
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+import (
+	. "github.com/sllt/parrot/env"
+	"github.com/sllt/parrot/interop"
+	"github.com/sllt/parrot/printer"
+	. "github.com/sllt/parrot/types"
+)
+
+// Forms are compiled before they run: macros are expanded once, locals are
+// resolved to slots of the frame of the fn that binds them and every form
+// becomes a Go closure that computes its value.
+
+// code is a compiled form.
+type code func(fr *frame) (ParrotType, error)
+
+// frame holds the state of one call of a compiled fn: its locals, the
+// values its closure captured and the call stack entry of the call.
+type frame struct {
+	slots  []ParrotType
+	free   []ParrotType
+	self   ParrotType
+	env    EnvType
+	call   *Frame
+	budget *Budget
+	tail   tailCall // the call a tailMarker stands for
+}
+
+type tailCall struct {
+	fn   ParrotFunc
+	args []ParrotType
+	name string
+	pos  Position
+}
+
+// Forms in tail position return these markers instead of a value: a recur
+// has stored the new values of the loop's locals, a tail call has stored
+// the call in frame.tail for the enclosing fn to make in its place.
+type marker struct{ name string }
+
+var (
+	recurMarker = &marker{"recur"}
+	tailMarker  = &marker{"tail call"}
+)
+
+const (
+	localRef = iota // a slot of the frame
+	freeRef         // a value captured by the closure
+	selfRef         // the named fn itself
+)
+
+type ref struct {
+	kind  int
+	index int
+}
+
+func (fr *frame) load(r ref) ParrotType {
+	switch r.kind {
+	case localRef:
+		return fr.slots[r.index]
+	case freeRef:
+		return fr.free[r.index]
+	}
+	return fr.self
+}
+
+// fnScope is a fn being compiled.
+type fnScope struct {
+	outer   *scope // the scope the fn is defined in, nil at top level
+	nslots  int
+	free    []ref // where the defining frame keeps each captured value
+	freeIdx map[string]int
+	self    string
+}
+
+// scope maps the locals bound by one fn, let, loop or catch to slots.
+type scope struct {
+	names map[string]int
+	outer *scope // enclosing scope of the same fn
+	fn    *fnScope
+}
+
+func newFnScope(outer *scope, self string) *scope {
+	fs := &fnScope{outer: outer, freeIdx: map[string]int{}, self: self}
+	return &scope{map[string]int{}, nil, fs}
+}
+
+func (sc *scope) nest() *scope {
+	return &scope{map[string]int{}, sc, sc.fn}
+}
+
+// bind allocates a slot for the local name.
+func (sc *scope) bind(name string) int {
+	i := sc.fn.nslots
+	sc.fn.nslots++
+	sc.names[name] = i
+	return i
+}
+
+// resolve finds the local name, capturing it from enclosing fns if needed.
+func (sc *scope) resolve(name string) (ref, bool) {
+	for s := sc; s != nil; s = s.outer {
+		if i, ok := s.names[name]; ok {
+			return ref{localRef, i}, true
+		}
+	}
+	fs := sc.fn
+	if fs.self != "" && fs.self == name {
+		return ref{selfRef, 0}, true
+	}
+	if i, ok := fs.freeIdx[name]; ok {
+		return ref{freeRef, i}, true
+	}
+	if fs.outer == nil {
+		return ref{}, false
+	}
+	r, ok := fs.outer.resolve(name)
+	if !ok {
+		return ref{}, false
+	}
+	fs.free = append(fs.free, r)
+	fs.freeIdx[name] = len(fs.free) - 1
+	return ref{freeRef, len(fs.free) - 1}, true
+}
+
+// recurTarget is the loop or fn a recur jumps back to.
+type recurTarget struct {
+	binders []binder
+}
+
+// where describes the position a form is compiled in.
+type where struct {
+	tail  bool         // the form's value is the value of its fn
+	recur *recurTarget // what a recur here jumps to, nil if it may not recur
+	pos   Position     // innermost enclosing form that has a position
+}
+
+func (w where) operand() where {
+	return where{false, nil, w.pos}
+}
+
+type compiler struct {
+	env EnvType // env the code will run in
+}
+
+// compileError positions an error found while compiling.
+func compileError(pos Position, e error) error {
+	return traceError(e, nil, pos)
+}
+
+// topLevel returns the forms of ast that are compiled and run one at a
+// time, by both backends: the forms of a top-level do, and of the dos in
+// it, or ast itself.
+func topLevel(ast ParrotType) []ParrotType {
+	lst, ok := ast.(List)
+	if !ok || len(lst.Val) == 0 || lst.Val[0] != (Symbol{"do"}) {
+		return []ParrotType{ast}
+	}
+	forms := []ParrotType{}
+	for _, form := range lst.Val[1:] {
+		forms = append(forms, topLevel(form)...)
+	}
+	return forms
+}
+
+// compileTop compiles ast as the body of a fn without parameters.
+func compileTop(ast ParrotType, env EnvType) (code, *fnScope, error) {
+	sc := newFnScope(nil, "")
+	c := &compiler{env}
+	body, e := c.compile(ast, sc, where{tail: true})
+	return body, sc.fn, e
+}
+
+func (c *compiler) compile(form ParrotType, sc *scope, w where) (code, error) {
+	switch f := form.(type) {
+	case Symbol:
+		return c.compileSymbol(f, sc, w)
+	case List:
+		return c.compileList(f, sc, w)
+	case *LazySeq, Cons:
+		// Macros may build their expansions with the seq functions.
+		lst, e := ToList(f)
+		if e != nil {
+			return nil, compileError(w.pos, e)
+		}
+		return c.compile(lst, sc, w)
+	case Vector:
+		elems, e := c.compileAll(f.Val.Slice(), sc, w.operand())
+		if e != nil {
+			return nil, e
+		}
+		return func(fr *frame) (ParrotType, error) {
+			vals, e := run(elems, fr)
+			if e != nil {
+				return nil, e
+			}
+			return NewVector(vals...), nil
+		}, nil
+	case HashMap:
+		return c.compileHashMap(f, sc, w)
+	case Set:
+		elems, e := c.compileAll(f.Val.Keys(), sc, w.operand())
+		if e != nil {
+			return nil, e
+		}
+		return func(fr *frame) (ParrotType, error) {
+			vals, e := run(elems, fr)
+			if e != nil {
+				return nil, e
+			}
+			return NewSet(vals...), nil
+		}, nil
+	}
+	return func(*frame) (ParrotType, error) { return form, nil }, nil
+}
+
+func (c *compiler) compileAll(forms []ParrotType, sc *scope, w where) ([]code, error) {
+	codes := make([]code, len(forms))
+	for i, f := range forms {
+		cd, e := c.compile(f, sc, w)
+		if e != nil {
+			return nil, e
+		}
+		codes[i] = cd
+	}
+	return codes, nil
+}
+
+func run(codes []code, fr *frame) ([]ParrotType, error) {
+	vals := make([]ParrotType, len(codes))
+	for i, cd := range codes {
+		v, e := cd(fr)
+		if e != nil {
+			return nil, e
+		}
+		vals[i] = v
+	}
+	return vals, nil
+}
+
+func (c *compiler) compileHashMap(m HashMap, sc *scope, w where) (code, error) {
+	keys := []code{}
+	vals := []code{}
+	var err error
+	m.Val.Range(func(k, v ParrotType) bool {
+		var kc, vc code
+		if kc, err = c.compile(k, sc, w.operand()); err != nil {
+			return false
+		}
+		if vc, err = c.compile(v, sc, w.operand()); err != nil {
+			return false
+		}
+		keys = append(keys, kc)
+		vals = append(vals, vc)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return func(fr *frame) (ParrotType, error) {
+		hm := PersistentMap{}.Transient()
+		for i := range keys {
+			k, e := keys[i](fr)
+			if e != nil {
+				return nil, e
+			}
+			v, e := vals[i](fr)
+			if e != nil {
+				return nil, e
+			}
+			hm.Assoc(k, v)
+		}
+		return HashMap{hm.Persistent(), nil}, nil
+	}, nil
+}
+
+type resolver interface {
+	Resolve(name string) *Binding
+}
+
+func (c *compiler) compileSymbol(sym Symbol, sc *scope, w where) (code, error) {
+	if r, ok := sc.resolve(sym.Val); ok {
+		return func(fr *frame) (ParrotType, error) { return fr.load(r), nil }, nil
+	}
+	// globals are looked up once and then read from where they are
+	// defined, so that redefinitions are seen, until a new definition
+	// may shadow them
+	var cache atomic.Value
+	pos := w.pos
+	return func(fr *frame) (ParrotType, error) {
+		if b, ok := cache.Load().(*Binding); ok && b.Valid() {
+			if v, ok := b.Data[b.Key]; ok {
+				return v, nil
+			}
+		}
+		if r, ok := fr.env.(resolver); ok {
+			if b := r.Resolve(sym.Val); b != nil {
+				cache.Store(b)
+				return b.Data[b.Key], nil
+			}
+		}
+		v, e := fr.env.Get(sym)
+		if e != nil {
+			return nil, traceError(e, fr.call, pos)
+		}
+		return v, nil
+	}, nil
+}
+
+// macro returns the macro the head of a call names, if any.
+func (c *compiler) macro(head ParrotType, sc *scope) (ParrotFunc, bool) {
+	sym, ok := head.(Symbol)
+	if !ok {
+		return ParrotFunc{}, false
+	}
+	if _, local := sc.resolve(sym.Val); local {
+		return ParrotFunc{}, false
+	}
+	v, e := c.env.Get(sym)
+	if e != nil {
+		return ParrotFunc{}, false
+	}
+	fn, ok := v.(ParrotFunc)
+	return fn, ok && fn.IsMacro
+}
+
+func (c *compiler) compileList(lst List, sc *scope, w where) (code, error) {
+	if p, ok := GetPosition(lst); ok {
+		w.pos = p
+	}
+	if len(lst.Val) == 0 {
+		return func(*frame) (ParrotType, error) { return lst, nil }, nil
+	}
+	head := ""
+	if Symbol_Q(lst.Val[0]) {
+		head = lst.Val[0].(Symbol).Val
+	}
+	args := lst.Val[1:]
+	switch head {
+	case "def":
+		return c.compileDef(args, sc, w)
+	case "defmacro":
+		return c.compileDefmacro(args, sc, w)
+	case "let":
+		return c.compileLet(args, sc, w, false)
+	case "loop":
+		return c.compileLet(args, sc, w, true)
+	case "recur":
+		return c.compileRecur(args, sc, w)
+	case "fn":
+		return c.compileFn(args, sc, w)
+	case "if":
+		return c.compileIf(args, sc, w)
+	case "do":
+		return c.compileBody(args, sc, w)
+	case "try":
+		return c.compileTry(args, sc, w)
+	case "quote":
+		var val ParrotType
+		if len(args) > 0 {
+			val = args[0]
+		}
+		return func(*frame) (ParrotType, error) { return val, nil }, nil
+	case "quasiquote":
+		var val ParrotType
+		if len(args) > 0 {
+			val = args[0]
+		}
+		return c.compile(quasiquote(val), sc, w)
+	case "macroexpand":
+		var val ParrotType
+		if len(args) > 0 {
+			val = args[0]
+		}
+		return func(fr *frame) (ParrotType, error) { return macroexpand(val, fr.env) }, nil
+	case "ns":
+		pos := w.pos
+		return func(fr *frame) (ParrotType, error) {
+			if e := evalNs(args, fr.env); e != nil {
+				return nil, traceError(e, fr.call, pos)
+			}
+			return nil, nil
+		}, nil
+	case ".", ".-":
+		return c.compileInterop(head, args, sc, w)
+	}
+	if mac, ok := c.macro(lst.Val[0], sc); ok {
+		expanded, e := Apply(mac, args, false)
+		if e != nil {
+			return nil, compileError(w.pos, extendTrace(e, head, nil, w.pos))
+		}
+		return c.compile(expanded, sc, w)
+	}
+	return c.compileCall(lst, sc, w)
+}
+
+func (c *compiler) compileCall(lst List, sc *scope, w where) (code, error) {
+	fc, e := c.compile(lst.Val[0], sc, w.operand())
+	if e != nil {
+		return nil, e
+	}
+	argc, e := c.compileAll(lst.Val[1:], sc, w.operand())
+	if e != nil {
+		return nil, e
+	}
+	name := printer.PrintStr(lst.Val[0], true)
+	symName := ""
+	if Symbol_Q(lst.Val[0]) {
+		symName = name
+	}
+	tail, pos := w.tail, w.pos
+	return func(fr *frame) (ParrotType, error) {
+		f, e := fc(fr)
+		if e != nil {
+			return nil, e
+		}
+		args, e := run(argc, fr)
+		if e != nil {
+			return nil, e
+		}
+		switch fn := f.(type) {
+		case ParrotFunc:
+			callee := fn.Name
+			if callee == "" {
+				callee = symName
+			}
+			if fn.Compiled == nil {
+				res, e := Apply(fn, args, false)
+				if e != nil {
+					return nil, traceError(e, fr.call, pos)
+				}
+				return res, nil
+			}
+			if tail {
+				fr.tail = tailCall{fn, args, callee, pos}
+				return tailMarker, nil
+			}
+			return fn.Compiled.Call(args, &Frame{Name: callee, Pos: pos, Caller: fr.call}, fr.budget)
+		case Func:
+			res, e := fn.Call(args, fr.budget)
+			if e != nil {
+				return nil, traceError(extendTrace(e, name, fr.call, pos), fr.call, pos)
+			}
+			return res, nil
+		case Set:
+			res, e := fn.Call(args)
+			if e != nil {
+				return nil, traceError(e, fr.call, pos)
+			}
+			return res, nil
+		}
+		return nil, traceError(errors.New("attempt to call non-function"), fr.call, pos)
+	}, nil
+}
+
+func (c *compiler) compileDef(args []ParrotType, sc *scope, w where) (code, error) {
+	if len(args) != 2 || !Symbol_Q(args[0]) {
+		return nil, compileError(w.pos, errors.New("def requires a symbol and a value"))
+	}
+	sym := args[0].(Symbol)
+	val, e := c.compile(args[1], sc, w.operand())
+	if e != nil {
+		return nil, e
+	}
+	return func(fr *frame) (ParrotType, error) {
+		res, e := val(fr)
+		if e != nil {
+			return nil, e
+		}
+		if fn, ok := res.(ParrotFunc); ok && fn.Name == "" {
+			fn.Name = sym.Val
+			res = fn
+		}
+		return fr.env.Set(sym, res), nil
+	}, nil
+}
+
+func (c *compiler) compileDefmacro(args []ParrotType, sc *scope, w where) (code, error) {
+	if len(args) != 2 || !Symbol_Q(args[0]) {
+		return nil, compileError(w.pos, errors.New("defmacro requires a symbol and a fn"))
+	}
+	sym := args[0].(Symbol)
+	val, e := c.compile(args[1], sc, w.operand())
+	if e != nil {
+		return nil, e
+	}
+	pos := w.pos
+	return func(fr *frame) (ParrotType, error) {
+		res, e := val(fr)
+		if e != nil {
+			return nil, e
+		}
+		mac, ok := res.(ParrotFunc)
+		if !ok {
+			return nil, traceError(errors.New("defmacro requires a fn"), fr.call, pos)
+		}
+		if mac.Name == "" {
+			mac.Name = sym.Val
+		}
+		return fr.env.Set(sym, mac.SetMacro()), nil
+	}, nil
+}
+
+// compileBody compiles forms evaluated in order for the value of the last.
+func (c *compiler) compileBody(forms []ParrotType, sc *scope, w where) (code, error) {
+	if len(forms) == 0 {
+		return func(*frame) (ParrotType, error) { return nil, nil }, nil
+	}
+	init, e := c.compileAll(forms[:len(forms)-1], sc, w.operand())
+	if e != nil {
+		return nil, e
+	}
+	last, e := c.compile(forms[len(forms)-1], sc, w)
+	if e != nil {
+		return nil, e
+	}
+	if len(init) == 0 {
+		return last, nil
+	}
+	return func(fr *frame) (ParrotType, error) {
+		for _, cd := range init {
+			if _, e := cd(fr); e != nil {
+				return nil, e
+			}
+		}
+		return last(fr)
+	}, nil
+}
+
+func (c *compiler) compileIf(args []ParrotType, sc *scope, w where) (code, error) {
+	if len(args) < 1 || len(args) > 3 {
+		return nil, compileError(w.pos, errors.New("if requires a condition, an optional then and an optional else form"))
+	}
+	cond, e := c.compile(args[0], sc, w.operand())
+	if e != nil {
+		return nil, e
+	}
+	// a missing then or else form is nil, as it was for Eval
+	var thenForm ParrotType
+	if len(args) > 1 {
+		thenForm = args[1]
+	}
+	then, e := c.compile(thenForm, sc, w)
+	if e != nil {
+		return nil, e
+	}
+	els := func(*frame) (ParrotType, error) { return nil, nil }
+	if len(args) == 3 {
+		if els, e = c.compile(args[2], sc, w); e != nil {
+			return nil, e
+		}
+	}
+	return func(fr *frame) (ParrotType, error) {
+		v, e := cond(fr)
+		if e != nil {
+			return nil, e
+		}
+		if v == nil || v == false {
+			return els(fr)
+		}
+		return then(fr)
+	}, nil
+}
+
+// compileLet compiles (let [bindings] body*) and, if isLoop, (loop
+// [bindings] body*), which recur jumps back into with new values.
+func (c *compiler) compileLet(args []ParrotType, sc *scope, w where, isLoop bool) (code, error) {
+	form := "let"
+	if isLoop {
+		form = "loop"
+	}
+	if len(args) == 0 {
+		return nil, compileError(w.pos, errors.New(form+" requires a binding vector"))
+	}
+	binds, e := GetSlice(args[0])
+	if e != nil || len(binds)%2 == 1 {
+		return nil, compileError(w.pos, errors.New(form+" requires a vector of an even number of forms"))
+	}
+	inner := sc.nest()
+	inits := []code{}
+	binders := []binder{}
+	for i := 0; i < len(binds); i += 2 {
+		init, e := c.compile(binds[i+1], inner, w.operand())
+		if e != nil {
+			return nil, e
+		}
+		b, e := c.compilePattern(binds[i], inner, w)
+		if e != nil {
+			return nil, e
+		}
+		inits = append(inits, init)
+		binders = append(binders, b)
+	}
+	bw := w
+	if isLoop {
+		bw.recur = &recurTarget{binders}
+	}
+	body, e := c.compileBody(args[1:], inner, bw)
+	if e != nil {
+		return nil, e
+	}
+	pos := w.pos
+	return func(fr *frame) (ParrotType, error) {
+		for i, init := range inits {
+			v, e := init(fr)
+			if e != nil {
+				return nil, e
+			}
+			if e := binders[i](fr, v); e != nil {
+				return nil, traceError(e, fr.call, pos)
+			}
+		}
+		if !isLoop {
+			return body(fr)
+		}
+		for {
+			v, e := body(fr)
+			if v != recurMarker || e != nil {
+				return v, e
+			}
+			if fr.budget != nil {
+				if e := fr.budget.Step(); e != nil {
+					return nil, traceError(e, fr.call, pos)
+				}
+			}
+		}
+	}, nil
+}
+
+func (c *compiler) compileRecur(args []ParrotType, sc *scope, w where) (code, error) {
+	target := w.recur
+	if target == nil {
+		return nil, compileError(w.pos, errors.New("can only recur from tail position"))
+	}
+	if len(args) != len(target.binders) {
+		return nil, compileError(w.pos, fmt.Errorf("recur expects %d args, got %d", len(target.binders), len(args)))
+	}
+	argc, e := c.compileAll(args, sc, w.operand())
+	if e != nil {
+		return nil, e
+	}
+	pos := w.pos
+	return func(fr *frame) (ParrotType, error) {
+		vals, e := run(argc, fr)
+		if e != nil {
+			return nil, e
+		}
+		for i, b := range target.binders {
+			if e := b(fr, vals[i]); e != nil {
+				return nil, traceError(e, fr.call, pos)
+			}
+		}
+		return recurMarker, nil
+	}, nil
+}
+
+func (c *compiler) compileTry(args []ParrotType, sc *scope, w where) (code, error) {
+	if len(args) == 0 {
+		return nil, compileError(w.pos, errors.New("try requires a body"))
+	}
+	body, e := c.compile(args[0], sc, w.operand())
+	if e != nil {
+		return nil, e
+	}
+	var handler code
+	slot := -1
+	if len(args) > 1 {
+		clause, e := GetSlice(args[1])
+		if e != nil || !List_Q(args[1]) || len(clause) < 2 ||
+			!Symbol_Q(clause[0]) || clause[0].(Symbol).Val != "catch" || !Symbol_Q(clause[1]) {
+			return nil, compileError(w.pos, errors.New("try expects (catch name body*)"))
+		}
+		inner := sc.nest()
+		slot = inner.bind(clause[1].(Symbol).Val)
+		hw := w
+		hw.recur = nil
+		if handler, e = c.compileBody(clause[2:], inner, hw); e != nil {
+			return nil, e
+		}
+	}
+	return func(fr *frame) (ParrotType, error) {
+		v, e := body(fr)
+		if e == nil {
+			return v, nil
+		}
+		if handler == nil || IsInterrupt(e) || IsEscape(e) {
+			return nil, e
+		}
+		var perr ParrotError
+		if errors.As(e, &perr) {
+			fr.slots[slot] = perr.Obj
+		} else {
+			fr.slots[slot] = e.Error()
+		}
+		return handler(fr)
+	}, nil
+}
+
+func (c *compiler) compileInterop(head string, args []ParrotType, sc *scope, w where) (code, error) {
+	if len(args) < 2 || !Symbol_Q(args[1]) {
+		return nil, compileError(w.pos, errors.New(head+" requires an object and a member name"))
+	}
+	member := args[1].(Symbol).Val
+	argc, e := c.compileAll(append([]ParrotType{args[0]}, args[2:]...), sc, w.operand())
+	if e != nil {
+		return nil, e
+	}
+	pos := w.pos
+	return func(fr *frame) (ParrotType, error) {
+		vals, e := run(argc, fr)
+		if e != nil {
+			return nil, e
+		}
+		var res ParrotType
+		if head == ".-" {
+			res, e = interop.Field(vals[0], member)
+		} else {
+			res, e = interop.CallMethod(vals[0], member, vals[1:])
+		}
+		if e != nil {
+			return nil, traceError(e, fr.call, pos)
+		}
+		return res, nil
+	}, nil
+}
@@ -0,0 +1,38 @@
+package parrot
+
+import (
+	"testing"
+)
+
+// TestShadowingCoreNames checks that code that has already run sees a
+// later definition that shadows the global it used.
+func TestShadowingCoreNames(t *testing.T) {
+	expectBoth(t, map[string]string{
+		`(defn f [] (inc 1)) (f) (def inc (fn [x] :mine)) (f)`:                                                         ":mine",
+		`(defn f [a] (+ a 2)) (f 1) (def + (fn [a b] :plus)) (f 1)`:                                                    ":plus",
+		`(ns a) (defn f [] (dec 1)) (f) (def dec (fn [x] :shadowed)) (f)`:                                              ":shadowed",
+		`(def x 1) (defn f [] x) (f) (def x 2) (f)`:                                                                    "2",
+		`(ns lib) (def inc (fn [x] :lib)) (ns app) (defn f [] (inc 1)) (f) (ns app (:require [lib :refer [inc]])) (f)`: ":lib",
+		`(def x 1) (defn f [] x) (f) (ns other) (def x 2) (ns user) (f)`:                                               "1",
+	})
+}
+
+func TestGeneratedParamsDoNotClash(t *testing.T) {
+	expectBoth(t, map[string]string{
+		`((fn [[a] p__0 p__1] [a p__0 p__1]) [1] 2 3)`:             "[1 2 3]",
+		`((fn [p__1 [a b]] [p__1 a b]) 0 [1 2])`:                   "[0 1 2]",
+		`((fn [{:keys [p__0]} [p__1]] [p__0 p__1]) {:p__0 1} [2])`: "[1 2]",
+	})
+}
+
+func TestIfWithoutBranches(t *testing.T) {
+	expectBoth(t, map[string]string{
+		`(if true)`:                              "nil",
+		`(if false)`:                             "nil",
+		`(def n (atom 0)) (if (swap! n inc)) @n`: "1",
+		`(if false 1)`:                           "nil",
+	})
+	expectErrorBoth(t, map[string]string{
+		`(if)`: "if requires a condition",
+	})
+}
@@ -0,0 +1,73 @@
+package parrot
+
+import (
+	"testing"
+)
+
+func TestCallCC(t *testing.T) {
+	expectBoth(t, map[string]string{
+		`(call/cc (fn [k] 1))`:                  "1",
+		`(+ 1 (call/cc (fn [k] (+ 10 (k 2)))))`: "3",
+		`(call/cc (fn [k] (doall (map (fn [x] (if (= x 2) (k x) x)) [1 2 3])) :not-escaped))`: "2",
+		`(call/cc (fn [k] (try (k 1) (catch e :caught))))`:                                    "1",
+		`(call/cc (fn [outer] (call/cc (fn [inner] (outer 1))) 2))`:                           "1",
+	})
+	expectErrorBoth(t, map[string]string{
+		`(def saved nil) (call/cc (fn [k] (def saved k))) (saved 1)`: "after its call/cc returned",
+	})
+}
+
+func TestResetShift(t *testing.T) {
+	expectBoth(t, map[string]string{
+		`(reset 1)`:                              "1",
+		`(reset (+ 1 (shift k 10)))`:             "10",
+		`(reset (+ 1 (shift k (k 10))))`:         "11",
+		`(reset (+ 1 (shift k (* 2 (k 10)))))`:   "22",
+		`(+ 1 (reset (+ 10 (shift k (k 100)))))`: "111",
+		`(defn yield [x] (shift k {:val x :next k})) (get ((get (reset (yield 1) (yield 2) nil) :next)) :val)`: "2",
+		`(defn gen [xs]
+		   (reset (loop [xs xs]
+		            (if (empty? xs)
+		              nil
+		              (do (shift k {:val (first xs) :next k})
+		                  (recur (rest xs)))))))
+		 (loop [g (gen [1 2 3]) acc []]
+		   (if g (recur ((get g :next)) (conj acc (get g :val))) acc))`: "[1 2 3]",
+		`(try (reset (try (shift k (throw "x")) (catch e :inside))) (catch e :outside))`: ":outside",
+		// a shift in a fn called back by a builtin belongs to the reset
+		`(reset (+ 1 (first (doall (map (fn [x] (shift k (k x))) [10])))))`: "11",
+		// the fn a shift passes k to runs outside of its reset
+		`(reset (+ 1 (shift k (reset (* 2 (shift j (j (k 10))))))))`: "22",
+	})
+	expectErrorBoth(t, map[string]string{
+		`(shift k 1)`:                       "shift outside of reset",
+		`(reset (+ 1 (shift k (k (k 1)))))`: "continuation already invoked",
+		`(reset (shift k (throw "boom")))`:  "boom",
+	})
+}
+
+// TestResetConcurrent runs resets from several goroutines at once. Run it
+// with -race.
+func TestResetConcurrent(t *testing.T) {
+	expect(t, map[string]string{
+		`(def c (makeChan))
+		 (doall (map (fn [i] (go (fn [] (send c (reset (+ i (shift k (k 1)))))) [])) (range 8)))
+		 (reduce + (map (fn [_] (receive c)) (range 8)))`: "36",
+	})
+}
+
+// TestResumeLater resumes a continuation in a later evaluation than the one
+// that captured it.
+func TestResumeLater(t *testing.T) {
+	for name, opts := range backends {
+		t.Run(name, func(t *testing.T) {
+			it := New(opts...)
+			if _, e := it.Rep(`(def k (reset (+ 1 (shift k k))))`); e != nil {
+				t.Fatal(e)
+			}
+			if got, e := it.Rep(`(k 41)`); e != nil || got != "42" {
+				t.Errorf("(k 41) = %v, %v, want 42", got, e)
+			}
+		})
+	}
+}
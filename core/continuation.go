@@ -0,0 +1,122 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"github.com/sllt/parrot/types"
+)
+
+// escapeTarget identifies one call of call/cc. Its continuation may only
+// be invoked until that call returns.
+type escapeTarget struct {
+	done int32
+}
+
+// CallCC calls f with the current continuation k. Invoking (k v) makes
+// call/cc return v at once. Continuations are escape-only: invoking k after
+// call/cc returned, or from a goroutine started inside it, is an error.
+func CallCC(a []types.ParrotType) (types.ParrotType, error) {
+	t := &escapeTarget{}
+	k := types.Func{func(args []types.ParrotType) (types.ParrotType, error) {
+		if atomic.LoadInt32(&t.done) == 1 {
+			return nil, errors.New("continuation invoked after its call/cc returned")
+		}
+		var v types.ParrotType
+		if len(args) > 0 {
+			v = args[0]
+		}
+		return nil, &types.Escape{t, v}
+	}, nil, false, nil}
+	res, e := types.Apply(a[0], []types.ParrotType{k}, false)
+	atomic.StoreInt32(&t.done, 1)
+	var esc *types.Escape
+	if errors.As(e, &esc) && esc.Target == t {
+		return esc.Val, nil
+	}
+	return res, e
+}
+
+// prompt delimits the continuations captured by shift. The body of each
+// reset runs on a goroutine of its own, under a budget that holds its
+// prompt, and shift parks that goroutine until its continuation is invoked.
+type prompt struct {
+	out    chan outcome
+	budget *types.Budget // of the code that called reset
+}
+
+// outcome is what the body of a reset did next: return or throw, or shift
+// to fn with the continuation k.
+type outcome struct {
+	val types.ParrotType
+	err error
+	fn  types.ParrotType
+	k   types.ParrotType
+}
+
+// applyUnder applies f to args for code running under budget.
+func applyUnder(f types.ParrotType, args []types.ParrotType, budget *types.Budget) (types.ParrotType, error) {
+	switch fn := f.(type) {
+	case types.Func:
+		return fn.Call(args, budget)
+	case types.ParrotFunc:
+		f = fn.WithBudget(budget)
+	}
+	return types.Apply(f, args, false)
+}
+
+// await waits for what the body of the reset does next and returns the
+// value it gives the reset: that of the body, or that of the fn it shifts
+// to, which runs outside of the reset, under budget.
+func (p *prompt) await(budget *types.Budget) (types.ParrotType, error) {
+	o := <-p.out
+	if o.fn == nil {
+		return o.val, o.err
+	}
+	return applyUnder(o.fn, []types.ParrotType{o.k}, budget)
+}
+
+// Reset calls the thunk f and returns its value, or that of the fn a shift
+// in it passes its continuation to.
+func Reset(a []types.ParrotType, budget *types.Budget) (types.ParrotType, error) {
+	if budget == nil {
+		budget = types.NewBudget(context.Background(), types.Limits{})
+	}
+	p := &prompt{make(chan outcome, 1), budget}
+	go func() {
+		res, e := applyUnder(a[0], nil, budget.Delimit(p))
+		p.out <- outcome{val: res, err: e}
+	}()
+	return p.await(budget)
+}
+
+// Shift captures the rest of the innermost enclosing reset as a fn k and
+// makes the reset return (f k) instead. Invoking (k v) continues the body
+// with v as the value of shift and returns the value of the reset.
+//
+// The rest of the body is not copied but parked on its goroutine, so k is
+// one-shot: it can be invoked once, and (k (k v)) fails. A k that is never
+// invoked keeps the body parked until its evaluation is cancelled or the
+// context of the interpreter is done.
+func Shift(a []types.ParrotType, budget *types.Budget) (types.ParrotType, error) {
+	p, ok := budget.Prompt().(*prompt)
+	if !ok {
+		return nil, errors.New("shift outside of reset")
+	}
+	resume := make(chan types.ParrotType, 1)
+	var used int32
+	k := types.BudgetFunc(func(args []types.ParrotType, b *types.Budget) (types.ParrotType, error) {
+		if !atomic.CompareAndSwapInt32(&used, 0, 1) {
+			return nil, errors.New("continuation already invoked")
+		}
+		var v types.ParrotType
+		if len(args) > 0 {
+			v = args[0]
+		}
+		resume <- v
+		return p.await(b)
+	}, p.budget)
+	p.out <- outcome{fn: a[0], k: k}
+	return budget.Receive(resume)
+}
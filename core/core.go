@@ -3,16 +3,15 @@ package core
 import (
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"math"
-	"os"
+	"math/big"
 	// "reflect"
 	"strings"
 	"time"
 
 	"github.com/sllt/parrot/printer"
 	"github.com/sllt/parrot/reader"
-	"github.com/sllt/parrot/readline"
 	"github.com/sllt/parrot/types"
 )
 
@@ -42,73 +41,112 @@ func FloatNumericDo(op NumericOp, a, b types.Float64) types.ParrotType {
 	return nil
 }
 
-func IntegerNumericDo(op NumericOp, a, b types.Int64) types.ParrotType {
+// IntegerNumericDo applies op to two Int64 values. A result that does not
+// fit in an Int64 is returned as a BigInt, and a division that is not exact
+// as a Ratio.
+func IntegerNumericDo(op NumericOp, a, b types.Int64) (types.ParrotType, error) {
+	x, y := a.Val, b.Val
 	switch op {
 	case Add:
-		return types.Int64{a.Val + b.Val}
+		if s := x + y; (s > x) == (y > 0) {
+			return types.Int64{s}, nil
+		}
 	case Sub:
-		return types.Int64{a.Val - b.Val}
+		if s := x - y; (s < x) == (y > 0) {
+			return types.Int64{s}, nil
+		}
 	case Mult:
-		return types.Int64{a.Val * b.Val}
+		if x == 0 || y == 0 {
+			return types.Int64{0}, nil
+		}
+		if s := x * y; s/y == x && (x != -1 || y != math.MinInt64) && (y != -1 || x != math.MinInt64) {
+			return types.Int64{s}, nil
+		}
 	case Div:
-		return types.Int64{a.Val / b.Val}
-	case Pow:
-		return types.Int64{int64(math.Pow(float64(a.Val), float64(b.Val)))}
+		if y == 0 {
+			return nil, errDivideByZero
+		}
+		if x%y == 0 && (x != math.MinInt64 || y != -1) {
+			return types.Int64{x / y}, nil
+		}
 	}
-	return nil
-}
-
-func NumericMatchInteger(op NumericOp, a types.Int64, b types.ParrotType) (types.ParrotType, error) {
-	switch tb := b.(type) {
-	case types.Float64:
-		return FloatNumericDo(op, types.Float64{float64(a.Val)}, tb), nil
-	case types.Int64:
-		return IntegerNumericDo(op, a, tb), nil
+	res, e := BigIntNumericDo(op, big.NewInt(x), big.NewInt(y))
+	if n, ok := res.(types.BigInt); ok {
+		return types.NewInteger(n.Val), e
 	}
-	return nil, nil
+	return res, e
 }
 
-func NumericMatchFloat(op NumericOp, a types.Float64, b types.ParrotType) (types.ParrotType, error) {
-	var fb types.Float64
-	switch tb := b.(type) {
-	case types.Float64:
-		fb = tb
+// numericRank orders the kinds of numbers: an operation on two numbers is
+// done in the kind of the higher one.
+func numericRank(x types.ParrotType) int {
+	switch x.(type) {
 	case types.Int64:
-		fb = types.Float64{float64(b.(types.Int64).Val)}
+		return 0
+	case types.BigInt:
+		return 1
+	case types.Ratio:
+		return 2
+	case types.Float64:
+		return 3
 	}
-	return FloatNumericDo(op, a, fb), nil
+	return -1
 }
 
 func NumericDo(op NumericOp, a, b types.ParrotType) (types.ParrotType, error) {
-	switch ta := a.(type) {
-	case types.Float64:
-		return NumericMatchFloat(op, ta, b)
-	case types.Int64:
-		return NumericMatchInteger(op, ta, b)
+	ra, rb := numericRank(a), numericRank(b)
+	if ra < 0 {
+		return nil, fmt.Errorf("%s is not a number", printer.PrintStr(a, true))
+	}
+	if rb < 0 {
+		return nil, fmt.Errorf("%s is not a number", printer.PrintStr(b, true))
 	}
-	return nil, nil
+	if rb > ra {
+		ra = rb
+	}
+	switch ra {
+	case 0:
+		return IntegerNumericDo(op, a.(types.Int64), b.(types.Int64))
+	case 1:
+		x, _ := types.BigIntOf(a)
+		y, _ := types.BigIntOf(b)
+		return BigIntNumericDo(op, x, y)
+	case 2:
+		x, _ := types.RatOf(a)
+		y, _ := types.RatOf(b)
+		return RatioNumericDo(op, x, y)
+	}
+	return FloatNumericDo(op, types.Float64{toFloat(a)}, types.Float64{toFloat(b)}), nil
 }
 
 func NumericFunction(op NumericOp, args []types.ParrotType) (types.ParrotType, error) {
+	switch {
+	case len(args) == 0 && op == Add:
+		return types.Int64{0}, nil
+	case len(args) == 0 && op == Mult:
+		return types.Int64{1}, nil
+	case len(args) == 0:
+		return nil, errors.New("wrong number of args (0)")
+	case len(args) == 1 && op == Sub:
+		// (- x) negates x, and (/ x) inverts it
+		return NumericDo(op, types.Int64{0}, args[0])
+	case len(args) == 1 && op == Div:
+		return NumericDo(op, types.Int64{1}, args[0])
+	}
 	accum := args[0]
+	if numericRank(accum) < 0 {
+		return nil, fmt.Errorf("%s is not a number", printer.PrintStr(accum, true))
+	}
 	var err error
 	for _, v := range args[1:] {
 		accum, err = NumericDo(op, accum, v)
 		if err != nil {
-			// fmt.Println(err)
-			return nil, nil
+			return nil, err
 		}
 	}
-	// switch ra := accum.(type) {
-	// case types.Int64:
-	// 	return ra.Val, nil
-	// case types.Float64:
-	// 	return ra.Val, nil
-	// default:
-	// 	return nil, nil
-	// }
 	return accum, nil
 }
+
 func signumFloat(f float64) int {
 	if f > 0 {
 		return 1
@@ -118,47 +156,31 @@ func signumFloat(f float64) int {
 	}
 	return 0
 }
-func signumInt(f int64) int {
-	if f > 0 {
-		return 1
-	}
-	if f < 0 {
+
+func compareInt(a, b int64) int {
+	if a < b {
 		return -1
 	}
+	if a > b {
+		return 1
+	}
 	return 0
 }
 
-func compareInt(a types.Int64, b types.ParrotType) (int, error) {
-	switch bt := b.(type) {
-	case types.Int64:
-		return signumInt(a.Val - bt.Val), nil
-	case types.Float64:
-		return signumFloat(float64(a.Val) - bt.Val), nil
+// compareFloat is like compareInt, but returns 2 or 3 when a or b is NaN,
+// which is neither less than, equal to nor greater than any number.
+func compareFloat(a, b float64) int {
+	nanCount := 0
+	if math.IsNaN(a) {
+		nanCount++
 	}
-	msg := fmt.Sprintf("cannot compare %T to %T", a, b)
-	return 0, errors.New(msg)
-}
-
-func compareFloat(a types.Float64, b types.ParrotType) (int, error) {
-	switch bt := b.(type) {
-	case types.Int64:
-		return signumFloat(a.Val - float64(bt.Val)), nil
-	case types.Float64:
-		nanCount := 0
-		if math.IsNaN(a.Val) {
-			nanCount++
-		}
-		if math.IsNaN(bt.Val) {
-			nanCount++
-		}
-		if nanCount > 0 {
-			return 1 + nanCount, nil
-		}
-		return signumFloat(a.Val - bt.Val), nil
+	if math.IsNaN(b) {
+		nanCount++
 	}
-	msg := fmt.Sprintf("cannot compare %T to %T", a, b)
-	return 0, errors.New(msg)
-
+	if nanCount > 0 {
+		return 1 + nanCount
+	}
+	return signumFloat(a - b)
 }
 
 func compareBool(a types.Bool, b types.ParrotType) (int, error) {
@@ -166,18 +188,34 @@ func compareBool(a types.Bool, b types.ParrotType) (int, error) {
 	return 0, errors.New(msg)
 }
 
+// Compare compares two numbers of any kinds, or two chars. Integers and
+// ratios are compared exactly, and with a float as floats.
 func Compare(a types.ParrotType, b types.ParrotType) (int, error) {
-	switch at := a.(type) {
-	case types.Int64:
-		return compareInt(at, b)
-	case types.Float64:
-		return compareFloat(at, b)
-	case types.Bool:
+	if at, ok := a.(types.Bool); ok {
 		return compareBool(at, b)
 	}
-
-	msg := fmt.Sprintf("cannot compare %T to %T", a, b)
-	return 0, errors.New(msg)
+	if ca, ok := a.(types.Char); ok {
+		if cb, ok := b.(types.Char); ok {
+			return compareInt(int64(ca.Val), int64(cb.Val)), nil
+		}
+	}
+	ra, rb := numericRank(a), numericRank(b)
+	if ra < 0 || rb < 0 {
+		msg := fmt.Sprintf("cannot compare %T to %T", a, b)
+		return 0, errors.New(msg)
+	}
+	if rb > ra {
+		ra = rb
+	}
+	switch ra {
+	case 0:
+		return compareInt(a.(types.Int64).Val, b.(types.Int64).Val), nil
+	case 1, 2:
+		x, _ := types.RatOf(a)
+		y, _ := types.RatOf(b)
+		return x.Cmp(y), nil
+	}
+	return compareFloat(toFloat(a), toFloat(b)), nil
 }
 
 func CompareFunction(name string, args []types.ParrotType) (types.ParrotType, error) {
@@ -187,6 +225,13 @@ func CompareFunction(name string, args []types.ParrotType) (types.ParrotType, er
 
 	res, err := Compare(args[0], args[1])
 	if err != nil {
+		// Values other than numbers can only be tested for equality.
+		switch name {
+		case "=":
+			return types.Equal_Q(args[0], args[1]), nil
+		case "!=":
+			return !types.Equal_Q(args[0], args[1]), nil
+		}
 		return nil, err
 	}
 
@@ -249,7 +294,9 @@ func MakeChanFunction(args []types.ParrotType) (types.ParrotType, error) {
 	return types.Channel{make(chan types.ParrotType, size)}, nil
 }
 
-func ChanFunction(name string, args []types.ParrotType) (types.ParrotType, error) {
+// ChanFunction sends on or receives from a channel, giving up when budget
+// is cancelled.
+func ChanFunction(name string, args []types.ParrotType, budget *types.Budget) (types.ParrotType, error) {
 	if len(args) < 1 {
 		return nil, errors.New("argment error")
 	}
@@ -264,10 +311,9 @@ func ChanFunction(name string, args []types.ParrotType) (types.ParrotType, error
 		if len(args) != 2 {
 			return nil, errors.New("argment error (2)")
 		}
-		channel <- args[1]
-		return nil, nil
+		return nil, budget.Send(channel, args[1])
 	}
-	return <-channel, nil
+	return budget.Receive(channel)
 }
 
 func CloseChanFunction(args []types.ParrotType) (types.ParrotType, error) {
@@ -302,105 +348,6 @@ func fn_q(a []types.ParrotType) (types.ParrotType, error) {
 
 // tuple
 
-func cons(a []types.ParrotType) (types.ParrotType, error) {
-	val := a[0]
-	lst, e := types.GetSlice(a[1])
-	if e != nil {
-		return nil, e
-	}
-	return types.List{append([]types.ParrotType{val}, lst...), nil}, nil
-}
-
-func concat(a []types.ParrotType) (types.ParrotType, error) {
-	if len(a) == 0 {
-		return types.List{}, nil
-	}
-	slc1, e := types.GetSlice(a[0])
-	if e != nil {
-		return nil, e
-	}
-	for i := 1; i < len(a); i++ {
-		slc2, e := types.GetSlice(a[i])
-		if e != nil {
-			return nil, e
-		}
-		slc1 = append(slc1, slc2...)
-	}
-	return types.List{slc1, nil}, nil
-}
-
-func empty_Q(a []types.ParrotType) (types.ParrotType, error) {
-	switch obj := a[0].(type) {
-	case types.List:
-		return len(obj.Val) == 0, nil
-	case types.Vector:
-		return len(obj.Val) == 0, nil
-	case nil:
-		return true, nil
-	default:
-		return nil, errors.New("count called on non-sequence")
-	}
-}
-
-func count(a []types.ParrotType) (types.ParrotType, error) {
-	switch obj := a[0].(type) {
-	case types.List:
-		return len(obj.Val), nil
-	case types.Vector:
-		return len(obj.Val), nil
-	case map[string]types.ParrotType:
-		return len(obj), nil
-	case nil:
-		return 0, nil
-	default:
-		return nil, errors.New("count called on non-sequence")
-	}
-}
-
-func nth(a []types.ParrotType) (types.ParrotType, error) {
-	slc, e := types.GetSlice(a[0])
-	if e != nil {
-		return nil, e
-	}
-	idx := a[1].(int)
-	if idx < len(slc) {
-		return slc[idx], nil
-	} else {
-		return nil, errors.New("nth: index out of range")
-	}
-}
-
-func first(a []types.ParrotType) (types.ParrotType, error) {
-	if len(a) == 0 {
-		return nil, nil
-	}
-	if a[0] == nil {
-		return nil, nil
-	}
-	slc, e := types.GetSlice(a[0])
-	if e != nil {
-		return nil, e
-	}
-	if len(slc) == 0 {
-		return nil, nil
-	}
-	return slc[0], nil
-}
-
-func rest(a []types.ParrotType) (types.ParrotType, error) {
-	if a[0] == nil {
-		return types.List{}, nil
-	}
-	slc, e := types.GetSlice(a[0])
-	if e != nil {
-		return nil, e
-	}
-	if len(slc) == 0 {
-		return types.List{}, nil
-	}
-	return types.List{slc[1:], nil}, nil
-}
-
 func apply(a []types.ParrotType) (types.ParrotType, error) {
 	if len(a) < 2 {
 		return nil, errors.New("apply requires at least 2 args")
@@ -410,7 +357,7 @@ func apply(a []types.ParrotType) (types.ParrotType, error) {
 	for _, b := range a[1 : len(a)-1] {
 		args = append(args, b)
 	}
-	last, e := types.GetSlice(a[len(a)-1])
+	last, e := types.ToSlice(a[len(a)-1])
 	if e != nil {
 		return nil, e
 	}
@@ -418,26 +365,6 @@ func apply(a []types.ParrotType) (types.ParrotType, error) {
 	return types.Apply(f, args, false)
 }
 
-func do_map(a []types.ParrotType) (types.ParrotType, error) {
-	if len(a) != 2 {
-		return nil, errors.New("map requires 2 args")
-	}
-	f := a[0]
-	results := []types.ParrotType{}
-	args, e := types.GetSlice(a[1])
-	if e != nil {
-		return nil, e
-	}
-	for _, arg := range args {
-		res, e := types.Apply(f, []types.ParrotType{arg}, false)
-		results = append(results, res)
-		if e != nil {
-			return nil, e
-		}
-	}
-	return types.List{results, nil}, nil
-}
-
 func conj(a []types.ParrotType) (types.ParrotType, error) {
 	if len(a) < 2 {
 		return nil, errors.New("conj requires at least 2 arguments")
@@ -449,97 +376,90 @@ func conj(a []types.ParrotType) (types.ParrotType, error) {
 			new_slc = append(new_slc, a[i])
 		}
 		return types.List{append(new_slc, seq.Val...), nil}, nil
+	case nil:
+		return conj(append([]types.ParrotType{types.List{}}, a[1:]...))
+	case *types.LazySeq, types.Cons:
+		var res types.ParrotType = seq
+		for _, x := range a[1:] {
+			res = types.Cons{x, res}
+		}
+		return res, nil
 	case types.Vector:
-		new_slc := seq.Val
+		vec := seq.Val.Transient()
 		for _, x := range a[1:] {
-			new_slc = append(new_slc, x)
+			vec.Conj(x)
 		}
-		return types.Vector{new_slc, nil}, nil
-	}
-
-	if !types.HashMap_Q(a[0]) {
-		return nil, errors.New("dissoc called on non-hash map")
-	}
-	new_hm := copyHashMap(a[0].(types.HashMap))
-	for i := 1; i < len(a); i += 1 {
-		key := a[i]
-		if !types.String_Q(key) {
-			return nil, errors.New("dissoc called with non-string key")
+		return types.Vector{vec.Persistent(), nil}, nil
+	case types.HashMap:
+		hm := seq.Val.Transient()
+		for _, x := range a[1:] {
+			entry, ok := x.(types.Vector)
+			if !ok || entry.Val.Len() != 2 {
+				return nil, errors.New("conj on a hash-map requires [key value] vectors")
+			}
+			k, _ := entry.Val.Nth(0)
+			v, _ := entry.Val.Nth(1)
+			hm.Assoc(k, v)
+		}
+		return types.HashMap{hm.Persistent(), nil}, nil
+	case types.Set:
+		t := seq.Val.Transient()
+		for _, x := range a[1:] {
+			t.Assoc(x, x)
 		}
-		delete(new_hm.Val, key.(string))
+		return types.Set{t.Persistent(), nil}, nil
 	}
-	return new_hm, nil
+	return nil, errors.New("conj called on non-collection")
 }
 
-func seq(a []types.ParrotType) (types.ParrotType, error) {
-	if a[0] == nil {
-		return nil, nil
-	}
-	switch arg := a[0].(type) {
-	case types.List:
-		if len(arg.Val) == 0 {
-			return nil, nil
-		}
-		return arg, nil
-	case types.Vector:
-		if len(arg.Val) == 0 {
-			return nil, nil
-		}
-		return types.List{arg.Val, nil}, nil
-	case string:
-		if len(arg) == 0 {
-			return nil, nil
-		}
-		new_slc := []types.ParrotType{}
-		for _, ch := range strings.Split(arg, "") {
-			new_slc = append(new_slc, ch)
+// String
+// realizeAll realizes the lazy seqs in a before it is printed, so that the
+// errors they produce are returned rather than printed.
+func realizeAll(a []types.ParrotType) error {
+	for _, obj := range a {
+		if e := types.Realize(obj); e != nil {
+			return e
 		}
-		return types.List{new_slc, nil}, nil
 	}
-	return nil, errors.New("seq requires string or list or vector or nil")
+	return nil
 }
 
-// String
 func pr_str(a []types.ParrotType) (types.ParrotType, error) {
+	if e := realizeAll(a); e != nil {
+		return nil, e
+	}
 	return printer.PrintList(a, true, "", "", " "), nil
 }
 
-func prn(a []types.ParrotType) (types.ParrotType, error) {
-	fmt.Println(printer.PrintList(a, true, "", "", " "))
-	return nil, nil
+func prn(w io.Writer, a []types.ParrotType) (types.ParrotType, error) {
+	if e := realizeAll(a); e != nil {
+		return nil, e
+	}
+	_, e := fmt.Fprintln(w, printer.PrintList(a, true, "", "", " "))
+	return nil, e
 }
 
 func str(a []types.ParrotType) (types.ParrotType, error) {
+	if e := realizeAll(a); e != nil {
+		return nil, e
+	}
 	return printer.PrintList(a, false, "", "", ""), nil
 }
 
-func println(a []types.ParrotType) (types.ParrotType, error) {
-	fmt.Println(printer.PrintList(a, false, "", "", ""))
-	return nil, nil
-}
-
-func slurp(a []types.ParrotType) (types.ParrotType, error) {
-	b, e := ioutil.ReadFile(a[0].(string))
-	if e != nil {
+func println(w io.Writer, a []types.ParrotType) (types.ParrotType, error) {
+	if e := realizeAll(a); e != nil {
 		return nil, e
 	}
-	return string(b), nil
+	_, e := fmt.Fprintln(w, printer.PrintList(a, false, "", "", ""))
+	return nil, e
 }
 
 // time
 func time_ms(a []types.ParrotType) (types.ParrotType, error) {
-	return int(time.Now().UnixNano()), nil
+	return types.Int64{time.Now().UnixNano() / int64(time.Millisecond)}, nil
 }
 
 // hashmap
-func copyHashMap(hm types.HashMap) types.HashMap {
-	new_hm := types.HashMap{map[string]types.ParrotType{}, nil}
-	for k, v := range hm.Val {
-		new_hm.Val[k] = v
-	}
-	return new_hm
-}
-
 func assoc(a []types.ParrotType) (types.ParrotType, error) {
 	if len(a) < 3 {
 		return nil, errors.New("assoc requires at least 3 arguments")
@@ -547,18 +467,28 @@ func assoc(a []types.ParrotType) (types.ParrotType, error) {
 	if len(a)%2 != 1 {
 		return nil, errors.New("assoc requires odd number of arguments")
 	}
+	if vec, ok := a[0].(types.Vector); ok {
+		t := vec.Val.Transient()
+		for i := 1; i < len(a); i += 2 {
+			idx, e := toInt(a[i], "assoc")
+			if e != nil {
+				return nil, e
+			}
+			if e := t.Assoc(idx, a[i+1]); e != nil {
+				return nil, fmt.Errorf("assoc: %s", e)
+			}
+		}
+		return types.Vector{t.Persistent(), nil}, nil
+	}
 	if !types.HashMap_Q(a[0]) {
 		return nil, errors.New("assoc called on non-hash map")
 	}
-	new_hm := copyHashMap(a[0].(types.HashMap))
+	hm := a[0].(types.HashMap).Val.Transient()
 	for i := 1; i < len(a); i += 2 {
 		key := a[i]
-		if !types.String_Q(key) {
-			return nil, errors.New("assoc called with non-string key")
-		}
-		new_hm.Val[key.(string)] = a[i+1]
+		hm.Assoc(key, a[i+1])
 	}
-	return new_hm, nil
+	return types.HashMap{hm.Persistent(), nil}, nil
 }
 
 func dissoc(a []types.ParrotType) (types.ParrotType, error) {
@@ -568,15 +498,12 @@ func dissoc(a []types.ParrotType) (types.ParrotType, error) {
 	if !types.HashMap_Q(a[0]) {
 		return nil, errors.New("dissoc called on non-hash map")
 	}
-	new_hm := copyHashMap(a[0].(types.HashMap))
+	hm := a[0].(types.HashMap).Val.Transient()
 	for i := 1; i < len(a); i += 1 {
 		key := a[i]
-		if !types.String_Q(key) {
-			return nil, errors.New("dissoc called with non-string key")
-		}
-		delete(new_hm.Val, key.(string))
+		hm.Dissoc(key)
 	}
-	return new_hm, nil
+	return types.HashMap{hm.Persistent(), nil}, nil
 }
 
 func get(a []types.ParrotType) (types.ParrotType, error) {
@@ -586,13 +513,22 @@ func get(a []types.ParrotType) (types.ParrotType, error) {
 	if types.Nil_Q(a[0]) {
 		return nil, nil
 	}
+	if vec, ok := a[0].(types.Vector); ok {
+		idx, e := toInt(a[1], "get")
+		if e != nil {
+			return nil, e
+		}
+		x, _ := vec.Val.Nth(idx)
+		return x, nil
+	}
+	if s, ok := a[0].(types.Set); ok {
+		return s.Call(a[1:])
+	}
 	if !types.HashMap_Q(a[0]) {
 		return nil, errors.New("get called on non-hash map")
 	}
-	if !types.String_Q(a[1]) {
-		return nil, errors.New("get called with non-string key")
-	}
-	return a[0].(types.HashMap).Val[a[1].(string)], nil
+	v, _ := a[0].(types.HashMap).Val.Get(a[1])
+	return v, nil
 }
 
 func update(a []types.ParrotType) (types.ParrotType, error) {
@@ -605,24 +541,21 @@ func update(a []types.ParrotType) (types.ParrotType, error) {
 	if !types.HashMap_Q(a[0]) {
 		return nil, errors.New("get called on non-hash map")
 	}
-	if !types.String_Q(a[1]) {
-		return nil, errors.New("get called with non-string key")
-	}
-	a[0].(types.HashMap).Val[a[1].(string)] = a[2].(types.ParrotType)
-	return a[0].(types.HashMap), nil
+	hm := a[0].(types.HashMap)
+	return types.HashMap{hm.Val.Assoc(a[1], a[2]), hm.Meta}, nil
 }
 
 func contains_Q(hm types.ParrotType, key types.ParrotType) (types.ParrotType, error) {
 	if types.Nil_Q(hm) {
 		return false, nil
 	}
+	if s, ok := hm.(types.Set); ok {
+		return s.Has(key), nil
+	}
 	if !types.HashMap_Q(hm) {
 		return nil, errors.New("get called on non-hash map")
 	}
-	if !types.String_Q(key) {
-		return nil, errors.New("get called with non-string key")
-	}
-	_, ok := hm.(types.HashMap).Val[key.(string)]
+	_, ok := hm.(types.HashMap).Val.Get(key)
 	return ok, nil
 }
 
@@ -630,20 +563,17 @@ func keys(a []types.ParrotType) (types.ParrotType, error) {
 	if !types.HashMap_Q(a[0]) {
 		return nil, errors.New("keys called on non-hash map")
 	}
-	slc := []types.ParrotType{}
-	for k, _ := range a[0].(types.HashMap).Val {
-		slc = append(slc, k)
-	}
-	return types.List{slc, nil}, nil
+	return types.List{a[0].(types.HashMap).Val.Keys(), nil}, nil
 }
 func vals(a []types.ParrotType) (types.ParrotType, error) {
 	if !types.HashMap_Q(a[0]) {
 		return nil, errors.New("keys called on non-hash map")
 	}
 	slc := []types.ParrotType{}
-	for _, v := range a[0].(types.HashMap).Val {
+	a[0].(types.HashMap).Val.Range(func(_, v types.ParrotType) bool {
 		slc = append(slc, v)
-	}
+		return true
+	})
 	return types.List{slc, nil}, nil
 }
 
@@ -661,8 +591,10 @@ func with_meta(a []types.ParrotType) (types.ParrotType, error) {
 		return types.Vector{tobj.Val, m}, nil
 	case types.HashMap:
 		return types.HashMap{tobj.Val, m}, nil
+	case types.Set:
+		return types.Set{tobj.Val, m}, nil
 	case types.Func:
-		return types.Func{tobj.Fn, m, false}, nil
+		return types.Func{tobj.Fn, m, false, tobj.Budgeted}, nil
 	case types.ParrotFunc:
 		fn := tobj
 		fn.Meta = m
@@ -674,6 +606,10 @@ func with_meta(a []types.ParrotType) (types.ParrotType, error) {
 
 func meta(a []types.ParrotType) (types.ParrotType, error) {
 	obj := a[0]
+	if _, ok := types.GetPosition(obj); ok {
+		// the position the reader recorded is not metadata of the user's
+		return nil, nil
+	}
 	switch tobj := obj.(type) {
 	case types.List:
 		return tobj.Meta, nil
@@ -681,6 +617,8 @@ func meta(a []types.ParrotType) (types.ParrotType, error) {
 		return tobj.Meta, nil
 	case types.HashMap:
 		return tobj.Meta, nil
+	case types.Set:
+		return tobj.Meta, nil
 	case types.Func:
 		return tobj.Meta, nil
 	case types.ParrotFunc:
@@ -741,17 +679,35 @@ var NS = map[string]types.ParrotType{
 	"string?": func(a []types.ParrotType) (types.ParrotType, error) {
 		return (types.String_Q(a[0]) && !types.Keyword_Q(a[0])), nil
 	},
+	"char?": func(a []types.ParrotType) (types.ParrotType, error) {
+		return types.Char_Q(a[0]), nil
+	},
 	"keyword?": func(a []types.ParrotType) (types.ParrotType, error) {
 		return types.Keyword_Q(a[0]), nil
 	},
 	"number?": func(a []types.ParrotType) (types.ParrotType, error) {
 		return types.Number_Q(a[0]), nil
 	},
+	"integer?": func(a []types.ParrotType) (types.ParrotType, error) {
+		return types.Integer_Q(a[0]), nil
+	},
+	"float?": func(a []types.ParrotType) (types.ParrotType, error) {
+		_, ok := a[0].(types.Float64)
+		return ok, nil
+	},
+	"ratio?": func(a []types.ParrotType) (types.ParrotType, error) {
+		return types.Ratio_Q(a[0]), nil
+	},
+	"bigint?": func(a []types.ParrotType) (types.ParrotType, error) {
+		return types.BigInt_Q(a[0]), nil
+	},
 	"fn?": fn_q,
 	"macro?": func(a []types.ParrotType) (types.ParrotType, error) {
 		return types.ParrotFunc_Q(a[0]) && a[0].(types.ParrotFunc).GetMacro(), nil
 	},
 	// type
+	"char": char,
+	"int":  do_int,
 	"symbol": func(a []types.ParrotType) (types.ParrotType, error) {
 		return types.Symbol{a[0].(string)}, nil
 	},
@@ -770,21 +726,30 @@ var NS = map[string]types.ParrotType{
 	"pr-str": func(a []types.ParrotType) (types.ParrotType, error) {
 		return pr_str(a)
 	},
-	"println": func(a []types.ParrotType) (types.ParrotType, error) {
-		return println(a)
-	},
-	"prn": func(a []types.ParrotType) (types.ParrotType, error) {
-		return prn(a)
+	"format": format,
+	"fprintf": func(a []types.ParrotType) (types.ParrotType, error) {
+		if len(a) < 1 {
+			return nil, errors.New("fprintf requires a writer and a format string")
+		}
+		w, e := toWriter(a[0], "fprintf")
+		if e != nil {
+			return nil, e
+		}
+		return fprintf(w, "fprintf", a[1:])
 	},
 	"read-string": func(a []types.ParrotType) (types.ParrotType, error) {
+		if len(a) > 1 {
+			return reader.ReadStrFile(a[0].(string), a[1].(string))
+		}
 		return reader.ReadStr(a[0].(string))
 	},
-	"readline": func(a []types.ParrotType) (types.ParrotType, error) {
-		return readline.Readline(a[0].(string))
-	},
-	"slurp": slurp,
 	"string-split": func(a []types.ParrotType) (types.ParrotType, error) {
-		arr := strings.Split(a[0].(string), a[1].(string))
+		var arr []string
+		if re, ok := a[1].(types.Regex); ok {
+			arr = re.Val.Split(a[0].(string), -1)
+		} else {
+			arr = strings.Split(a[0].(string), a[1].(string))
+		}
 		new_arr := []types.ParrotType{}
 		for _, v := range arr {
 			new_arr = append(new_arr, v)
@@ -820,6 +785,27 @@ var NS = map[string]types.ParrotType{
 	"/": func(a []types.ParrotType) (types.ParrotType, error) {
 		return NumericFunction(Div, a)
 	},
+	"quot": func(a []types.ParrotType) (types.ParrotType, error) {
+		return intDivide("quot", a)
+	},
+	"rem": func(a []types.ParrotType) (types.ParrotType, error) {
+		return intDivide("rem", a)
+	},
+	"mod": func(a []types.ParrotType) (types.ParrotType, error) {
+		return intDivide("mod", a)
+	},
+	"bigint":      bigint,
+	"numerator":   numerator,
+	"denominator": denominator,
+	"inc": func(a []types.ParrotType) (types.ParrotType, error) {
+		return NumericFunction(Add, []types.ParrotType{a[0], types.Int64{1}})
+	},
+	"dec": func(a []types.ParrotType) (types.ParrotType, error) {
+		return NumericFunction(Sub, []types.ParrotType{a[0], types.Int64{1}})
+	},
+	"identity": func(a []types.ParrotType) (types.ParrotType, error) {
+		return a[0], nil
+	},
 	"time-ms": time_ms,
 
 	// tuple
@@ -836,7 +822,7 @@ var NS = map[string]types.ParrotType{
 		return types.List_Q(a[0]), nil
 	},
 	"vector": func(a []types.ParrotType) (types.ParrotType, error) {
-		return types.Vector{a, nil}, nil
+		return types.NewVector(a...), nil
 	},
 	"vector?": func(a []types.ParrotType) (types.ParrotType, error) {
 		return types.Vector_Q(a[0]), nil
@@ -857,6 +843,33 @@ var NS = map[string]types.ParrotType{
 	"keys": keys,
 	"vals": vals,
 
+	// regexes
+	"regex?": func(a []types.ParrotType) (types.ParrotType, error) {
+		return types.Regex_Q(a[0]), nil
+	},
+	"re-pattern":      re_pattern,
+	"re-find":         re_find,
+	"re-matches":      re_matches,
+	"re-seq":          re_seq,
+	"re-groups":       re_groups,
+	"re-named-groups": re_named_groups,
+	"re-replace":      re_replace,
+
+	// sets
+	"set": set,
+	"hash-set": func(a []types.ParrotType) (types.ParrotType, error) {
+		return types.NewSet(a...), nil
+	},
+	"set?": func(a []types.ParrotType) (types.ParrotType, error) {
+		return types.Set_Q(a[0]), nil
+	},
+	"disj":         disj,
+	"union":        union,
+	"intersection": intersection,
+	"difference":   difference,
+	"subset?":      subset_Q,
+	"superset?":    superset_Q,
+
 	"sequential?": func(a []types.ParrotType) (types.ParrotType, error) {
 		return types.Sequential_Q(a[0]), nil
 	},
@@ -870,6 +883,53 @@ var NS = map[string]types.ParrotType{
 	"conj":   conj,
 	"seq":    seq,
 
+	// sequences
+	"seq?": func(a []types.ParrotType) (types.ParrotType, error) {
+		switch a[0].(type) {
+		case types.List, *types.LazySeq, types.Cons:
+			return true, nil
+		}
+		return false, nil
+	},
+	"realized?": func(a []types.ParrotType) (types.ParrotType, error) {
+		if l, ok := a[0].(*types.LazySeq); ok {
+			return l.Realized(), nil
+		}
+		return true, nil
+	},
+	"lazy-seq*":  lazySeqFn,
+	"next":       next,
+	"mapcat":     mapcat,
+	"filter":     filter,
+	"remove":     remove,
+	"reduce":     reduce,
+	"range":      do_range,
+	"take":       take,
+	"drop":       drop,
+	"take-while": takeWhile,
+	"drop-while": dropWhile,
+	"partition":  partition,
+	"interleave": interleave,
+	"iterate":    iterate,
+	"repeat":     repeat,
+	"cycle":      cycle,
+	"doall":      doall,
+	"dorun":      dorun,
+	"vec":        vec,
+	"into":       into,
+	"some":       some,
+	"every?":     every_Q,
+	"last":       last,
+	"reverse":    reverse,
+	"for*":       for_STAR,
+
+	// transients
+	"transient":   transient,
+	"persistent!": persistent_BANG,
+	"conj!":       conj_BANG,
+	"assoc!":      assoc_BANG,
+	"dissoc!":     dissoc_BANG,
+
 	"with-meta": with_meta,
 	"meta":      meta,
 	"atom": func(a []types.ParrotType) (types.ParrotType, error) {
@@ -889,24 +949,11 @@ var NS = map[string]types.ParrotType{
 	"go": func(a []types.ParrotType) (types.ParrotType, error) {
 		return GoroutineFunction(a)
 	},
+	"call/cc": CallCC,
 	"makeChan": func(a []types.ParrotType) (types.ParrotType, error) {
 		return MakeChanFunction(a)
 	},
 	"closeChan": func(a []types.ParrotType) (types.ParrotType, error) {
 		return CloseChanFunction(a)
 	},
-	"send": func(a []types.ParrotType) (types.ParrotType, error) {
-		return ChanFunction("send", a)
-	},
-	"receive": func(a []types.ParrotType) (types.ParrotType, error) {
-		return ChanFunction("receive", a)
-	},
-	"system": func(a []types.ParrotType) (types.ParrotType, error) {
-		return SystemFunction(a)
-	},
-	"exit": func(a []types.ParrotType) (types.ParrotType, error) {
-		fmt.Println("Bye !")
-		os.Exit(0)
-		return nil, nil
-	},
 }
@@ -0,0 +1,190 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/sllt/parrot/printer"
+	"github.com/sllt/parrot/types"
+)
+
+// Formatted output. A format string holds text and directives, written as
+// in Go's fmt package: % followed by flags, a width, a precision and a verb,
+// as in %-8s or %08.3f. A width or precision of * is taken from the args.
+//
+//	%s %v %a   the value as println prints it
+//	%r %q      the value as prn prints it, so that it reads back
+//	%d         an integer, and %x %X %o %O %b the same in other bases
+//	%e %f %g   a number as a float, and %E %F %G
+//	%c %U      a char, or the char with the given code
+//	%t         a boolean
+//	%%         a percent sign, and %n a newline
+//
+// %x and %X also print the bytes of a string in hex.
+
+// sprintf formats args according to format, naming fn in its errors.
+func sprintf(fn, format string, args []types.ParrotType) (string, error) {
+	if e := realizeAll(args); e != nil {
+		return "", e
+	}
+	var b strings.Builder
+	next := func(verb string) (types.ParrotType, error) {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("%s: missing argument for %s", fn, verb)
+		}
+		x := args[0]
+		args = args[1:]
+		return x, nil
+	}
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' {
+			b.WriteByte(c)
+			continue
+		}
+		// spec collects the directive as Go's fmt reads it
+		spec := []byte{'%'}
+		i++
+		for ; i < len(format) && strings.IndexByte("-+# 0", format[i]) >= 0; i++ {
+			spec = append(spec, format[i])
+		}
+		for _, part := range []string{"width", "precision"} {
+			if part == "precision" {
+				if i >= len(format) || format[i] != '.' {
+					break
+				}
+				spec = append(spec, '.')
+				i++
+			}
+			if i < len(format) && format[i] == '*' {
+				x, e := next("*")
+				if e != nil {
+					return "", e
+				}
+				n, e := toInt(x, fn)
+				if e != nil {
+					return "", e
+				}
+				spec = strconv.AppendInt(spec, int64(n), 10)
+				i++
+				continue
+			}
+			for ; i < len(format) && format[i] >= '0' && format[i] <= '9'; i++ {
+				spec = append(spec, format[i])
+			}
+		}
+		if i >= len(format) {
+			return "", fmt.Errorf("%s: unterminated directive %s", fn, spec)
+		}
+		verb := rune(format[i])
+		switch verb {
+		case '%':
+			b.WriteByte('%')
+			continue
+		case 'n':
+			b.WriteByte('\n')
+			continue
+		}
+		directive := string(spec) + string(verb)
+		if !strings.ContainsRune("svarqdxXoObeEfFgGcUt", verb) {
+			return "", fmt.Errorf("%s: unknown directive %s", fn, directive)
+		}
+		x, e := next(directive)
+		if e != nil {
+			return "", e
+		}
+		val, e := formatArg(verb, x)
+		if e != nil {
+			return "", fmt.Errorf("%s: %s %s", fn, directive, e)
+		}
+		if verb == 'v' || verb == 'a' || verb == 'r' || verb == 'q' {
+			verb = 's'
+		}
+		fmt.Fprintf(&b, string(spec)+string(verb), val)
+	}
+	if len(args) > 0 {
+		return "", fmt.Errorf("%s: too many arguments", fn)
+	}
+	return b.String(), nil
+}
+
+// formatArg converts x to the Go value verb formats.
+func formatArg(verb rune, x types.ParrotType) (interface{}, error) {
+	switch verb {
+	case 's', 'v', 'a':
+		return printer.PrintStr(x, false), nil
+	case 'r', 'q':
+		return printer.PrintStr(x, true), nil
+	case 'd', 'x', 'X', 'o', 'O', 'b':
+		switch n := x.(type) {
+		case types.Int64:
+			return n.Val, nil
+		case types.BigInt:
+			return n.Val, nil
+		case string:
+			if verb == 'x' || verb == 'X' {
+				return n, nil
+			}
+		}
+		return nil, fmt.Errorf("requires an integer, got %s", printer.PrintStr(x, true))
+	case 'e', 'E', 'f', 'F', 'g', 'G':
+		if !types.Number_Q(x) {
+			return nil, fmt.Errorf("requires a number, got %s", printer.PrintStr(x, true))
+		}
+		return toFloat(x), nil
+	case 'c', 'U':
+		if c, ok := x.(types.Char); ok {
+			return c.Val, nil
+		}
+		c, e := char([]types.ParrotType{x})
+		if e != nil {
+			return nil, fmt.Errorf("requires a char, got %s", printer.PrintStr(x, true))
+		}
+		return c.(types.Char).Val, nil
+	case 't':
+		if t, ok := x.(bool); ok {
+			return t, nil
+		}
+		return nil, fmt.Errorf("requires a boolean, got %s", printer.PrintStr(x, true))
+	}
+	return nil, nil
+}
+
+func formatString(v types.ParrotType) bool {
+	return types.String_Q(v) && !types.Keyword_Q(v)
+}
+
+func format(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) < 1 || !formatString(a[0]) {
+		return nil, errors.New("format requires a format string")
+	}
+	return sprintf("format", a[0].(string), a[1:])
+}
+
+// toWriter returns the io.Writer v is, such as *out* and *err*, or wraps.
+func toWriter(v types.ParrotType, name string) (io.Writer, error) {
+	if w, ok := v.(*types.Writer); ok {
+		return w, nil
+	}
+	if obj, ok := v.(types.GoObject); ok {
+		if w, ok := obj.Val.(io.Writer); ok {
+			return w, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: expected a writer, got %s", name, printer.PrintStr(v, true))
+}
+
+func fprintf(w io.Writer, fn string, a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) < 1 || !formatString(a[0]) {
+		return nil, fmt.Errorf("%s requires a format string", fn)
+	}
+	s, e := sprintf(fn, a[0].(string), a[1:])
+	if e != nil {
+		return nil, e
+	}
+	_, e = io.WriteString(w, s)
+	return nil, e
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/sllt/parrot/types"
+)
+
+func TestFormat(t *testing.T) {
+	for _, c := range []struct {
+		format string
+		args   []types.ParrotType
+		want   string
+	}{
+		{"%s and %a", []types.ParrotType{"x", types.NewVector("y")}, `x and [y]`},
+		{"%r %q", []types.ParrotType{"x", "y"}, `"x" "y"`},
+		{"%5d|%-5d|%05d", []types.ParrotType{types.Int64{42}, types.Int64{42}, types.Int64{42}}, "   42|42   |00042"},
+		{"%x %X %o %b", []types.ParrotType{types.Int64{255}, types.Int64{255}, types.Int64{8}, types.Int64{5}}, "ff FF 10 101"},
+		{"%.2f %e", []types.ParrotType{types.Float64{3.14159}, types.Float64{1234.5}}, "3.14 1.234500e+03"},
+		{"%c %t", []types.ParrotType{types.Char{'z'}, true}, "z true"},
+		{"%*d|%.*f", []types.ParrotType{types.Int64{4}, types.Int64{7}, types.Int64{1}, types.Float64{2.25}}, "   7|2.2"},
+		{"100%%%n", nil, "100%\n"},
+	} {
+		got, e := format(append([]types.ParrotType{c.format}, c.args...))
+		if e != nil {
+			t.Errorf("%q: %v", c.format, e)
+		} else if got != c.want {
+			t.Errorf("%q = %q, want %q", c.format, got, c.want)
+		}
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	for _, c := range []struct {
+		args []types.ParrotType
+		want string
+	}{
+		{[]types.ParrotType{"%d", "x"}, "requires an integer"},
+		{[]types.ParrotType{"%s %s", "x"}, "missing"},
+		{[]types.ParrotType{"%s", "x", "y"}, "too many"},
+		{[]types.ParrotType{"%k", "x"}, "unknown"},
+		{[]types.ParrotType{"ʞkw"}, "format string"},
+	} {
+		if _, e := format(c.args); e == nil || !strings.Contains(e.Error(), c.want) {
+			t.Errorf("%q: got %v, want an error containing %q", c.args, e, c.want)
+		}
+	}
+}
+
+func TestToWriter(t *testing.T) {
+	var buf bytes.Buffer
+	for _, v := range []types.ParrotType{types.NewWriter("*out*", &buf), types.GoObject{&buf}} {
+		w, e := toWriter(v, "fprintf")
+		if e != nil {
+			t.Fatal(e)
+		}
+		if _, e := fprintf(w, "fprintf", []types.ParrotType{"%d;", types.Int64{1}}); e != nil {
+			t.Fatal(e)
+		}
+	}
+	if buf.String() != "1;1;" {
+		t.Errorf("wrote %q, want %q", buf.String(), "1;1;")
+	}
+	if _, e := toWriter("x", "fprintf"); e == nil {
+		t.Error("a string is not a writer")
+	}
+}
@@ -0,0 +1,160 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/sllt/parrot/readline"
+	"github.com/sllt/parrot/types"
+)
+
+// Capability is a kind of side effect builtins may have on the host.
+type Capability uint
+
+const (
+	FSRead Capability = 1 << iota
+	FSWrite
+	Exec
+	Exit
+	Network
+	Stdin
+
+	NoCapabilities  Capability = 0
+	AllCapabilities            = FSRead | FSWrite | Exec | Exit | Network | Stdin
+)
+
+var capabilityNames = []string{"fs-read", "fs-write", "exec", "exit", "network", "stdin"}
+
+func (c Capability) String() string {
+	names := []string{}
+	for i, name := range capabilityNames {
+		if c&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// PermissionError is returned by a builtin that is called by an interpreter
+// without the capability it needs.
+type PermissionError struct {
+	Name       string
+	Capability Capability
+}
+
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("permission denied: %s requires the %s capability", e.Name, e.Capability)
+}
+
+// Host holds the streams and capabilities the side-effecting builtins of an
+// interpreter use.
+type Host struct {
+	Stdout       io.Writer
+	Stderr       io.Writer
+	Stdin        io.Reader
+	Capabilities Capability
+	Budget       *types.Budget  // cancels builtins that block when called from Go, if not nil
+	IndentRules  map[string]int // pprint lays out code by, or nil for the printer's
+	lines        *bufio.Reader
+}
+
+// Check returns a PermissionError unless h allows the builtin called name
+// to use c.
+func (h *Host) Check(c Capability, name string) error {
+	if h.Capabilities&c != c {
+		return &PermissionError{name, c}
+	}
+	return nil
+}
+
+func (h *Host) readLine(prompt string) (types.ParrotType, error) {
+	if h.Stdin == os.Stdin {
+		return readline.Readline(prompt)
+	}
+	if h.lines == nil {
+		h.lines = bufio.NewReader(h.Stdin)
+	}
+	fmt.Fprint(h.Stdout, prompt)
+	line, e := h.lines.ReadString('\n')
+	if e == io.EOF && line != "" {
+		e = nil
+	}
+	if e != nil {
+		return nil, e
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (h *Host) slurp(a []types.ParrotType) (types.ParrotType, error) {
+	if e := h.Check(FSRead, "slurp"); e != nil {
+		return nil, e
+	}
+	b, e := ioutil.ReadFile(a[0].(string))
+	if e != nil {
+		return nil, e
+	}
+	return string(b), nil
+}
+
+// HostNS returns the builtins that print, read and otherwise reach outside
+// the interpreter through h.
+func HostNS(h *Host) map[string]types.ParrotType {
+	return map[string]types.ParrotType{
+		"println": func(a []types.ParrotType) (types.ParrotType, error) {
+			return println(h.Stdout, a)
+		},
+		"prn": func(a []types.ParrotType) (types.ParrotType, error) {
+			return prn(h.Stdout, a)
+		},
+		"pprint":     h.pprint,
+		"pprint-str": h.pprint_str,
+		"printf": func(a []types.ParrotType) (types.ParrotType, error) {
+			return fprintf(h.Stdout, "printf", a)
+		},
+		"reset*": types.BudgetFunc(Reset, h.Budget),
+		"shift*": types.BudgetFunc(Shift, h.Budget),
+		"send": types.BudgetFunc(func(a []types.ParrotType, b *types.Budget) (types.ParrotType, error) {
+			return ChanFunction("send", a, b)
+		}, h.Budget),
+		"receive": types.BudgetFunc(func(a []types.ParrotType, b *types.Budget) (types.ParrotType, error) {
+			return ChanFunction("receive", a, b)
+		}, h.Budget),
+		"eprintln": func(a []types.ParrotType) (types.ParrotType, error) {
+			return println(h.Stderr, a)
+		},
+		"readline": func(a []types.ParrotType) (types.ParrotType, error) {
+			if e := h.Check(Stdin, "readline"); e != nil {
+				return nil, e
+			}
+			return h.readLine(a[0].(string))
+		},
+		"slurp": h.slurp,
+		"system": func(a []types.ParrotType) (types.ParrotType, error) {
+			if e := h.Check(Exec, "system"); e != nil {
+				return nil, e
+			}
+			return SystemFunction(a)
+		},
+		"exit": func(a []types.ParrotType) (types.ParrotType, error) {
+			if e := h.Check(Exit, "exit"); e != nil {
+				return nil, e
+			}
+			code := 0
+			if len(a) > 0 {
+				n, ok := a[0].(types.Int64)
+				if !ok {
+					return nil, fmt.Errorf("exit requires an integer status")
+				}
+				code = int(n.Val)
+			}
+			return nil, &types.ExitError{code}
+		},
+	}
+}
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sllt/parrot/types"
+)
+
+func TestCapabilityString(t *testing.T) {
+	for c, want := range map[Capability]string{
+		NoCapabilities:  "none",
+		FSRead:          "fs-read",
+		FSRead | Exec:   "fs-read|exec",
+		AllCapabilities: "fs-read|fs-write|exec|exit|network|stdin",
+		Network | Stdin: "network|stdin",
+	} {
+		if got := c.String(); got != want {
+			t.Errorf("%d prints as %s, want %s", uint(c), got, want)
+		}
+	}
+}
+
+func TestHostCapabilities(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "f.txt")
+	if e := os.WriteFile(file, []byte("old"), 0o644); e != nil {
+		t.Fatal(e)
+	}
+	call := func(h *Host, name string, args ...types.ParrotType) (types.ParrotType, error) {
+		return HostNS(h)[name].(func([]types.ParrotType) (types.ParrotType, error))(args)
+	}
+	denied := func(e error, c Capability, name string) bool {
+		var pe *PermissionError
+		return errors.As(e, &pe) && pe.Capability == c && pe.Name == name
+	}
+
+	readOnly := &Host{Capabilities: FSRead}
+	if got, e := call(readOnly, "slurp", file); e != nil || got != "old" {
+		t.Errorf("slurp with fs-read = %v, %v", got, e)
+	}
+	for name, c := range map[string]Capability{"system": Exec, "exit": Exit, "readline": Stdin} {
+		if _, e := call(readOnly, name, "x"); !denied(e, c, name) {
+			t.Errorf("%s with fs-read only: %v", name, e)
+		}
+	}
+	if _, e := call(&Host{Capabilities: Exec}, "slurp", file); !denied(e, FSRead, "slurp") {
+		t.Errorf("slurp without fs-read: %v", e)
+	}
+
+	e := (&Host{}).Check(FSRead|FSWrite, "copy")
+	if e == nil || e.Error() != "permission denied: copy requires the fs-read|fs-write capability" {
+		t.Errorf("Check = %v", e)
+	}
+	if e := (&Host{Capabilities: AllCapabilities}).Check(FSRead|FSWrite, "copy"); e != nil {
+		t.Errorf("Check with every capability = %v", e)
+	}
+}
+
+func TestExit(t *testing.T) {
+	exit := HostNS(&Host{Capabilities: Exit})["exit"].(func([]types.ParrotType) (types.ParrotType, error))
+	var ee *types.ExitError
+	if _, e := exit(nil); !errors.As(e, &ee) || ee.Code != 0 {
+		t.Errorf("(exit) = %v, want an ExitError with status 0", e)
+	}
+	if _, e := exit([]types.ParrotType{types.Int64{3}}); !errors.As(e, &ee) || ee.Code != 3 {
+		t.Errorf("(exit 3) = %v, want an ExitError with status 3", e)
+	}
+	if _, e := exit([]types.ParrotType{"x"}); e == nil || errors.As(e, &ee) {
+		t.Errorf("(exit \"x\") = %v, want an error", e)
+	}
+}
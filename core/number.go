@@ -0,0 +1,217 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"unicode"
+
+	"github.com/sllt/parrot/printer"
+	"github.com/sllt/parrot/types"
+)
+
+// Numbers. Int64, BigInt, Ratio and Float64 form a tower: an operation on
+// two numbers is done in the kind of the higher one, Int64 arithmetic that
+// overflows goes on with BigInt, and dividing integers that do not divide
+// exactly gives a Ratio.
+
+var errDivideByZero = errors.New("divide by zero")
+
+func toFloat(x types.ParrotType) float64 {
+	switch n := x.(type) {
+	case types.Int64:
+		return float64(n.Val)
+	case types.BigInt:
+		f, _ := new(big.Float).SetInt(n.Val).Float64()
+		return f
+	case types.Ratio:
+		f, _ := n.Val.Float64()
+		return f
+	case types.Float64:
+		return n.Val
+	}
+	return math.NaN()
+}
+
+// BigIntNumericDo applies op to two integers. Its integer results are
+// BigInt even when they are small, as BigInt is contagious.
+func BigIntNumericDo(op NumericOp, x, y *big.Int) (types.ParrotType, error) {
+	switch op {
+	case Add:
+		return types.BigInt{new(big.Int).Add(x, y)}, nil
+	case Sub:
+		return types.BigInt{new(big.Int).Sub(x, y)}, nil
+	case Mult:
+		return types.BigInt{new(big.Int).Mul(x, y)}, nil
+	case Div:
+		if y.Sign() == 0 {
+			return nil, errDivideByZero
+		}
+		r := new(big.Rat).SetFrac(x, y)
+		if r.IsInt() {
+			return types.BigInt{r.Num()}, nil
+		}
+		return types.Ratio{r}, nil
+	case Pow:
+		if y.Sign() >= 0 && y.IsInt64() {
+			return types.BigInt{new(big.Int).Exp(x, y, nil)}, nil
+		}
+		return RatioNumericDo(op, new(big.Rat).SetInt(x), new(big.Rat).SetInt(y))
+	}
+	return nil, nil
+}
+
+// RatioNumericDo applies op to two exact numbers. Results that are whole
+// are returned as integers.
+func RatioNumericDo(op NumericOp, x, y *big.Rat) (types.ParrotType, error) {
+	r := new(big.Rat)
+	switch op {
+	case Add:
+		r.Add(x, y)
+	case Sub:
+		r.Sub(x, y)
+	case Mult:
+		r.Mul(x, y)
+	case Div:
+		if y.Sign() == 0 {
+			return nil, errDivideByZero
+		}
+		r.Quo(x, y)
+	case Pow:
+		if !y.IsInt() || !y.Num().IsInt64() {
+			xf, _ := x.Float64()
+			yf, _ := y.Float64()
+			return types.Float64{math.Pow(xf, yf)}, nil
+		}
+		n := new(big.Int).Abs(y.Num())
+		r.SetFrac(new(big.Int).Exp(x.Num(), n, nil), new(big.Int).Exp(x.Denom(), n, nil))
+		if y.Sign() < 0 {
+			if r.Sign() == 0 {
+				return nil, errDivideByZero
+			}
+			r.Inv(r)
+		}
+	}
+	return types.NewRatio(r), nil
+}
+
+func toBigInt(x types.ParrotType, name string) (*big.Int, error) {
+	n, ok := types.BigIntOf(x)
+	if !ok {
+		return nil, fmt.Errorf("%s: expected an integer, got %s", name, printer.PrintStr(x, true))
+	}
+	return n, nil
+}
+
+// intDivide implements quot, rem and mod, which take two integers.
+func intDivide(name string, a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) != 2 {
+		return nil, fmt.Errorf("%s requires 2 args", name)
+	}
+	if x, ok := a[0].(types.Int64); ok {
+		if y, ok := a[1].(types.Int64); ok && y.Val != 0 && y.Val != -1 {
+			switch name {
+			case "quot":
+				return types.Int64{x.Val / y.Val}, nil
+			case "rem":
+				return types.Int64{x.Val % y.Val}, nil
+			}
+			m := x.Val % y.Val
+			if m != 0 && (m < 0) != (y.Val < 0) {
+				m += y.Val
+			}
+			return types.Int64{m}, nil
+		}
+	}
+	x, e := toBigInt(a[0], name)
+	if e != nil {
+		return nil, e
+	}
+	y, e := toBigInt(a[1], name)
+	if e != nil {
+		return nil, e
+	}
+	if y.Sign() == 0 {
+		return nil, errDivideByZero
+	}
+	q, m := new(big.Int).QuoRem(x, y, new(big.Int))
+	switch name {
+	case "quot":
+		return types.NewInteger(q), nil
+	case "rem":
+		return types.NewInteger(m), nil
+	}
+	if m.Sign() != 0 && m.Sign() != y.Sign() {
+		m.Add(m, y)
+	}
+	return types.NewInteger(m), nil
+}
+
+func bigint(a []types.ParrotType) (types.ParrotType, error) {
+	switch n := a[0].(type) {
+	case types.Int64, types.BigInt:
+		x, _ := types.BigIntOf(n)
+		return types.BigInt{x}, nil
+	case types.Ratio:
+		return types.BigInt{new(big.Int).Quo(n.Val.Num(), n.Val.Denom())}, nil
+	case types.Float64:
+		if math.IsInf(n.Val, 0) || math.IsNaN(n.Val) {
+			return nil, fmt.Errorf("bigint: cannot convert %s", printer.PrintStr(n, true))
+		}
+		x, _ := big.NewFloat(n.Val).Int(nil)
+		return types.BigInt{x}, nil
+	case string:
+		if x, ok := new(big.Int).SetString(n, 10); ok {
+			return types.BigInt{x}, nil
+		}
+	}
+	return nil, fmt.Errorf("bigint: cannot convert %s", printer.PrintStr(a[0], true))
+}
+
+func numerator(a []types.ParrotType) (types.ParrotType, error) {
+	r, ok := types.RatOf(a[0])
+	if !ok {
+		return nil, fmt.Errorf("numerator: expected a rational, got %s", printer.PrintStr(a[0], true))
+	}
+	return types.NewInteger(new(big.Int).Set(r.Num())), nil
+}
+
+func denominator(a []types.ParrotType) (types.ParrotType, error) {
+	r, ok := types.RatOf(a[0])
+	if !ok {
+		return nil, fmt.Errorf("denominator: expected a rational, got %s", printer.PrintStr(a[0], true))
+	}
+	return types.NewInteger(new(big.Int).Set(r.Denom())), nil
+}
+
+// do_int truncates a number to an integer, and turns a char into its code.
+func do_int(a []types.ParrotType) (types.ParrotType, error) {
+	switch n := a[0].(type) {
+	case types.Char:
+		return types.Int64{int64(n.Val)}, nil
+	case types.Int64, types.BigInt:
+		return n, nil
+	case types.Ratio:
+		return types.NewInteger(new(big.Int).Quo(n.Val.Num(), n.Val.Denom())), nil
+	case types.Float64:
+		if math.IsInf(n.Val, 0) || math.IsNaN(n.Val) {
+			break
+		}
+		x, _ := big.NewFloat(n.Val).Int(nil)
+		return types.NewInteger(x), nil
+	}
+	return nil, fmt.Errorf("int: cannot convert %s", printer.PrintStr(a[0], true))
+}
+
+// char returns the char whose code is the given integer.
+func char(a []types.ParrotType) (types.ParrotType, error) {
+	if c, ok := a[0].(types.Char); ok {
+		return c, nil
+	}
+	n, ok := types.BigIntOf(a[0])
+	if !ok || n.Sign() < 0 || n.Cmp(big.NewInt(unicode.MaxRune)) > 0 {
+		return nil, fmt.Errorf("char: invalid code %s", printer.PrintStr(a[0], true))
+	}
+	return types.Char{rune(n.Int64())}, nil
+}
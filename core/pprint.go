@@ -0,0 +1,95 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sllt/parrot/printer"
+	"github.com/sllt/parrot/types"
+)
+
+// Pretty printing. (pprint x) prints x readably across lines 80 columns
+// wide, laying out code by the indent rules of the host. An options map sets
+// another :width, and adds to the :indent rules, as in
+// {:width 40 :indent {'my-let 1}}.
+
+const defaultWidth = 80
+
+func (h *Host) pprintArgs(name string, a []types.ParrotType) (int, map[string]int, error) {
+	if len(a) != 1 && len(a) != 2 {
+		return 0, nil, fmt.Errorf("%s requires 1 or 2 args", name)
+	}
+	if e := realizeAll(a[:1]); e != nil {
+		return 0, nil, e
+	}
+	width, rules := defaultWidth, h.IndentRules
+	if len(a) == 1 {
+		return width, rules, nil
+	}
+	opts, ok := a[1].(types.HashMap)
+	if !ok {
+		return 0, nil, fmt.Errorf("%s: expected an options map, got %s", name, printer.PrintStr(a[1], true))
+	}
+	key, _ := types.NewKeyword("width")
+	if w, ok := opts.Val.Get(key); ok {
+		n, e := toInt(w, name)
+		if e != nil {
+			return 0, nil, e
+		}
+		width = n
+	}
+	key, _ = types.NewKeyword("indent")
+	if v, ok := opts.Val.Get(key); ok {
+		indent, ok := v.(types.HashMap)
+		if !ok {
+			return 0, nil, fmt.Errorf("%s: :indent requires a map, got %s", name, printer.PrintStr(v, true))
+		}
+		base := rules
+		if base == nil {
+			base = printer.DefaultIndentRules()
+		}
+		rules = map[string]int{}
+		for k, n := range base {
+			rules[k] = n
+		}
+		var err error
+		indent.Val.Range(func(k, v types.ParrotType) bool {
+			n, e := toInt(v, name)
+			if e != nil {
+				err = e
+				return false
+			}
+			switch k := k.(type) {
+			case types.Symbol:
+				rules[k.Val] = n
+			case string:
+				rules[strings.TrimPrefix(k, "\u029e")] = n
+			default:
+				err = fmt.Errorf("%s: cannot use %s as an :indent key", name, printer.PrintStr(k, true))
+				return false
+			}
+			return true
+		})
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+	return width, rules, nil
+}
+
+func (h *Host) pprint_str(a []types.ParrotType) (types.ParrotType, error) {
+	width, rules, e := h.pprintArgs("pprint-str", a)
+	if e != nil {
+		return nil, e
+	}
+	return printer.Pretty(a[0], true, width, rules), nil
+}
+
+func (h *Host) pprint(a []types.ParrotType) (types.ParrotType, error) {
+	width, rules, e := h.pprintArgs("pprint", a)
+	if e != nil {
+		return nil, e
+	}
+	_, e = fmt.Fprintln(h.Stdout, printer.Pretty(a[0], true, width, rules))
+	return nil, e
+}
@@ -0,0 +1,181 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sllt/parrot/printer"
+	"github.com/sllt/parrot/types"
+)
+
+// Regular expressions. A regex is written #"pattern", in the syntax of
+// Go's regexp package. The functions that return a match return the
+// matched string when the regex has no groups, and a vector of the match
+// and its groups otherwise, with nil for the groups that did not take part
+// in the match.
+
+func toRegex(v types.ParrotType, name string) (types.Regex, error) {
+	switch re := v.(type) {
+	case types.Regex:
+		return re, nil
+	case string:
+		r, e := types.NewRegex(re)
+		if e != nil {
+			return types.Regex{}, fmt.Errorf("%s: %s", name, e)
+		}
+		return r, nil
+	}
+	return types.Regex{}, fmt.Errorf("%s: expected a regex, got %s", name, printer.PrintStr(v, true))
+}
+
+// regexArgs checks the args of a fn that takes a regex and a string.
+func regexArgs(name string, a []types.ParrotType) (types.Regex, string, error) {
+	if len(a) != 2 {
+		return types.Regex{}, "", fmt.Errorf("%s requires 2 args", name)
+	}
+	re, e := toRegex(a[0], name)
+	if e != nil {
+		return types.Regex{}, "", e
+	}
+	s, ok := a[1].(string)
+	if !ok {
+		return types.Regex{}, "", fmt.Errorf("%s: expected a string, got %s", name, printer.PrintStr(a[1], true))
+	}
+	return re, s, nil
+}
+
+// groups returns the match of s at loc, as returned by FindStringSubmatchIndex,
+// as a vector of the match and its groups.
+func groups(s string, loc []int) types.Vector {
+	items := make([]types.ParrotType, len(loc)/2)
+	for i := range items {
+		if loc[2*i] >= 0 {
+			items[i] = s[loc[2*i]:loc[2*i+1]]
+		}
+	}
+	return types.NewVector(items...)
+}
+
+// match returns the match of s at loc as a string, or as a vector of the
+// match and its groups if the regex has groups.
+func match(s string, loc []int) types.ParrotType {
+	if len(loc) == 2 {
+		return s[loc[0]:loc[1]]
+	}
+	return groups(s, loc)
+}
+
+func re_pattern(a []types.ParrotType) (types.ParrotType, error) {
+	return toRegex(a[0], "re-pattern")
+}
+
+func re_find(a []types.ParrotType) (types.ParrotType, error) {
+	re, s, e := regexArgs("re-find", a)
+	if e != nil {
+		return nil, e
+	}
+	loc := re.Val.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return nil, nil
+	}
+	return match(s, loc), nil
+}
+
+func re_matches(a []types.ParrotType) (types.ParrotType, error) {
+	re, s, e := regexArgs("re-matches", a)
+	if e != nil {
+		return nil, e
+	}
+	loc := re.Whole.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return nil, nil
+	}
+	return match(s, loc), nil
+}
+
+func re_seq(a []types.ParrotType) (types.ParrotType, error) {
+	re, s, e := regexArgs("re-seq", a)
+	if e != nil {
+		return nil, e
+	}
+	locs := re.Val.FindAllStringSubmatchIndex(s, -1)
+	if locs == nil {
+		return nil, nil
+	}
+	matches := make([]types.ParrotType, len(locs))
+	for i, loc := range locs {
+		matches[i] = match(s, loc)
+	}
+	return types.List{matches, nil}, nil
+}
+
+// re_groups returns the first match as a vector of the match and its
+// groups, even when the regex has no groups.
+func re_groups(a []types.ParrotType) (types.ParrotType, error) {
+	re, s, e := regexArgs("re-groups", a)
+	if e != nil {
+		return nil, e
+	}
+	loc := re.Val.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return nil, nil
+	}
+	return groups(s, loc), nil
+}
+
+// re_named_groups returns the named groups of the first match as a map
+// from keywords of their names to the strings they matched.
+func re_named_groups(a []types.ParrotType) (types.ParrotType, error) {
+	re, s, e := regexArgs("re-named-groups", a)
+	if e != nil {
+		return nil, e
+	}
+	loc := re.Val.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return nil, nil
+	}
+	m := types.PersistentMap{}.Transient()
+	for i, name := range re.Val.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		key, _ := types.NewKeyword(name)
+		var val types.ParrotType
+		if loc[2*i] >= 0 {
+			val = s[loc[2*i]:loc[2*i+1]]
+		}
+		m.Assoc(key, val)
+	}
+	return types.HashMap{m.Persistent(), nil}, nil
+}
+
+// re_replace replaces every match of a regex in a string. The replacement
+// is either a string, in which $1 and ${name} stand for groups, or a fn
+// that is called with each match, as re-find would return it, and returns
+// the string to put in its place.
+func re_replace(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) != 3 {
+		return nil, errors.New("re-replace requires 3 args")
+	}
+	re, s, e := regexArgs("re-replace", a[:2])
+	if e != nil {
+		return nil, e
+	}
+	if repl, ok := a[2].(string); ok {
+		return re.Val.ReplaceAllString(s, repl), nil
+	}
+	var b strings.Builder
+	last := 0
+	for _, loc := range re.Val.FindAllStringSubmatchIndex(s, -1) {
+		res, e := types.Apply(a[2], []types.ParrotType{match(s, loc)}, false)
+		if e != nil {
+			return nil, e
+		}
+		b.WriteString(s[last:loc[0]])
+		b.WriteString(printer.PrintStr(res, false))
+		last = loc[1]
+	}
+	b.WriteString(s[last:])
+	return b.String(), nil
+}
@@ -0,0 +1,82 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sllt/parrot/printer"
+	"github.com/sllt/parrot/types"
+)
+
+func TestRegexFns(t *testing.T) {
+	for _, c := range []struct {
+		fn   func([]types.ParrotType) (types.ParrotType, error)
+		args []types.ParrotType
+		want string
+	}{
+		{re_find, []types.ParrotType{`\d+`, "ab 12 cd 345"}, `"12"`},
+		{re_find, []types.ParrotType{`(\w)(\d)?`, "x"}, `["x" "x" nil]`},
+		{re_find, []types.ParrotType{`\d`, "none"}, `nil`},
+		{re_matches, []types.ParrotType{`\d+`, "12a"}, `nil`},
+		{re_matches, []types.ParrotType{`\d+|a`, "12"}, `"12"`},
+		{re_matches, []types.ParrotType{`(\d)(\d)`, "12"}, `["12" "1" "2"]`},
+		{re_seq, []types.ParrotType{`\d+`, "1 22 333"}, `("1" "22" "333")`},
+		{re_seq, []types.ParrotType{`(\w)=(\d)`, "a=1,b=2"}, `(["a=1" "a" "1"] ["b=2" "b" "2"])`},
+		{re_seq, []types.ParrotType{`\d`, "none"}, `nil`},
+		{re_groups, []types.ParrotType{`\d+`, "a1"}, `["1"]`},
+		{re_replace, []types.ParrotType{`(\w+)@(\w+)`, "me@host you@there", "$2:$1"}, `"host:me there:you"`},
+		{re_replace, []types.ParrotType{`(?P<n>\d)`, "a1b2", "<${n}>"}, `"a<1>b<2>"`},
+		{re_replace, []types.ParrotType{`\d`, "a1b2", types.Func{func(a []types.ParrotType) (types.ParrotType, error) {
+			return types.Int64{int64(len(a[0].(string)) * 10)}, nil
+		}, nil, false, nil}}, `"a10b10"`},
+	} {
+		got, e := c.fn(c.args)
+		if e != nil {
+			t.Errorf("%q: %v", c.args, e)
+			continue
+		}
+		if s := printer.PrintStr(got, true); s != c.want {
+			t.Errorf("%q: got %s, want %s", c.args, s, c.want)
+		}
+	}
+}
+
+func TestNamedGroups(t *testing.T) {
+	date := `(?P<year>\d{4})-(?P<month>\d\d)(-(?P<day>\d\d))?`
+	got, e := re_named_groups([]types.ParrotType{date, "on 2024-05"})
+	if e != nil {
+		t.Fatal(e)
+	}
+	m := got.(types.HashMap).Val
+	want := map[string]types.ParrotType{"ʞyear": "2024", "ʞmonth": "05", "ʞday": nil}
+	if m.Len() != len(want) {
+		t.Errorf("got %d groups, want %d", m.Len(), len(want))
+	}
+	for k, w := range want {
+		if v, ok := m.Get(k); !ok || v != w {
+			t.Errorf("%s: got %v, want %v", k, v, w)
+		}
+	}
+	if got, e := re_named_groups([]types.ParrotType{date, "never"}); got != nil || e != nil {
+		t.Errorf("got %v, %v without a match", got, e)
+	}
+}
+
+func TestRegexErrors(t *testing.T) {
+	for _, c := range []struct {
+		fn   func([]types.ParrotType) (types.ParrotType, error)
+		args []types.ParrotType
+		want string
+	}{
+		{re_find, []types.ParrotType{`(`, "x"}, "re-find: error parsing regexp"},
+		{re_find, []types.ParrotType{types.Int64{1}, "x"}, "re-find: expected a regex, got 1"},
+		{re_matches, []types.ParrotType{`x`, types.Int64{1}}, "re-matches: expected a string, got 1"},
+		{re_seq, []types.ParrotType{`x`}, "re-seq requires 2 args"},
+		{re_replace, []types.ParrotType{`x`, "x"}, "re-replace requires 3 args"},
+		{re_pattern, []types.ParrotType{`[`}, "re-pattern: error parsing regexp"},
+	} {
+		if _, e := c.fn(c.args); e == nil || !strings.Contains(e.Error(), c.want) {
+			t.Errorf("%q: got %v, want an error containing %q", c.args, e, c.want)
+		}
+	}
+}
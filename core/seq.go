@@ -0,0 +1,747 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sllt/parrot/printer"
+	"github.com/sllt/parrot/types"
+)
+
+// Sequences. Every function here accepts any seqable value, see
+// types.Uncons. The ones that return sequences are lazy: they return a
+// *types.LazySeq, and call the fns they were given only as its items are
+// needed, so they work on infinite sequences.
+
+func truthy(v types.ParrotType) bool {
+	return v != nil && v != false
+}
+
+func toInt(v types.ParrotType, name string) (int, error) {
+	switch n := v.(type) {
+	case types.Int64:
+		return int(n.Val), nil
+	case int:
+		return n, nil
+	case types.BigInt:
+		if n.Val.IsInt64() {
+			return int(n.Val.Int64()), nil
+		}
+	}
+	return 0, fmt.Errorf("%s: expected an integer, got %s", name, printer.PrintStr(v, true))
+}
+
+func lazySeqFn(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) != 1 {
+		return nil, errors.New("lazy-seq* requires 1 arg")
+	}
+	f := a[0]
+	return types.NewLazySeq(func() (types.ParrotType, error) {
+		return types.Apply(f, nil, false)
+	}), nil
+}
+
+func seq(a []types.ParrotType) (types.ParrotType, error) {
+	return types.Seq(a[0])
+}
+
+func first(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) == 0 {
+		return nil, nil
+	}
+	x, _, _, e := types.Uncons(a[0])
+	return x, e
+}
+
+func rest(a []types.ParrotType) (types.ParrotType, error) {
+	_, more, ok, e := types.Uncons(a[0])
+	if e != nil || !ok || more == nil {
+		return types.List{}, e
+	}
+	return more, nil
+}
+
+func next(a []types.ParrotType) (types.ParrotType, error) {
+	_, more, _, e := types.Uncons(a[0])
+	if e != nil {
+		return nil, e
+	}
+	return types.Seq(more)
+}
+
+// cons returns a list when coll is a list, a vector or nil, so that macros
+// can build forms with it, and a types.Cons otherwise.
+func cons(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) != 2 {
+		return nil, errors.New("cons requires 2 args")
+	}
+	switch coll := a[1].(type) {
+	case types.List, types.Vector, nil:
+		slc, _ := types.GetSlice(coll)
+		return types.List{append([]types.ParrotType{a[0]}, slc...), nil}, nil
+	case *types.LazySeq, types.Cons:
+		return types.Cons{a[0], coll}, nil
+	}
+	if _, e := types.Seq(a[1]); e != nil {
+		return nil, e
+	}
+	return types.Cons{a[0], a[1]}, nil
+}
+
+// concat returns a list when all its args are lists, vectors or nil, so
+// that quasiquote can splice forms with it, and a lazy seq otherwise.
+func concat(a []types.ParrotType) (types.ParrotType, error) {
+	slc := []types.ParrotType{}
+	for _, coll := range a {
+		switch coll.(type) {
+		case types.List, types.Vector, nil:
+			items, _ := types.GetSlice(coll)
+			slc = append(slc, items...)
+		default:
+			return lazyConcat(a), nil
+		}
+	}
+	return types.List{slc, nil}, nil
+}
+
+func lazyConcat(colls []types.ParrotType) *types.LazySeq {
+	return types.NewLazySeq(func() (types.ParrotType, error) {
+		for len(colls) > 0 {
+			x, more, ok, e := types.Uncons(colls[0])
+			if e != nil {
+				return nil, e
+			}
+			if ok {
+				tail := append([]types.ParrotType{more}, colls[1:]...)
+				return types.Cons{x, lazyConcat(tail)}, nil
+			}
+			colls = colls[1:]
+		}
+		return nil, nil
+	})
+}
+
+func empty_Q(a []types.ParrotType) (types.ParrotType, error) {
+	s, e := types.Seq(a[0])
+	if e != nil {
+		return nil, e
+	}
+	return s == nil, nil
+}
+
+func count(a []types.ParrotType) (types.ParrotType, error) {
+	switch obj := a[0].(type) {
+	case types.List:
+		return types.Int64{int64(len(obj.Val))}, nil
+	case types.Vector:
+		return types.Int64{int64(obj.Val.Len())}, nil
+	case types.HashMap:
+		return types.Int64{int64(obj.Val.Len())}, nil
+	case types.Set:
+		return types.Int64{int64(obj.Val.Len())}, nil
+	case *types.TransientVector:
+		return types.Int64{int64(obj.Len())}, nil
+	case *types.TransientMap:
+		return types.Int64{int64(obj.Len())}, nil
+	case string:
+		return types.Int64{int64(len([]rune(obj)))}, nil
+	case nil:
+		return types.Int64{0}, nil
+	case *types.LazySeq, types.Cons:
+		n := int64(0)
+		for coll := a[0]; ; n++ {
+			_, more, ok, e := types.Uncons(coll)
+			if e != nil {
+				return nil, e
+			}
+			if !ok {
+				return types.Int64{n}, nil
+			}
+			coll = more
+		}
+	default:
+		return nil, errors.New("count called on non-sequence")
+	}
+}
+
+func nth(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) != 2 && len(a) != 3 {
+		return nil, errors.New("nth requires 2 or 3 args")
+	}
+	idx, e := toInt(a[1], "nth")
+	if e != nil {
+		return nil, e
+	}
+	if idx >= 0 {
+		items, _, e := types.SplitSeq(a[0], idx+1)
+		if e != nil {
+			return nil, e
+		}
+		if idx < len(items) {
+			return items[idx], nil
+		}
+	}
+	if len(a) == 3 {
+		return a[2], nil
+	}
+	return nil, errors.New("nth: index out of range")
+}
+
+func do_map(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) < 2 {
+		return nil, errors.New("map requires at least 2 args")
+	}
+	return mapSeqs(a[0], a[1:]), nil
+}
+
+// mapSeqs calls f with an item of each of colls in turn, until one of them
+// runs out.
+func mapSeqs(f types.ParrotType, colls []types.ParrotType) *types.LazySeq {
+	return types.NewLazySeq(func() (types.ParrotType, error) {
+		args := make([]types.ParrotType, len(colls))
+		more := make([]types.ParrotType, len(colls))
+		for i, coll := range colls {
+			x, rest, ok, e := types.Uncons(coll)
+			if e != nil || !ok {
+				return nil, e
+			}
+			args[i], more[i] = x, rest
+		}
+		res, e := types.Apply(f, args, false)
+		if e != nil {
+			return nil, e
+		}
+		return types.Cons{res, mapSeqs(f, more)}, nil
+	})
+}
+
+func mapcat(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) < 2 {
+		return nil, errors.New("mapcat requires at least 2 args")
+	}
+	return flatten(mapSeqs(a[0], a[1:])), nil
+}
+
+// flatten returns the items of each of the colls in colls in turn.
+func flatten(colls types.ParrotType) *types.LazySeq {
+	return types.NewLazySeq(func() (types.ParrotType, error) {
+		for {
+			coll, more, ok, e := types.Uncons(colls)
+			if e != nil || !ok {
+				return nil, e
+			}
+			s, e := types.Seq(coll)
+			if e != nil {
+				return nil, e
+			}
+			if s != nil {
+				return lazyConcat([]types.ParrotType{s, flatten(more)}), nil
+			}
+			colls = more
+		}
+	})
+}
+
+func filterSeq(pred, coll types.ParrotType, keep bool) *types.LazySeq {
+	return types.NewLazySeq(func() (types.ParrotType, error) {
+		for {
+			x, more, ok, e := types.Uncons(coll)
+			if e != nil || !ok {
+				return nil, e
+			}
+			res, e := types.Apply(pred, []types.ParrotType{x}, false)
+			if e != nil {
+				return nil, e
+			}
+			if truthy(res) == keep {
+				return types.Cons{x, filterSeq(pred, more, keep)}, nil
+			}
+			coll = more
+		}
+	})
+}
+
+func filter(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) != 2 {
+		return nil, errors.New("filter requires 2 args")
+	}
+	return filterSeq(a[0], a[1], true), nil
+}
+
+func remove(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) != 2 {
+		return nil, errors.New("remove requires 2 args")
+	}
+	return filterSeq(a[0], a[1], false), nil
+}
+
+func reduce(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) != 2 && len(a) != 3 {
+		return nil, errors.New("reduce requires 2 or 3 args")
+	}
+	f, coll := a[0], a[len(a)-1]
+	var acc types.ParrotType
+	if len(a) == 3 {
+		acc = a[1]
+	} else {
+		x, more, ok, e := types.Uncons(coll)
+		if e != nil {
+			return nil, e
+		}
+		if !ok {
+			return types.Apply(f, nil, false)
+		}
+		acc, coll = x, more
+	}
+	for {
+		x, more, ok, e := types.Uncons(coll)
+		if e != nil {
+			return nil, e
+		}
+		if !ok {
+			return acc, nil
+		}
+		if acc, e = types.Apply(f, []types.ParrotType{acc, x}, false); e != nil {
+			return nil, e
+		}
+		coll = more
+	}
+}
+
+func rangeSeq(start, end, step types.ParrotType) *types.LazySeq {
+	return types.NewLazySeq(func() (types.ParrotType, error) {
+		if end != nil {
+			c, e := Compare(start, end)
+			if e != nil {
+				return nil, e
+			}
+			down, e := Compare(step, types.Int64{0})
+			if e != nil {
+				return nil, e
+			}
+			if (down >= 0 && c >= 0) || (down < 0 && c <= 0) {
+				return nil, nil
+			}
+		}
+		next, e := NumericDo(Add, start, step)
+		if e != nil {
+			return nil, e
+		}
+		return types.Cons{start, rangeSeq(next, end, step)}, nil
+	})
+}
+
+func do_range(a []types.ParrotType) (types.ParrotType, error) {
+	for _, n := range a {
+		if _, e := Compare(n, types.Int64{0}); e != nil {
+			return nil, errors.New("range requires numeric args")
+		}
+	}
+	switch len(a) {
+	case 0:
+		return rangeSeq(types.Int64{0}, nil, types.Int64{1}), nil
+	case 1:
+		return rangeSeq(types.Int64{0}, a[0], types.Int64{1}), nil
+	case 2:
+		return rangeSeq(a[0], a[1], types.Int64{1}), nil
+	case 3:
+		return rangeSeq(a[0], a[1], a[2]), nil
+	}
+	return nil, errors.New("range requires at most 3 args")
+}
+
+func takeSeq(n int, coll types.ParrotType) *types.LazySeq {
+	return types.NewLazySeq(func() (types.ParrotType, error) {
+		if n <= 0 {
+			return nil, nil
+		}
+		x, more, ok, e := types.Uncons(coll)
+		if e != nil || !ok {
+			return nil, e
+		}
+		return types.Cons{x, takeSeq(n-1, more)}, nil
+	})
+}
+
+func take(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) != 2 {
+		return nil, errors.New("take requires 2 args")
+	}
+	n, e := toInt(a[0], "take")
+	if e != nil {
+		return nil, e
+	}
+	return takeSeq(n, a[1]), nil
+}
+
+func drop(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) != 2 {
+		return nil, errors.New("drop requires 2 args")
+	}
+	n, e := toInt(a[0], "drop")
+	if e != nil {
+		return nil, e
+	}
+	coll := a[1]
+	return types.NewLazySeq(func() (types.ParrotType, error) {
+		_, more, e := types.SplitSeq(coll, n)
+		return more, e
+	}), nil
+}
+
+func takeWhileSeq(pred, coll types.ParrotType) *types.LazySeq {
+	return types.NewLazySeq(func() (types.ParrotType, error) {
+		x, more, ok, e := types.Uncons(coll)
+		if e != nil || !ok {
+			return nil, e
+		}
+		res, e := types.Apply(pred, []types.ParrotType{x}, false)
+		if e != nil || !truthy(res) {
+			return nil, e
+		}
+		return types.Cons{x, takeWhileSeq(pred, more)}, nil
+	})
+}
+
+func takeWhile(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) != 2 {
+		return nil, errors.New("take-while requires 2 args")
+	}
+	return takeWhileSeq(a[0], a[1]), nil
+}
+
+func dropWhile(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) != 2 {
+		return nil, errors.New("drop-while requires 2 args")
+	}
+	pred, coll := a[0], a[1]
+	return types.NewLazySeq(func() (types.ParrotType, error) {
+		for {
+			x, more, ok, e := types.Uncons(coll)
+			if e != nil || !ok {
+				return nil, e
+			}
+			res, e := types.Apply(pred, []types.ParrotType{x}, false)
+			if e != nil {
+				return nil, e
+			}
+			if !truthy(res) {
+				return types.Cons{x, more}, nil
+			}
+			coll = more
+		}
+	}), nil
+}
+
+func partitionSeq(n, step int, pad, coll types.ParrotType) *types.LazySeq {
+	return types.NewLazySeq(func() (types.ParrotType, error) {
+		items, _, e := types.SplitSeq(coll, n)
+		if e != nil || len(items) == 0 {
+			return nil, e
+		}
+		if len(items) < n {
+			if pad == nil {
+				return nil, nil
+			}
+			fill, _, e := types.SplitSeq(pad, n-len(items))
+			if e != nil {
+				return nil, e
+			}
+			items = append(items, fill...)
+			return types.List{[]types.ParrotType{types.List{items, nil}}, nil}, nil
+		}
+		_, more, e := types.SplitSeq(coll, step)
+		if e != nil {
+			return nil, e
+		}
+		return types.Cons{types.List{items, nil}, partitionSeq(n, step, pad, more)}, nil
+	})
+}
+
+// partition returns lists of n items, starting step items apart. A last
+// list that is short is dropped, unless pad is given to fill it up.
+func partition(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) < 2 || len(a) > 4 {
+		return nil, errors.New("partition requires 2 to 4 args")
+	}
+	n, e := toInt(a[0], "partition")
+	if e != nil {
+		return nil, e
+	}
+	step := n
+	if len(a) > 2 {
+		if step, e = toInt(a[1], "partition"); e != nil {
+			return nil, e
+		}
+	}
+	if n <= 0 || step <= 0 {
+		return nil, errors.New("partition requires a positive size and step")
+	}
+	var pad types.ParrotType
+	if len(a) == 4 {
+		pad = a[2]
+	}
+	return partitionSeq(n, step, pad, a[len(a)-1]), nil
+}
+
+func interleaveSeq(colls []types.ParrotType) *types.LazySeq {
+	return types.NewLazySeq(func() (types.ParrotType, error) {
+		items := make([]types.ParrotType, len(colls))
+		more := make([]types.ParrotType, len(colls))
+		for i, coll := range colls {
+			x, rest, ok, e := types.Uncons(coll)
+			if e != nil || !ok {
+				return nil, e
+			}
+			items[i], more[i] = x, rest
+		}
+		return lazyConcat([]types.ParrotType{types.List{items, nil}, interleaveSeq(more)}), nil
+	})
+}
+
+func interleave(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) == 0 {
+		return types.List{}, nil
+	}
+	return interleaveSeq(a), nil
+}
+
+func iterateSeq(f, x types.ParrotType) *types.LazySeq {
+	return types.NewLazySeq(func() (types.ParrotType, error) {
+		return types.Cons{x, types.NewLazySeq(func() (types.ParrotType, error) {
+			next, e := types.Apply(f, []types.ParrotType{x}, false)
+			if e != nil {
+				return nil, e
+			}
+			return iterateSeq(f, next), nil
+		})}, nil
+	})
+}
+
+func iterate(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) != 2 {
+		return nil, errors.New("iterate requires 2 args")
+	}
+	return iterateSeq(a[0], a[1]), nil
+}
+
+func repeatSeq(x types.ParrotType) *types.LazySeq {
+	var s *types.LazySeq
+	s = types.NewLazySeq(func() (types.ParrotType, error) {
+		return types.Cons{x, s}, nil
+	})
+	return s
+}
+
+func repeat(a []types.ParrotType) (types.ParrotType, error) {
+	switch len(a) {
+	case 1:
+		return repeatSeq(a[0]), nil
+	case 2:
+		n, e := toInt(a[0], "repeat")
+		if e != nil {
+			return nil, e
+		}
+		return takeSeq(n, repeatSeq(a[1])), nil
+	}
+	return nil, errors.New("repeat requires 1 or 2 args")
+}
+
+func cycle(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) != 1 {
+		return nil, errors.New("cycle requires 1 arg")
+	}
+	coll := a[0]
+	var s *types.LazySeq
+	s = types.NewLazySeq(func() (types.ParrotType, error) {
+		first, e := types.Seq(coll)
+		if e != nil || first == nil {
+			return nil, e
+		}
+		return lazyConcat([]types.ParrotType{first, s}), nil
+	})
+	return s, nil
+}
+
+func doall(a []types.ParrotType) (types.ParrotType, error) {
+	if _, e := types.ToSlice(a[0]); e != nil {
+		return nil, e
+	}
+	return a[0], nil
+}
+
+func dorun(a []types.ParrotType) (types.ParrotType, error) {
+	for coll := a[0]; ; {
+		_, more, ok, e := types.Uncons(coll)
+		if e != nil || !ok {
+			return nil, e
+		}
+		coll = more
+	}
+}
+
+func vec(a []types.ParrotType) (types.ParrotType, error) {
+	slc, e := types.ToSlice(a[0])
+	if e != nil {
+		return nil, e
+	}
+	return types.NewVector(slc...), nil
+}
+
+func into(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) != 2 {
+		return nil, errors.New("into requires 2 args")
+	}
+	items, e := types.ToSlice(a[1])
+	if e != nil {
+		return nil, e
+	}
+	if len(items) == 0 {
+		return a[0], nil
+	}
+	if a[0] == nil {
+		return conj(append([]types.ParrotType{types.List{}}, items...))
+	}
+	return conj(append([]types.ParrotType{a[0]}, items...))
+}
+
+func some(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) != 2 {
+		return nil, errors.New("some requires 2 args")
+	}
+	for coll := a[1]; ; {
+		x, more, ok, e := types.Uncons(coll)
+		if e != nil || !ok {
+			return nil, e
+		}
+		res, e := types.Apply(a[0], []types.ParrotType{x}, false)
+		if e != nil || truthy(res) {
+			return res, e
+		}
+		coll = more
+	}
+}
+
+func every_Q(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) != 2 {
+		return nil, errors.New("every? requires 2 args")
+	}
+	for coll := a[1]; ; {
+		x, more, ok, e := types.Uncons(coll)
+		if e != nil {
+			return nil, e
+		}
+		if !ok {
+			return true, nil
+		}
+		res, e := types.Apply(a[0], []types.ParrotType{x}, false)
+		if e != nil {
+			return nil, e
+		}
+		if !truthy(res) {
+			return false, nil
+		}
+		coll = more
+	}
+}
+
+func last(a []types.ParrotType) (types.ParrotType, error) {
+	slc, e := types.ToSlice(a[0])
+	if e != nil || len(slc) == 0 {
+		return nil, e
+	}
+	return slc[len(slc)-1], nil
+}
+
+func reverse(a []types.ParrotType) (types.ParrotType, error) {
+	slc, e := types.ToSlice(a[0])
+	if e != nil {
+		return nil, e
+	}
+	res := make([]types.ParrotType, len(slc))
+	for i, x := range slc {
+		res[len(slc)-1-i] = x
+	}
+	return types.List{res, nil}, nil
+}
+
+// expandFor expands (for bindings body) into nested mapcats, one for each
+// binding. :let, :when and :while modifiers apply to the binding before
+// them.
+func expandFor(bindings []types.ParrotType, body types.ParrotType) (types.ParrotType, error) {
+	if len(bindings) == 0 {
+		return list(types.Symbol{"list"}, body), nil
+	}
+	if len(bindings) < 2 {
+		return nil, errors.New("for requires an even number of forms in its bindings")
+	}
+	pattern, coll := bindings[0], bindings[1]
+	i := 2
+	type modifier struct {
+		kind string
+		form types.ParrotType
+	}
+	mods := []modifier{}
+	for i+1 < len(bindings) && types.Keyword_Q(bindings[i]) {
+		kind := bindings[i].(string)[len("ʞ"):]
+		if kind != "let" && kind != "when" && kind != "while" {
+			return nil, fmt.Errorf("for: unknown modifier :%s", kind)
+		}
+		mods = append(mods, modifier{kind, bindings[i+1]})
+		i += 2
+	}
+	inner, e := expandFor(bindings[i:], body)
+	if e != nil {
+		return nil, e
+	}
+	// guard wraps form in the modifiers before the one at end, which is
+	// how a :while sees the names bound by the :let forms before it.
+	guard := func(end int, form, otherwise types.ParrotType) types.ParrotType {
+		for j := end - 1; j >= 0; j-- {
+			switch mods[j].kind {
+			case "let":
+				form = list(types.Symbol{"let"}, mods[j].form, form)
+			case "when":
+				form = list(types.Symbol{"if"}, mods[j].form, form, otherwise)
+			}
+		}
+		return form
+	}
+	whiles := []types.ParrotType{}
+	for j, m := range mods {
+		if m.kind == "while" {
+			whiles = append(whiles, guard(j, m.form, true))
+		}
+	}
+	if len(whiles) > 0 {
+		test := andForm(whiles)
+		pred := list(types.Symbol{"fn"}, types.NewVector(pattern), test)
+		coll = list(types.Symbol{"take-while"}, pred, coll)
+	}
+	fn := list(types.Symbol{"fn"}, types.NewVector(pattern),
+		guard(len(mods), inner, types.List{}))
+	return list(types.Symbol{"mapcat"}, fn, coll), nil
+}
+
+// andForm returns a form that is true when all of forms are.
+func andForm(forms []types.ParrotType) types.ParrotType {
+	if len(forms) == 1 {
+		return forms[0]
+	}
+	return list(types.Symbol{"if"}, forms[0], andForm(forms[1:]), false)
+}
+
+func list(items ...types.ParrotType) types.List {
+	return types.List{items, nil}
+}
+
+func for_STAR(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) != 2 {
+		return nil, errors.New("for requires a binding vector and a body")
+	}
+	bindings, ok := a[0].(types.Vector)
+	if !ok {
+		return nil, errors.New("for requires a vector of bindings")
+	}
+	return expandFor(bindings.Val.Slice(), a[1])
+}
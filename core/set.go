@@ -0,0 +1,157 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sllt/parrot/printer"
+	"github.com/sllt/parrot/types"
+)
+
+// Sets. A set is written #{a b c}, holds each value at most once, and is
+// itself a fn that returns its argument if the set holds it, and nil
+// otherwise: (filter #{:a :b} xs).
+
+func toSet(v types.ParrotType, name string) (types.Set, error) {
+	switch s := v.(type) {
+	case types.Set:
+		return s, nil
+	case nil:
+		return types.Set{}, nil
+	}
+	return types.Set{}, fmt.Errorf("%s: expected a set, got %s", name, printer.PrintStr(v, true))
+}
+
+func set(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) != 1 {
+		return nil, errors.New("set requires 1 arg")
+	}
+	if s, ok := a[0].(types.Set); ok {
+		return types.Set{s.Val, nil}, nil
+	}
+	items, e := types.ToSlice(a[0])
+	if e != nil {
+		return nil, e
+	}
+	return types.NewSet(items...), nil
+}
+
+func disj(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) < 1 {
+		return nil, errors.New("disj requires at least 1 arg")
+	}
+	if a[0] == nil {
+		return nil, nil
+	}
+	s, e := toSet(a[0], "disj")
+	if e != nil {
+		return nil, e
+	}
+	for _, x := range a[1:] {
+		s = s.Disj(x)
+	}
+	return s, nil
+}
+
+func union(a []types.ParrotType) (types.ParrotType, error) {
+	res := types.Set{}
+	for i, x := range a {
+		s, e := toSet(x, "union")
+		if e != nil {
+			return nil, e
+		}
+		if i == 0 || s.Val.Len() > res.Val.Len() {
+			res, s = s, res
+		}
+		t := res.Val.Transient()
+		s.Val.Range(func(k, _ types.ParrotType) bool {
+			t.Assoc(k, k)
+			return true
+		})
+		res = types.Set{t.Persistent(), res.Meta}
+	}
+	return res, nil
+}
+
+func intersection(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) < 1 {
+		return nil, errors.New("intersection requires at least 1 arg")
+	}
+	res, e := toSet(a[0], "intersection")
+	if e != nil {
+		return nil, e
+	}
+	for _, x := range a[1:] {
+		s, e := toSet(x, "intersection")
+		if e != nil {
+			return nil, e
+		}
+		t := res.Val.Transient()
+		res.Val.Range(func(k, _ types.ParrotType) bool {
+			if !s.Has(k) {
+				t.Dissoc(k)
+			}
+			return true
+		})
+		res = types.Set{t.Persistent(), res.Meta}
+	}
+	return res, nil
+}
+
+func difference(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) < 1 {
+		return nil, errors.New("difference requires at least 1 arg")
+	}
+	res, e := toSet(a[0], "difference")
+	if e != nil {
+		return nil, e
+	}
+	for _, x := range a[1:] {
+		s, e := toSet(x, "difference")
+		if e != nil {
+			return nil, e
+		}
+		t := res.Val.Transient()
+		s.Val.Range(func(k, _ types.ParrotType) bool {
+			t.Dissoc(k)
+			return true
+		})
+		res = types.Set{t.Persistent(), res.Meta}
+	}
+	return res, nil
+}
+
+// subset reports whether every item of s is in t.
+func subset(s, t types.Set) bool {
+	if s.Val.Len() > t.Val.Len() {
+		return false
+	}
+	ok := true
+	s.Val.Range(func(k, _ types.ParrotType) bool {
+		ok = t.Has(k)
+		return ok
+	})
+	return ok
+}
+
+func subset_Q(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) != 2 {
+		return nil, errors.New("subset? requires 2 args")
+	}
+	s, e := toSet(a[0], "subset?")
+	if e != nil {
+		return nil, e
+	}
+	t, e := toSet(a[1], "subset?")
+	if e != nil {
+		return nil, e
+	}
+	return subset(s, t), nil
+}
+
+func superset_Q(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) != 2 {
+		return nil, errors.New("superset? requires 2 args")
+	}
+	return subset_Q([]types.ParrotType{a[1], a[0]})
+}
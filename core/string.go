@@ -0,0 +1,386 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sllt/parrot/printer"
+	"github.com/sllt/parrot/types"
+)
+
+// Strings. StringNS holds the builtins of the parrot.string namespace:
+//
+//	(require '[parrot.string :as s])
+//	(s/join ", " (s/split-lines text))
+//
+// Indices and lengths count chars, not bytes.
+
+func toStr(v types.ParrotType, name string) (string, error) {
+	switch s := v.(type) {
+	case string:
+		if !types.Keyword_Q(s) {
+			return s, nil
+		}
+	case types.Char:
+		return string(s.Val), nil
+	}
+	return "", fmt.Errorf("%s: expected a string, got %s", name, printer.PrintStr(v, true))
+}
+
+// stringArgs checks that a holds n strings or chars.
+func stringArgs(name string, a []types.ParrotType, n int) ([]string, error) {
+	if len(a) != n {
+		return nil, fmt.Errorf("%s requires %d args", name, n)
+	}
+	strs := make([]string, n)
+	for i, v := range a {
+		s, e := toStr(v, name)
+		if e != nil {
+			return nil, e
+		}
+		strs[i] = s
+	}
+	return strs, nil
+}
+
+// stringFn makes a builtin of a fn from one string to another.
+func stringFn(name string, f func(string) string) func([]types.ParrotType) (types.ParrotType, error) {
+	return func(a []types.ParrotType) (types.ParrotType, error) {
+		s, e := stringArgs(name, a, 1)
+		if e != nil {
+			return nil, e
+		}
+		return f(s[0]), nil
+	}
+}
+
+// stringPred makes a builtin of a test of a string against another.
+func stringPred(name string, f func(string, string) bool) func([]types.ParrotType) (types.ParrotType, error) {
+	return func(a []types.ParrotType) (types.ParrotType, error) {
+		s, e := stringArgs(name, a, 2)
+		if e != nil {
+			return nil, e
+		}
+		return f(s[0], s[1]), nil
+	}
+}
+
+// runeIndex converts the byte offset i of s to an offset in chars.
+func runeIndex(s string, i int) types.ParrotType {
+	if i < 0 {
+		return nil
+	}
+	return types.Int64{int64(utf8.RuneCountInString(s[:i]))}
+}
+
+// byteIndex converts the offset i in chars of s to a byte offset, or
+// returns -1 if s has fewer than i chars.
+func byteIndex(s string, i int) int {
+	n := 0
+	for b := range s {
+		if n == i {
+			return b
+		}
+		n++
+	}
+	if n == i {
+		return len(s)
+	}
+	return -1
+}
+
+func join(a []types.ParrotType) (types.ParrotType, error) {
+	sep, coll := "", types.ParrotType(nil)
+	switch len(a) {
+	case 1:
+		coll = a[0]
+	case 2:
+		s, e := toStr(a[0], "join")
+		if e != nil {
+			return nil, e
+		}
+		sep, coll = s, a[1]
+	default:
+		return nil, errors.New("join requires 1 or 2 args")
+	}
+	items, e := types.ToSlice(coll)
+	if e != nil {
+		return nil, e
+	}
+	if e := realizeAll(items); e != nil {
+		return nil, e
+	}
+	strs := make([]string, len(items))
+	for i, x := range items {
+		strs[i] = printer.PrintStr(x, false)
+	}
+	return strings.Join(strs, sep), nil
+}
+
+func capitalize(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	if n == 0 {
+		return s
+	}
+	return string(unicode.ToUpper(r)) + strings.ToLower(s[n:])
+}
+
+func indexOf(name string, last bool) func([]types.ParrotType) (types.ParrotType, error) {
+	return func(a []types.ParrotType) (types.ParrotType, error) {
+		if len(a) != 2 && len(a) != 3 {
+			return nil, fmt.Errorf("%s requires 2 or 3 args", name)
+		}
+		strs, e := stringArgs(name, a[:2], 2)
+		if e != nil {
+			return nil, e
+		}
+		s, x := strs[0], strs[1]
+		if len(a) == 2 {
+			if last {
+				return runeIndex(s, strings.LastIndex(s, x)), nil
+			}
+			return runeIndex(s, strings.Index(s, x)), nil
+		}
+		from, e := toInt(a[2], name)
+		if e != nil {
+			return nil, e
+		}
+		n := utf8.RuneCountInString(s)
+		if from < 0 {
+			from = 0
+		} else if from > n {
+			from = n
+		}
+		b := byteIndex(s, from)
+		if last {
+			// the match may start at from, and run past it
+			end := byteIndex(s, from+utf8.RuneCountInString(x))
+			if end < 0 {
+				end = len(s)
+			}
+			return runeIndex(s, strings.LastIndex(s[:end], x)), nil
+		}
+		i := strings.Index(s[b:], x)
+		if i < 0 {
+			return nil, nil
+		}
+		return runeIndex(s, b+i), nil
+	}
+}
+
+// do_replace replaces match in s, where match is a string, a char or a
+// regex. With a regex, the replacement may be a fn, as in re-replace.
+func do_replace(name string, first bool) func([]types.ParrotType) (types.ParrotType, error) {
+	return func(a []types.ParrotType) (types.ParrotType, error) {
+		if len(a) != 3 {
+			return nil, fmt.Errorf("%s requires 3 args", name)
+		}
+		s, e := toStr(a[0], name)
+		if e != nil {
+			return nil, e
+		}
+		if re, ok := a[1].(types.Regex); ok {
+			if !first {
+				return re_replace([]types.ParrotType{re, s, a[2]})
+			}
+			loc := re.Val.FindStringSubmatchIndex(s)
+			if loc == nil {
+				return s, nil
+			}
+			// replace the first match only, by replacing it in a string
+			// that ends after it
+			res, e := re_replace([]types.ParrotType{re, s[:loc[1]], a[2]})
+			if e != nil {
+				return nil, e
+			}
+			return res.(string) + s[loc[1]:], nil
+		}
+		strs, e := stringArgs(name, a[1:], 2)
+		if e != nil {
+			return nil, e
+		}
+		n := -1
+		if first {
+			n = 1
+		}
+		return strings.Replace(s, strs[0], strs[1], n), nil
+	}
+}
+
+func substring(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) != 2 && len(a) != 3 {
+		return nil, errors.New("substring requires 2 or 3 args")
+	}
+	s, e := toStr(a[0], "substring")
+	if e != nil {
+		return nil, e
+	}
+	start, e := toInt(a[1], "substring")
+	if e != nil {
+		return nil, e
+	}
+	n := utf8.RuneCountInString(s)
+	end := n
+	if len(a) == 3 {
+		if end, e = toInt(a[2], "substring"); e != nil {
+			return nil, e
+		}
+	}
+	if start < 0 || end > n || start > end {
+		return nil, fmt.Errorf("substring: indices %d and %d out of range for a string of %d chars", start, end, n)
+	}
+	return s[byteIndex(s, start):byteIndex(s, end)], nil
+}
+
+// pad pads a string on the left or the right with a char, by default a
+// space, to a width in chars.
+func pad(name string, left bool) func([]types.ParrotType) (types.ParrotType, error) {
+	return func(a []types.ParrotType) (types.ParrotType, error) {
+		if len(a) != 2 && len(a) != 3 {
+			return nil, fmt.Errorf("%s requires 2 or 3 args", name)
+		}
+		s, e := toStr(a[0], name)
+		if e != nil {
+			return nil, e
+		}
+		width, e := toInt(a[1], name)
+		if e != nil {
+			return nil, e
+		}
+		fill := " "
+		if len(a) == 3 {
+			if fill, e = toStr(a[2], name); e != nil {
+				return nil, e
+			}
+			if fill == "" {
+				return nil, fmt.Errorf("%s: empty padding", name)
+			}
+		}
+		n := width - utf8.RuneCountInString(s)
+		if n <= 0 {
+			return s, nil
+		}
+		padding := strings.Repeat(fill, n/utf8.RuneCountInString(fill)+1)
+		padding = padding[:byteIndex(padding, n)]
+		if left {
+			return padding + s, nil
+		}
+		return s + padding, nil
+	}
+}
+
+func repeatString(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) != 2 {
+		return nil, errors.New("repeat requires 2 args")
+	}
+	s, e := toStr(a[0], "repeat")
+	if e != nil {
+		return nil, e
+	}
+	n, e := toInt(a[1], "repeat")
+	if e != nil {
+		return nil, e
+	}
+	if n < 0 {
+		return nil, errors.New("repeat: negative count")
+	}
+	return strings.Repeat(s, n), nil
+}
+
+func blank_Q(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) != 1 {
+		return nil, errors.New("blank? requires 1 arg")
+	}
+	if a[0] == nil {
+		return true, nil
+	}
+	s, e := toStr(a[0], "blank?")
+	if e != nil {
+		return nil, e
+	}
+	return strings.TrimSpace(s) == "", nil
+}
+
+func stringList(strs []string) types.Vector {
+	items := make([]types.ParrotType, len(strs))
+	for i, s := range strs {
+		items[i] = s
+	}
+	return types.NewVector(items...)
+}
+
+// split splits a string at every match of a string or regex separator, and
+// returns a vector of the parts.
+func split(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) != 2 {
+		return nil, errors.New("split requires 2 args")
+	}
+	s, e := toStr(a[0], "split")
+	if e != nil {
+		return nil, e
+	}
+	if re, ok := a[1].(types.Regex); ok {
+		return stringList(re.Val.Split(s, -1)), nil
+	}
+	sep, e := toStr(a[1], "split")
+	if e != nil {
+		return nil, e
+	}
+	return stringList(strings.Split(s, sep)), nil
+}
+
+func split_lines(a []types.ParrotType) (types.ParrotType, error) {
+	strs, e := stringArgs("split-lines", a, 1)
+	if e != nil {
+		return nil, e
+	}
+	lines := strings.Split(strs[0], "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return stringList(lines), nil
+}
+
+func reverseString(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+var StringNS = map[string]types.ParrotType{
+	"join":          join,
+	"trim":          stringFn("trim", strings.TrimSpace),
+	"triml":         stringFn("triml", func(s string) string { return strings.TrimLeftFunc(s, unicode.IsSpace) }),
+	"trimr":         stringFn("trimr", func(s string) string { return strings.TrimRightFunc(s, unicode.IsSpace) }),
+	"trim-newline":  stringFn("trim-newline", func(s string) string { return strings.TrimRight(s, "\r\n") }),
+	"upper-case":    stringFn("upper-case", strings.ToUpper),
+	"lower-case":    stringFn("lower-case", strings.ToLower),
+	"capitalize":    stringFn("capitalize", capitalize),
+	"reverse":       stringFn("reverse", reverseString),
+	"starts-with?":  stringPred("starts-with?", strings.HasPrefix),
+	"ends-with?":    stringPred("ends-with?", strings.HasSuffix),
+	"includes?":     stringPred("includes?", strings.Contains),
+	"index-of":      indexOf("index-of", false),
+	"last-index-of": indexOf("last-index-of", true),
+	"replace":       do_replace("replace", false),
+	"replace-first": do_replace("replace-first", true),
+	"substring":     substring,
+	"pad-left":      pad("pad-left", true),
+	"pad-right":     pad("pad-right", false),
+	"repeat":        repeatString,
+	"blank?":        blank_Q,
+	"split":         split,
+	"split-lines":   split_lines,
+	"count": func(a []types.ParrotType) (types.ParrotType, error) {
+		s, e := stringArgs("count", a, 1)
+		if e != nil {
+			return nil, e
+		}
+		return types.Int64{int64(utf8.RuneCountInString(s[0]))}, nil
+	},
+}
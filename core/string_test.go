@@ -0,0 +1,104 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sllt/parrot/printer"
+	"github.com/sllt/parrot/types"
+)
+
+// callString calls the builtin name of the parrot.string namespace.
+func callString(name string, args ...types.ParrotType) (types.ParrotType, error) {
+	return StringNS[name].(func([]types.ParrotType) (types.ParrotType, error))(args)
+}
+
+func TestStringFns(t *testing.T) {
+	n := func(i int64) types.ParrotType { return types.Int64{i} }
+	for _, c := range []struct {
+		name string
+		args []types.ParrotType
+		want string
+	}{
+		{"join", []types.ParrotType{", ", types.NewVector("a", n(1), types.Char{'c'}, nil)}, `"a, 1, c, nil"`},
+		{"join", []types.ParrotType{types.NewVector("a", "b")}, `"ab"`},
+		{"join", []types.ParrotType{"-", "héé"}, `"h-é-é"`},
+		{"trim", []types.ParrotType{" \t a b \n"}, `"a b"`},
+		{"triml", []types.ParrotType{"  a  "}, `"a  "`},
+		{"trimr", []types.ParrotType{"  a  "}, `"  a"`},
+		{"trim-newline", []types.ParrotType{"a \r\n\n"}, `"a "`},
+		{"upper-case", []types.ParrotType{"héllo"}, `"HÉLLO"`},
+		{"lower-case", []types.ParrotType{"ÉCOLE"}, `"école"`},
+		{"capitalize", []types.ParrotType{"éCOLE"}, `"École"`},
+		{"capitalize", []types.ParrotType{""}, `""`},
+		{"reverse", []types.ParrotType{"héllo"}, `"olléh"`},
+		{"starts-with?", []types.ParrotType{"parrot", "par"}, `true`},
+		{"ends-with?", []types.ParrotType{"parrot", types.Char{'t'}}, `true`},
+		{"includes?", []types.ParrotType{"parrot", "xyz"}, `false`},
+		{"index-of", []types.ParrotType{"héllo", "l"}, `2`},
+		{"index-of", []types.ParrotType{"héllo", "l", n(3)}, `3`},
+		{"index-of", []types.ParrotType{"héllo", "z"}, `nil`},
+		{"last-index-of", []types.ParrotType{"héllo", "l"}, `3`},
+		{"last-index-of", []types.ParrotType{"abab", "ab", n(1)}, `0`},
+		{"last-index-of", []types.ParrotType{"abab", "ab", n(2)}, `2`},
+		{"replace", []types.ParrotType{"a.b.c", ".", "/"}, `"a/b/c"`},
+		{"replace-first", []types.ParrotType{"a.b.c", ".", "/"}, `"a/b.c"`},
+		{"replace", []types.ParrotType{"a1b22", mustRegex(t, `\d+`), "#"}, `"a#b#"`},
+		{"replace-first", []types.ParrotType{"a1b22", mustRegex(t, `(\d+)`), "<$1>"}, `"a<1>b22"`},
+		{"substring", []types.ParrotType{"héllo", n(1), n(3)}, `"él"`},
+		{"substring", []types.ParrotType{"héllo", n(2)}, `"llo"`},
+		{"substring", []types.ParrotType{"héllo", n(5)}, `""`},
+		{"pad-left", []types.ParrotType{"7", n(3), types.Char{'0'}}, `"007"`},
+		{"pad-right", []types.ParrotType{"é", n(3)}, `"é  "`},
+		{"pad-left", []types.ParrotType{"abc", n(2)}, `"abc"`},
+		{"pad-left", []types.ParrotType{"x", n(6), "ab"}, `"ababax"`},
+		{"repeat", []types.ParrotType{"ab", n(3)}, `"ababab"`},
+		{"repeat", []types.ParrotType{"ab", n(0)}, `""`},
+		{"blank?", []types.ParrotType{" \t\n"}, `true`},
+		{"blank?", []types.ParrotType{nil}, `true`},
+		{"blank?", []types.ParrotType{" a "}, `false`},
+		{"split", []types.ParrotType{"a,b,,c", ","}, `["a" "b" "" "c"]`},
+		{"split", []types.ParrotType{"a1b22c", mustRegex(t, `\d+`)}, `["a" "b" "c"]`},
+		{"split-lines", []types.ParrotType{"one\r\ntwo\nthree"}, `["one" "two" "three"]`},
+		{"count", []types.ParrotType{"héllo"}, `5`},
+	} {
+		got, e := callString(c.name, c.args...)
+		if e != nil {
+			t.Errorf("%s %q: %v", c.name, c.args, e)
+		} else if s := printer.PrintStr(got, true); s != c.want {
+			t.Errorf("%s %q: got %s, want %s", c.name, c.args, s, c.want)
+		}
+	}
+}
+
+func mustRegex(t *testing.T, pattern string) types.Regex {
+	t.Helper()
+	re, e := types.NewRegex(pattern)
+	if e != nil {
+		t.Fatal(e)
+	}
+	return re
+}
+
+func TestStringErrors(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		args []types.ParrotType
+		want string
+	}{
+		{"trim", []types.ParrotType{types.Int64{1}}, "trim: expected a string, got 1"},
+		{"upper-case", []types.ParrotType{"ʞkw"}, "upper-case: expected a string, got :kw"},
+		{"trim", nil, "trim requires 1 args"},
+		{"join", []types.ParrotType{"a", "b", "c"}, "join requires 1 or 2 args"},
+		{"index-of", []types.ParrotType{"a"}, "index-of requires 2 or 3 args"},
+		{"substring", []types.ParrotType{"héllo", types.Int64{3}, types.Int64{2}}, "substring: indices 3 and 2 out of range for a string of 5 chars"},
+		{"substring", []types.ParrotType{"héllo", types.Int64{0}, types.Int64{6}}, "out of range"},
+		{"pad-left", []types.ParrotType{"a", types.Int64{3}, ""}, "pad-left: empty padding"},
+		{"repeat", []types.ParrotType{"a", types.Int64{-1}}, "repeat: negative count"},
+		{"replace", []types.ParrotType{"a", "b"}, "replace requires 3 args"},
+	} {
+		if _, e := callString(c.name, c.args...); e == nil || !strings.Contains(e.Error(), c.want) {
+			t.Errorf("%s %q: got %v, want an error containing %q", c.name, c.args, e, c.want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sllt/parrot/types"
+)
+
+// Transients. (transient coll) returns a vector or hash-map that conj!,
+// assoc! and dissoc! change in place, for building a collection in many
+// steps; (persistent! t) turns it back into an immutable collection, after
+// which t can no longer be used.
+
+func transient(a []types.ParrotType) (types.ParrotType, error) {
+	switch coll := a[0].(type) {
+	case types.Vector:
+		return coll.Val.Transient(), nil
+	case types.HashMap:
+		return coll.Val.Transient(), nil
+	}
+	return nil, errors.New("transient requires a vector or hash-map")
+}
+
+func persistent_BANG(a []types.ParrotType) (types.ParrotType, error) {
+	switch t := a[0].(type) {
+	case *types.TransientVector:
+		return types.Vector{t.Persistent(), nil}, nil
+	case *types.TransientMap:
+		return types.HashMap{t.Persistent(), nil}, nil
+	}
+	return nil, errors.New("persistent! requires a transient")
+}
+
+func conj_BANG(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a) < 1 {
+		return nil, errors.New("conj! requires at least 1 argument")
+	}
+	switch t := a[0].(type) {
+	case *types.TransientVector:
+		for _, x := range a[1:] {
+			if e := t.Conj(x); e != nil {
+				return nil, e
+			}
+		}
+		return t, nil
+	case *types.TransientMap:
+		for _, x := range a[1:] {
+			entry, ok := x.(types.Vector)
+			if !ok || entry.Val.Len() != 2 {
+				return nil, errors.New("conj! on a hash-map requires [key value] vectors")
+			}
+			k, _ := entry.Val.Nth(0)
+			v, _ := entry.Val.Nth(1)
+			if e := t.Assoc(k, v); e != nil {
+				return nil, e
+			}
+		}
+		return t, nil
+	}
+	return nil, errors.New("conj! requires a transient")
+}
+
+func assoc_BANG(a []types.ParrotType) (types.ParrotType, error) {
+	if len(a)%2 != 1 {
+		return nil, errors.New("assoc! requires odd number of arguments")
+	}
+	switch t := a[0].(type) {
+	case *types.TransientVector:
+		for i := 1; i < len(a); i += 2 {
+			idx, e := toInt(a[i], "assoc!")
+			if e != nil {
+				return nil, e
+			}
+			if e := t.Assoc(idx, a[i+1]); e != nil {
+				return nil, fmt.Errorf("assoc!: %s", e)
+			}
+		}
+		return t, nil
+	case *types.TransientMap:
+		for i := 1; i < len(a); i += 2 {
+			if e := t.Assoc(a[i], a[i+1]); e != nil {
+				return nil, e
+			}
+		}
+		return t, nil
+	}
+	return nil, errors.New("assoc! requires a transient")
+}
+
+func dissoc_BANG(a []types.ParrotType) (types.ParrotType, error) {
+	t, ok := a[0].(*types.TransientMap)
+	if !ok {
+		return nil, errors.New("dissoc! requires a transient hash-map")
+	}
+	for _, k := range a[1:] {
+		if e := t.Dissoc(k); e != nil {
+			return nil, e
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,261 @@
+package parrot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+import (
+	"github.com/sllt/parrot/printer"
+	. "github.com/sllt/parrot/types"
+)
+
+func keyword(name string) string {
+	kw, _ := NewKeyword(name)
+	return kw.(string)
+}
+
+// binder stores a value, or the parts of it a pattern matches, in the slots
+// of a frame.
+type binder func(fr *frame, val ParrotType) error
+
+// compilePattern allocates slots in sc for the symbols of pattern. pattern
+// is a symbol, a sequential pattern [a b & rest :as all] or an associative
+// pattern {:keys [a b] :strs [c] x :x :or {a 1} :as m}, whose {p k} entries
+// bind the pattern p to the value of the key k. Patterns nest, and parts
+// missing from the value bind to nil.
+func (c *compiler) compilePattern(pattern ParrotType, sc *scope, w where) (binder, error) {
+	switch p := pattern.(type) {
+	case Symbol:
+		return slotBinder(sc.bind(p.Val)), nil
+	case Vector:
+		return c.compileSeqPattern(p.Val.Slice(), sc, w)
+	case HashMap:
+		return c.compileMapPattern(p, sc, w)
+	}
+	return nil, compileError(w.pos, fmt.Errorf("invalid binding form %s", printer.PrintStr(pattern, true)))
+}
+
+func (c *compiler) compileSeqPattern(pattern []ParrotType, sc *scope, w where) (binder, error) {
+	var rest, as binder
+	positional := []binder{}
+	for i := 0; i < len(pattern); i++ {
+		p := pattern[i]
+		isRest := Symbol_Q(p) && p.(Symbol).Val == "&"
+		if !isRest && !keywordIs(p, "as") {
+			b, e := c.compilePattern(p, sc, w)
+			if e != nil {
+				return nil, e
+			}
+			positional = append(positional, b)
+			continue
+		}
+		if i+1 >= len(pattern) {
+			return nil, compileError(w.pos, fmt.Errorf("missing binding form after %s", printer.PrintStr(p, true)))
+		}
+		i++
+		b, e := c.compilePattern(pattern[i], sc, w)
+		if e != nil {
+			return nil, e
+		}
+		if isRest {
+			rest = b
+		} else {
+			as = b
+		}
+	}
+	return func(fr *frame, val ParrotType) error {
+		if !Seqable_Q(val) {
+			return fmt.Errorf("cannot destructure %s as a sequence", printer.PrintStr(val, true))
+		}
+		slc, more, e := SplitSeq(val, len(positional))
+		if e != nil {
+			return e
+		}
+		for i, b := range positional {
+			var item ParrotType
+			if i < len(slc) {
+				item = slc[i]
+			}
+			if e := b(fr, item); e != nil {
+				return e
+			}
+		}
+		if rest != nil {
+			if e := rest(fr, more); e != nil {
+				return e
+			}
+		}
+		if as != nil {
+			return as(fr, val)
+		}
+		return nil
+	}, nil
+}
+
+// keyBinding binds the value a map holds for key, or def if it holds none.
+type keyBinding struct {
+	key  ParrotType
+	bind binder
+	def  code
+}
+
+func (c *compiler) compileMapPattern(pattern HashMap, sc *scope, w where) (binder, error) {
+	defaults := map[string]ParrotType{}
+	if or, ok := pattern.Val.Get(keyword("or")); ok {
+		hm, ok := or.(HashMap)
+		if !ok {
+			return nil, compileError(w.pos, fmt.Errorf(":or requires a map, got %s", printer.PrintStr(or, true)))
+		}
+		var err error
+		hm.Val.Range(func(k, d ParrotType) bool {
+			switch k := k.(type) {
+			case Symbol:
+				defaults[k.Val] = d
+				return true
+			case string:
+				if Keyword_Q(k) {
+					defaults[strings.TrimPrefix(k, keyword(""))] = d
+					return true
+				}
+			}
+			err = compileError(w.pos, fmt.Errorf(":or keys must be symbols, got %s", printer.PrintStr(k, true)))
+			return false
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	// the :keys, :strs and :as directives, in a fixed order, and then the
+	// {pattern key} entries
+	directives := []string{}
+	entries := []ParrotType{}
+	for _, k := range pattern.Val.Keys() {
+		switch k.(type) {
+		case string:
+			directives = append(directives, k.(string))
+		case Symbol, Vector, HashMap:
+			entries = append(entries, k)
+		default:
+			return nil, compileError(w.pos, fmt.Errorf("unsupported map binding key %s", printer.PrintStr(k, true)))
+		}
+	}
+	sort.Strings(directives)
+	bindings := []keyBinding{}
+	// bind adds a binding of the value of key to p, with the default :or
+	// gives when p is a symbol.
+	bind := func(p ParrotType, key ParrotType) error {
+		b, e := c.compilePattern(p, sc, w)
+		if e != nil {
+			return e
+		}
+		kb := keyBinding{key: key, bind: b}
+		if sym, ok := p.(Symbol); ok {
+			if d, ok := defaults[sym.Val]; ok {
+				if kb.def, e = c.compile(d, sc, w.operand()); e != nil {
+					return e
+				}
+			}
+		}
+		bindings = append(bindings, kb)
+		return nil
+	}
+	var as binder
+	for _, key := range directives {
+		names, _ := pattern.Val.Get(key)
+		switch key {
+		case keyword("keys"), keyword("strs"):
+			syms, e := symbolNames(names)
+			if e != nil {
+				return nil, compileError(w.pos, fmt.Errorf("%s: %s", printer.PrintStr(key, true), e))
+			}
+			for _, name := range syms {
+				var k ParrotType = name
+				if key == keyword("keys") {
+					k = keyword(name)
+				}
+				if e := bind(Symbol{name}, k); e != nil {
+					return nil, e
+				}
+			}
+		case keyword("as"):
+			b, e := c.compilePattern(names, sc, w)
+			if e != nil {
+				return nil, e
+			}
+			as = b
+		case keyword("or"):
+		default:
+			return nil, compileError(w.pos, fmt.Errorf("unsupported map binding key %s", printer.PrintStr(key, true)))
+		}
+	}
+	for _, p := range entries {
+		key, _ := pattern.Val.Get(p)
+		if e := bind(p, key); e != nil {
+			return nil, e
+		}
+	}
+	return func(fr *frame, val ParrotType) error {
+		var m PersistentMap
+		switch v := val.(type) {
+		case nil:
+		case HashMap:
+			m = v.Val
+		default:
+			return fmt.Errorf("cannot destructure %s as a map", printer.PrintStr(val, true))
+		}
+		for _, kb := range bindings {
+			v, ok := m.Get(kb.key)
+			if !ok && kb.def != nil {
+				var e error
+				if v, e = kb.def(fr); e != nil {
+					return e
+				}
+			}
+			if e := kb.bind(fr, v); e != nil {
+				return e
+			}
+		}
+		if as != nil {
+			return as(fr, val)
+		}
+		return nil
+	}, nil
+}
+
+// gensyms counts the symbols gensym has made.
+var gensyms int64
+
+// gensym returns a symbol no other call returns, for names the compiler
+// introduces into user code.
+func gensym(prefix string) Symbol {
+	return Symbol{fmt.Sprintf("%s__%d__auto", prefix, atomic.AddInt64(&gensyms, 1))}
+}
+
+// destructureParams replaces the patterns among the parameters of a fn by
+// plain symbols and wraps body in a let that destructures them, so that
+// calls only ever bind symbols.
+func destructureParams(params, body ParrotType) (ParrotType, ParrotType, error) {
+	slc, e := GetSlice(params)
+	if e != nil {
+		return nil, nil, fmt.Errorf("fn parameters must be a vector, got %s", printer.PrintStr(params, true))
+	}
+	syms := make([]ParrotType, len(slc))
+	binds := []ParrotType{}
+	for i, p := range slc {
+		if Symbol_Q(p) {
+			syms[i] = p
+			continue
+		}
+		sym := gensym("p")
+		syms[i] = sym
+		binds = append(binds, p, sym)
+	}
+	if len(binds) == 0 {
+		return params, body, nil
+	}
+	let := List{[]ParrotType{Symbol{"let"}, NewVector(binds...), body}, nil}
+	return NewVector(syms...), let, nil
+}
@@ -0,0 +1,53 @@
+package parrot
+
+import "testing"
+
+func TestSeqDestructuring(t *testing.T) {
+	expectBoth(t, map[string]string{
+		`(let [[a b] [1 2]] (+ a b))`:                                      "3",
+		`(let [[a b c] [1 2]] c)`:                                          "nil",
+		`(let [[a & more] '(1 2 3)] more)`:                                 "(2 3)",
+		`(let [[a :as all] [1 2]] all)`:                                    "[1 2]",
+		`(let [[[a b] c] [[1 2] 3]] [a b c])`:                              "[1 2 3]",
+		`(let [[a b] "xy"] [a b])`:                                         `[\x \y]`,
+		`((fn [[a b] c] [a b c]) [1 2] 3)`:                                 "[1 2 3]",
+		`(loop [[x & xs] [1 2 3] n 0] (if x (recur xs (+ n x)) n))`:        "6",
+		`(let [[a & [b c]] [1 2 3]] [a b c])`:                              "[1 2 3]",
+		`(let [[_ _ c] (range)] c)`:                                        "2",
+		`(let [[a & more] [1]] more)`:                                      "()",
+		`(defn f [{:keys [x y]} [p q]] (+ x y p q)) (f {:x 1 :y 2} [3 4])`: "10",
+		`((fn ([[a]] a) ([[a] [b]] [a b])) [1] [2])`:                       "[1 2]",
+	})
+	expectErrorBoth(t, map[string]string{
+		`(let [[a] 1] a)`:   "cannot destructure 1 as a sequence",
+		`(let [[a &] 1] a)`: "missing binding form after &",
+		`(let [1 2] 1)`:     "invalid binding form 1",
+	})
+}
+
+func TestMapDestructuring(t *testing.T) {
+	expectBoth(t, map[string]string{
+		`(let [{:keys [a b]} {:a 1 :b 2}] [a b])`:             "[1 2]",
+		`(let [{:strs [a]} {"a" 1}] a)`:                       "1",
+		`(let [{:keys [c d] :or {d 9}} {:c 1}] [c d])`:        "[1 9]",
+		`(let [{:keys [c d] :or {d 9}} {:c 1 :d nil}] [c d])`: "[1 nil]",
+		`(let [{:keys [d] :or {:d 9}} {}] d)`:                 "9",
+		`(let [{:keys [a] :as m} {:a 1}] m)`:                  "{:a 1}",
+		`(let [{:keys [a]} nil] a)`:                           "nil",
+		`(let [{a :a b "b"} {:a 1 "b" 2}] [a b])`:             "[1 2]",
+		`(let [{a :a :or {a 5}} {}] a)`:                       "5",
+		`(let [{[x y] :pos} {:pos [1 2]}] (+ x y))`:           "3",
+		`(let [{{:keys [z]} :inner} {:inner {:z 3}}] z)`:      "3",
+		`(let [{x 1} {1 :one}] x)`:                            ":one",
+		`((fn [{:keys [a] :or {a 2}}] (* a a)) {})`:           "4",
+		`(let [n 10 {:keys [a] :or {a (* n 2)}} {}] a)`:       "20",
+	})
+	expectErrorBoth(t, map[string]string{
+		`(let [{:keys [a] :or {"a" 1}} {}] a)`: `:or keys must be symbols, got "a"`,
+		`(let [{:keys [a] :or {1 1}} {}] a)`:   ":or keys must be symbols, got 1",
+		`(let [{:keys [a] :or 1} {}] a)`:       ":or requires a map, got 1",
+		`(let [{1 :a} {}] 1)`:                  "unsupported map binding key 1",
+		`(let [{:nope [a]} {}] a)`:             "unsupported map binding key :nope",
+		`(let [{:keys [a]} [1]] a)`:            "cannot destructure [1] as a map",
+	})
+}
@@ -0,0 +1,38 @@
+package env
+
+import (
+	"testing"
+
+	"github.com/sllt/parrot/types"
+)
+
+func TestBindingValid(t *testing.T) {
+	r := NewRegistry(nil)
+	r.Core.Env.Set(types.Symbol{"x"}, types.Int64{1})
+	b := r.Current.Env.(Env).Resolve("x")
+	if b == nil || !b.Valid() || b.Data[b.Key] != (types.Int64{1}) {
+		t.Fatalf("Resolve(x) = %v", b)
+	}
+	r.Core.Env.Set(types.Symbol{"x"}, types.Int64{2})
+	if !b.Valid() || b.Data[b.Key] != (types.Int64{2}) {
+		t.Error("redefining x made its binding invalid")
+	}
+
+	// names defined by another registry do not concern r
+	other := NewRegistry(nil)
+	other.Current.Env.Set(types.Symbol{"y"}, nil)
+	other.FindOrCreate("other.ns").Alias("a", other.Core)
+	other.Remove("other.ns")
+	if !b.Valid() {
+		t.Error("a definition in another registry made the binding invalid")
+	}
+
+	// but a definition that may shadow x does
+	r.Current.Env.Set(types.Symbol{"x"}, types.Int64{3})
+	if b.Valid() {
+		t.Error("shadowing x left its binding valid")
+	}
+	if b := r.Current.Env.(Env).Resolve("x"); b.Data[b.Key] != (types.Int64{3}) {
+		t.Errorf("x resolves to %v, want 3", b.Data[b.Key])
+	}
+}
@@ -3,20 +3,25 @@ package env
 import (
 	"errors"
 	"fmt"
+
 	"github.com/sllt/parrot/types"
 )
 
 type Env struct {
-	Data      map[string]types.ParrotType
-	Outer     types.EnvType
-	curFunc   types.ParrotType // current func
-	pc        int
-	addrStack types.ParrotType // stack trace
+	Data   map[string]types.ParrotType
+	Outer  types.EnvType
+	frame  *types.Frame  // call stack frame code in this env runs in
+	budget *types.Budget // limits evaluation in this env
+	ns     *Namespace    // set on the root env of a namespace
 }
 
 func NewEnv(outer types.EnvType, binds_mt types.ParrotType,
 	exprs_mt types.ParrotType) (types.EnvType, error) {
-	env := Env{map[string]types.ParrotType{}, outer, nil, 0, nil}
+	env := Env{map[string]types.ParrotType{}, outer, nil, nil, nil}
+	if outer != nil {
+		env.frame = outer.Frame()
+		env.budget = outer.Budget()
+	}
 
 	if binds_mt != nil && exprs_mt != nil {
 		binds, e := types.GetSlice(binds_mt)
@@ -44,6 +49,8 @@ func NewEnv(outer types.EnvType, binds_mt types.ParrotType,
 func (e Env) Find(key types.Symbol) types.EnvType {
 	if _, ok := e.Data[key.Val]; ok {
 		return e
+	} else if _, ok := e.lookupNS(key.Val); ok {
+		return e
 	} else if e.Outer != nil {
 		return e.Outer.Find(key)
 	} else {
@@ -52,16 +59,85 @@ func (e Env) Find(key types.Symbol) types.EnvType {
 }
 
 func (e Env) Set(key types.Symbol, value types.ParrotType) types.ParrotType {
+	if _, ok := e.Data[key.Val]; !ok {
+		e.registry().invalidateBindings()
+	}
 	e.Data[key.Val] = value
 	return value
 }
 
 func (e Env) Get(key types.Symbol) (types.ParrotType, error) {
-	env := e.Find(key)
-	if env == nil {
-		return nil, errors.New("'" + key.Val + "' not found")
+	if val, ok := e.Data[key.Val]; ok {
+		return val, nil
+	} else if val, ok := e.lookupNS(key.Val); ok {
+		return val, nil
+	} else if e.Outer != nil {
+		return e.Outer.Get(key)
 	}
-	return env.(Env).Data[key.Val], nil
+	return nil, errors.New("'" + key.Val + "' not found")
+}
+
+// Binding is where a name is defined: a key of the data of an env.
+type Binding struct {
+	Data map[string]types.ParrotType
+	Key  string
+	gen  int64     // the generation of reg it was resolved in
+	reg  *Registry // of the env it was resolved from, or nil
+}
+
+// Valid reports whether b is still where its name is defined, which it is
+// until a name is defined, referred or aliased anywhere in the namespaces
+// of its registry. Bindings resolved outside of any namespace are never
+// valid for long.
+func (b *Binding) Valid() bool {
+	return b.reg != nil && b.gen == b.reg.generation()
+}
+
+// Resolve returns where name is defined as seen from e, or nil. Unlike the
+// value Get returns, a binding sees later redefinitions of the name, but a
+// new definition can shadow it: code that keeps a binding must resolve the
+// name again once the binding is no longer Valid.
+func (e Env) Resolve(name string) *Binding {
+	reg := e.registry()
+	gen := reg.generation()
+	b := e.resolve(name)
+	if b != nil {
+		b.gen, b.reg = gen, reg
+	}
+	return b
+}
+
+// registry returns the registry of the namespace e belongs to, or nil.
+func (e Env) registry() *Registry {
+	if e.ns != nil {
+		return e.ns.registry
+	}
+	if outer, ok := e.Outer.(Env); ok {
+		return outer.registry()
+	}
+	return nil
+}
+
+func (e Env) resolve(name string) *Binding {
+	if _, ok := e.Data[name]; ok {
+		return &Binding{e.Data, name, 0, nil}
+	}
+	if e.ns != nil {
+		if b := e.ns.resolve(name); b != nil {
+			return b
+		}
+	}
+	if outer, ok := e.Outer.(Env); ok {
+		return outer.resolve(name)
+	}
+	return nil
+}
+
+func (e Env) lookupNS(name string) (types.ParrotType, bool) {
+	if e.ns == nil {
+		return nil, false
+	}
+	return e.ns.lookup(name)
 }
 
 func (e Env) All() (types.ParrotType, error) {
@@ -71,6 +147,30 @@ func (e Env) All() (types.ParrotType, error) {
 	return nil, nil
 }
 
-func (e *Env) GetStackTrace() {
+func (e Env) Frame() *types.Frame {
+	return e.frame
+}
+
+// WithFrame returns e running in frame, sharing e's bindings.
+func (e Env) WithFrame(frame *types.Frame) types.EnvType {
+	e.frame = frame
+	return e
+}
+
+func (e Env) Budget() *types.Budget {
+	return e.budget
+}
+
+// WithBudget returns e evaluating under budget, sharing e's bindings.
+func (e Env) WithBudget(budget *types.Budget) types.EnvType {
+	e.budget = budget
+	return e
+}
 
+func (e Env) GetStackTrace() []types.Frame {
+	trace := []types.Frame{}
+	for f := e.frame; f != nil; f = f.Caller {
+		trace = append(trace, *f)
+	}
+	return trace
 }
@@ -0,0 +1,202 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/sllt/parrot/types"
+)
+
+const CoreNS = "parrot.core"
+
+// Namespace is a named set of definitions. Code evaluated in a namespace
+// defines into its Env, which is chained to the core namespace so that
+// builtins stay visible everywhere.
+type Namespace struct {
+	Name     string
+	Env      types.EnvType
+	aliases  map[string]*Namespace
+	refers   map[string]referral
+	referAll []*Namespace
+	registry *Registry
+}
+
+type referral struct {
+	ns   *Namespace
+	name string
+}
+
+// Registry holds the namespaces known to an interpreter and the one code is
+// currently evaluated in. Require calls Loader to load a namespace before
+// looking it up. Code in every namespace is evaluated under Budget, and
+// the top-level forms loaded into them by Eval if it is set.
+type Registry struct {
+	// gen counts the changes that can make a name resolve to another
+	// binding: new definitions, refers, aliases and removed namespaces.
+	// It is first, to keep it aligned for atomic access.
+	gen        int64
+	Core       *Namespace
+	Current    *Namespace
+	Loader     func(name string) error
+	Budget     *types.Budget
+	Eval       func(form types.ParrotType, env types.EnvType) (types.ParrotType, error)
+	namespaces map[string]*Namespace
+}
+
+func NewRegistry(budget *types.Budget) *Registry {
+	r := &Registry{namespaces: map[string]*Namespace{}, Budget: budget}
+	r.Core = r.FindOrCreate(CoreNS)
+	r.Current = r.FindOrCreate("user")
+	return r
+}
+
+func (r *Registry) generation() int64 {
+	if r == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&r.gen)
+}
+
+func (r *Registry) invalidateBindings() {
+	if r != nil {
+		atomic.AddInt64(&r.gen, 1)
+	}
+}
+
+// Find returns the namespace called name, or nil.
+func (r *Registry) Find(name string) *Namespace {
+	return r.namespaces[name]
+}
+
+// FindOrCreate returns the namespace called name, creating it if needed.
+func (r *Registry) FindOrCreate(name string) *Namespace {
+	if ns, ok := r.namespaces[name]; ok {
+		return ns
+	}
+	ns := &Namespace{
+		Name:     name,
+		aliases:  map[string]*Namespace{},
+		refers:   map[string]referral{},
+		registry: r,
+	}
+	var outer types.EnvType
+	if r.Core != nil {
+		outer = r.Core.Env
+	}
+	ns.Env = Env{map[string]types.ParrotType{}, outer, nil, r.Budget, ns}
+	r.namespaces[name] = ns
+	return ns
+}
+
+// Require returns the namespace called name after giving Loader the chance
+// to load it.
+func (r *Registry) Require(name string) (*Namespace, error) {
+	if r.Loader != nil {
+		if e := r.Loader(name); e != nil {
+			return nil, e
+		}
+	}
+	if ns, ok := r.namespaces[name]; ok {
+		return ns, nil
+	}
+	return nil, errors.New("namespace '" + name + "' not found")
+}
+
+// Remove forgets the namespace called name.
+func (r *Registry) Remove(name string) {
+	if name != CoreNS {
+		delete(r.namespaces, name)
+		r.invalidateBindings()
+	}
+}
+
+// Names returns the names of all namespaces.
+func (r *Registry) Names() []string {
+	names := []string{}
+	for name := range r.namespaces {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (n *Namespace) Registry() *Registry {
+	return n.registry
+}
+
+// Alias makes name/x refer to x in target.
+func (n *Namespace) Alias(name string, target *Namespace) {
+	n.aliases[name] = target
+	n.registry.invalidateBindings()
+}
+
+// Refer makes the names defined in target usable without qualification. If
+// names is nil, every name of target is referred.
+func (n *Namespace) Refer(target *Namespace, names []string) error {
+	defer n.registry.invalidateBindings()
+	if names == nil {
+		n.referAll = append(n.referAll, target)
+		return nil
+	}
+	for _, name := range names {
+		if _, ok := target.data()[name]; !ok {
+			return fmt.Errorf("'%s' is not defined in namespace %s", name, target.Name)
+		}
+		n.refers[name] = referral{target, name}
+	}
+	return nil
+}
+
+func (n *Namespace) data() map[string]types.ParrotType {
+	return n.Env.(Env).Data
+}
+
+// resolve finds the namespace qualified names (alias/x or full.name/x) and
+// the referred names visible in n.
+func (n *Namespace) resolve(name string) *Binding {
+	if i := strings.Index(name, "/"); i > 0 && i < len(name)-1 {
+		target, ok := n.aliases[name[:i]]
+		if !ok {
+			target = n.registry.namespaces[name[:i]]
+		}
+		if target == nil {
+			return nil
+		}
+		if _, ok := target.data()[name[i+1:]]; ok {
+			return &Binding{target.data(), name[i+1:], 0, nil}
+		}
+		return nil
+	}
+	if r, ok := n.refers[name]; ok {
+		if _, ok := r.ns.data()[r.name]; ok {
+			return &Binding{r.ns.data(), r.name, 0, nil}
+		}
+		return nil
+	}
+	for _, target := range n.referAll {
+		if _, ok := target.data()[name]; ok {
+			return &Binding{target.data(), name, 0, nil}
+		}
+	}
+	return nil
+}
+
+func (n *Namespace) lookup(name string) (types.ParrotType, bool) {
+	if b := n.resolve(name); b != nil {
+		return b.Data[b.Key], true
+	}
+	return nil, false
+}
+
+// NamespaceOf returns the namespace code evaluated in env belongs to.
+func NamespaceOf(env types.EnvType) *Namespace {
+	for env != nil {
+		e := env.(Env)
+		if e.ns != nil {
+			return e.ns
+		}
+		env = e.Outer
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package parrot
+
+import (
+	"errors"
+	"fmt"
+)
+
+import (
+	. "github.com/sllt/parrot/env"
+	"github.com/sllt/parrot/printer"
+	. "github.com/sllt/parrot/types"
+)
+
+func isArityClause(form ParrotType) bool {
+	lst, ok := form.(List)
+	return ok && len(lst.Val) > 0 && (Vector_Q(lst.Val[0]) || List_Q(lst.Val[0]))
+}
+
+// fnBody returns the forms of a fn body as one form, wrapping several of
+// them in a do.
+func fnBody(forms []ParrotType) ParrotType {
+	switch len(forms) {
+	case 0:
+		return nil
+	case 1:
+		return forms[0]
+	}
+	return List{append([]ParrotType{Symbol{"do"}}, forms...), nil}
+}
+
+// arity is the compiled code of one parameter list of a fn.
+type arity struct {
+	required int
+	variadic bool
+	params   []int // slots of the parameters, the & one last
+	body     code
+}
+
+// lambda is a compiled fn form. Evaluating it creates a closure.
+type lambda struct {
+	name    string
+	arities []arity
+	forms   []Arity
+	scope   *fnScope
+}
+
+func (l *lambda) arity(n int) *arity {
+	var variadic *arity
+	for i := range l.arities {
+		ar := &l.arities[i]
+		if !ar.variadic && ar.required == n {
+			return ar
+		}
+		if ar.variadic && n >= ar.required && variadic == nil {
+			variadic = ar
+		}
+	}
+	return variadic
+}
+
+// closure is a lambda together with the values it captured.
+type closure struct {
+	lambda *lambda
+	free   []ParrotType
+	env    EnvType
+	fn     ParrotFunc
+}
+
+// Call runs the closure for args. Tail calls to other closures reuse the
+// loop below instead of growing the Go stack, replacing call by a frame
+// that counts them.
+func (cl *closure) Call(args []ParrotType, call *Frame, budget *Budget) (ParrotType, error) {
+	if budget != nil {
+		if e := budget.Enter(); e != nil {
+			return nil, traceError(e, call.Caller, call.Pos)
+		}
+		defer budget.Leave()
+	}
+	for {
+		if budget != nil {
+			if e := budget.Step(); e != nil {
+				return nil, traceError(e, call, call.Pos)
+			}
+		}
+		ar := cl.lambda.arity(len(args))
+		if ar == nil {
+			fn := cl.fn
+			fn.Name = call.Name
+			_, _, e := fn.SelectArity(len(args))
+			return nil, traceError(e, call.Caller, call.Pos)
+		}
+		fr := &frame{make([]ParrotType, cl.lambda.scope.nslots), cl.free, cl.fn, cl.env, call, budget, tailCall{}}
+		for i := 0; i < ar.required; i++ {
+			fr.slots[ar.params[i]] = args[i]
+		}
+		if ar.variadic {
+			fr.slots[ar.params[ar.required]] = List{args[ar.required:], nil}
+		}
+		v, e := ar.body(fr)
+		for e == nil && v == recurMarker {
+			if budget != nil {
+				if e := budget.Step(); e != nil {
+					return nil, traceError(e, call, call.Pos)
+				}
+			}
+			v, e = ar.body(fr)
+		}
+		if e != nil || v != tailMarker {
+			return v, e
+		}
+		tc := fr.tail
+		call = &Frame{tc.name, tc.pos, call.Tail + 1, call.Caller}
+		next, ok := tc.fn.Compiled.(*closure)
+		if !ok {
+			return tc.fn.Compiled.Call(tc.args, call, budget)
+		}
+		cl, args = next, tc.args
+	}
+}
+
+func slotBinder(slot int) binder {
+	return func(fr *frame, val ParrotType) error {
+		fr.slots[slot] = val
+		return nil
+	}
+}
+
+// compileFn compiles (fn name? [params] body*) and the multi-arity
+// (fn name? ([params] body*)+). A named fn can call itself by its name.
+func (c *compiler) compileFn(args []ParrotType, sc *scope, w where) (code, error) {
+	name := ""
+	if len(args) > 0 && Symbol_Q(args[0]) {
+		name = args[0].(Symbol).Val
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return nil, compileError(w.pos, errors.New("fn requires a parameter vector"))
+	}
+	clauses := [][]ParrotType{args}
+	if isArityClause(args[0]) {
+		clauses = nil
+		for _, cl := range args {
+			if !isArityClause(cl) {
+				return nil, compileError(w.pos, fmt.Errorf("expected an arity like ([params] body), got %s", printer.PrintStr(cl, true)))
+			}
+			clauses = append(clauses, cl.(List).Val)
+		}
+	}
+	fsc := newFnScope(sc, name)
+	l := &lambda{name: name, scope: fsc.fn}
+	fixed := map[int]bool{}
+	variadic := false
+	for _, cl := range clauses {
+		params, body, e := destructureParams(cl[0], fnBody(cl[1:]))
+		if e != nil {
+			return nil, compileError(w.pos, e)
+		}
+		required, more := ParamCount(params)
+		switch {
+		case more && variadic:
+			return nil, compileError(w.pos, errors.New("fn can have only one variadic arity"))
+		case more:
+			variadic = true
+		case fixed[required]:
+			return nil, compileError(w.pos, fmt.Errorf("fn has two arities taking %d args", required))
+		default:
+			fixed[required] = true
+		}
+		psc := fsc.nest()
+		ar := arity{required: required, variadic: more}
+		binders := []binder{}
+		syms, _ := GetSlice(params)
+		for _, p := range syms {
+			if p.(Symbol).Val == "&" {
+				continue
+			}
+			slot := psc.bind(p.(Symbol).Val)
+			ar.params = append(ar.params, slot)
+			binders = append(binders, slotBinder(slot))
+		}
+		if ar.body, e = c.compile(body, psc, where{true, &recurTarget{binders}, w.pos}); e != nil {
+			return nil, e
+		}
+		l.arities = append(l.arities, ar)
+		l.forms = append(l.forms, Arity{cl[0], fnBody(cl[1:])})
+	}
+	var forms []Arity
+	if len(l.forms) > 1 {
+		forms = l.forms
+	}
+	fs := fsc.fn
+	return func(fr *frame) (ParrotType, error) {
+		free := make([]ParrotType, len(fs.free))
+		for i, r := range fs.free {
+			free[i] = fr.load(r)
+		}
+		cl := &closure{l, free, fr.env, ParrotFunc{}}
+		cl.fn = ParrotFunc{Eval, l.forms[0].Exp, fr.env, l.forms[0].Params, false, NewEnv, nil, false, name, forms, cl}
+		return cl.fn, nil
+	}, nil
+}
@@ -0,0 +1,27 @@
+package parrot
+
+import (
+	"testing"
+)
+
+func TestArities(t *testing.T) {
+	expectBoth(t, map[string]string{
+		`(defn f ([] 0) ([a] a) ([a b] (+ a b)) ([a b & more] (apply + a b more)))
+		 [(f) (f 1) (f 1 2) (f 1 2 3 4)]`: "[0 1 3 10]",
+		`((fn [a & r] [a r]) 1 2 3)`: "[1 (2 3)]",
+		`((fn [& r] r))`:             "()",
+		`((fn named ([n] (named n 1)) ([n acc] (if (= n 0) acc (named (- n 1) (* acc n))))) 20)`: "2432902008176640000",
+		// a fixed arity is preferred to a variadic one that also fits
+		`((fn ([a] :fixed) ([a & r] :variadic)) 1)`:          ":fixed",
+		`(apply (fn ([a b] :two) ([a b c] :three)) [1 2 3])`: ":three",
+	})
+	expectErrorBoth(t, map[string]string{
+		`(defn g [a] a) (g)`:                      "wrong number of args (0) passed to g, expected 1",
+		`(defn g [a] a) (g 1 2)`:                  "wrong number of args (2) passed to g, expected 1",
+		`(defn h ([a] a) ([a b] b)) (h)`:          "wrong number of args (0) passed to h, expected 1 or 2",
+		`((fn [a & r] r))`:                        "wrong number of args (0) passed to fn, expected at least 1",
+		`(fn ([a] 1) ([b] 2))`:                    "fn has two arities taking 1 args",
+		`(fn ([& a] 1) ([b & c] 2))`:              "fn can have only one variadic arity",
+		`(defn k ([a] a) ([a b] b)) (apply k [])`: "expected 1 or 2",
+	})
+}
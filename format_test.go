@@ -0,0 +1,23 @@
+package parrot
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestStandardWriters(t *testing.T) {
+	var out, errOut bytes.Buffer
+	it := New(WithStdout(&out), WithStderr(&errOut))
+	if _, e := it.EvalString(`(fprintf *out* "%d%n" 1) (fprintf *err* "%s" "warn") (printf "%s" "!")`); e != nil {
+		t.Fatal(e)
+	}
+	if out.String() != "1\n!" || errOut.String() != "warn" {
+		t.Errorf("wrote %q and %q", out.String(), errOut.String())
+	}
+	// the standard writers do not hand the files behind them to interop
+	expectError(t, map[string]string{
+		`(. *err* Chmod 420)`: "no method Chmod",
+		`(. *out* Fd)`:        "no method Fd",
+	})
+	expect(t, map[string]string{`*out*`: "#<writer *out*>"})
+}
@@ -0,0 +1,32 @@
+package parrot
+
+import (
+	"testing"
+)
+
+func TestMapKeys(t *testing.T) {
+	expectBoth(t, map[string]string{
+		`(get {1 "a" [0 0] :origin} [0 0])`:  ":origin",
+		`(get {1 "a" [0 0] :origin} '(0 0))`: ":origin",
+		`(get {1 "a"} 1.0)`:                  "\"a\"",
+		`(get {1.5 "a"} 3/2)`:                "\"a\"",
+		`(let [m {'x 1 "x" 2 :x 3 \x 4}] [(get m 'x) (get m "x") (get m :x) (get m \x)])`: "[1 2 3 4]",
+		`(get {{:a 1 :b 2} :m} {:b 2 :a 1})`:                                              ":m",
+		`(get {#{1 2} :s} #{2 1})`:                                                        ":s",
+		`[(get {nil :n} nil) (contains? {nil 1} nil) (contains? {} nil)]`:                 "[:n true false]",
+		`(get {1/2 :half} 2/4)`:                                                           ":half",
+		`(get {(bigint 5) :five} 5)`:                                                      ":five",
+		`(get {0.0 :z} -0.0)`:                                                             ":z",
+		`(get {true 1 false 2} false)`:                                                    "2",
+		`(= {[1] 1} {'(1) 1})`:                                                            "true",
+		`(keys (hash-map [1 2] 3))`:                                                       "([1 2])",
+		`(get (assoc {} (range 3) :r) [0 1 2])`:                                           ":r",
+		`(dissoc {[1] 1 2 2} '(1))`:                                                       "{2 2}",
+		`(into {} [[1 :a] [1 :b]])`:                                                       "{1 :b}",
+		`(contains? {(lazy-seq [1]) 1} [1])`:                                              "true",
+		`(let [{a [0 0]} {[0 0] :x}] a)`:                                                  ":x",
+		`(count {1 :a 1N :b})`:                                                            "1",
+		`(count (set [1 1.0 (bigint 1)]))`:                                                "1",
+		`(= [1] [1.0])`:                                                                   "true",
+	})
+}
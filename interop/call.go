@@ -0,0 +1,122 @@
+package interop
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/sllt/parrot/types"
+)
+
+// WrapFunc turns a Go function into a Parrot function. Arguments are
+// converted with ToGo and results with ToParrot. A trailing error result is
+// returned as the error of the call; several other results are returned as
+// a vector.
+func WrapFunc(fn interface{}) (types.Func, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return types.Func{}, fmt.Errorf("cannot wrap %T as a function", fn)
+	}
+	return types.Func{func(a []types.ParrotType) (types.ParrotType, error) {
+		return call(v, a)
+	}, nil, false, nil}, nil
+}
+
+func call(fn reflect.Value, args []types.ParrotType) (res types.ParrotType, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			res, err = nil, fmt.Errorf("panic in Go call: %v", r)
+		}
+	}()
+	t := fn.Type()
+	n := t.NumIn()
+	if t.IsVariadic() {
+		if len(args) < n-1 {
+			return nil, fmt.Errorf("wrong number of args (%d) passed to %s, expected at least %d", len(args), t, n-1)
+		}
+	} else if len(args) != n {
+		return nil, fmt.Errorf("wrong number of args (%d) passed to %s, expected %d", len(args), t, n)
+	}
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var argType reflect.Type
+		if t.IsVariadic() && i >= n-1 {
+			argType = t.In(n - 1).Elem()
+		} else {
+			argType = t.In(i)
+		}
+		v, e := ToGo(arg, argType)
+		if e != nil {
+			return nil, fmt.Errorf("argument %d: %s", i, e)
+		}
+		in[i] = v
+	}
+	return results(fn.Call(in))
+}
+
+func results(out []reflect.Value) (types.ParrotType, error) {
+	if len(out) > 0 && out[len(out)-1].Type() == errorType {
+		if e := out[len(out)-1]; !e.IsNil() {
+			return nil, e.Interface().(error)
+		}
+		out = out[:len(out)-1]
+	}
+	switch len(out) {
+	case 0:
+		return nil, nil
+	case 1:
+		return valueToParrot(out[0]), nil
+	}
+	lst := make([]types.ParrotType, len(out))
+	for i, v := range out {
+		lst[i] = valueToParrot(v)
+	}
+	return types.NewVector(lst...), nil
+}
+
+// receiver returns the Go value Parrot methods and fields are looked up on.
+func receiver(obj types.ParrotType) reflect.Value {
+	if gobj, ok := obj.(types.GoObject); ok {
+		return reflect.ValueOf(gobj.Val)
+	}
+	return reflect.ValueOf(obj)
+}
+
+// CallMethod calls the method called name on obj. Kebab-case names are
+// accepted for Go's camel case ones.
+func CallMethod(obj types.ParrotType, name string, args []types.ParrotType) (types.ParrotType, error) {
+	recv := receiver(obj)
+	if !recv.IsValid() {
+		return nil, fmt.Errorf("cannot call method %s on nil", name)
+	}
+	m := recv.MethodByName(name)
+	if !m.IsValid() {
+		m = recv.MethodByName(goName(name))
+	}
+	if !m.IsValid() {
+		return nil, fmt.Errorf("%s has no method %s", recv.Type(), name)
+	}
+	return call(m, args)
+}
+
+// Field returns the exported struct field called name of obj, following
+// pointers.
+func Field(obj types.ParrotType, name string) (types.ParrotType, error) {
+	v := receiver(obj)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, fmt.Errorf("cannot read field %s of nil", name)
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cannot read field %s of %s", name, v.Type())
+	}
+	f := v.FieldByName(name)
+	if !f.IsValid() {
+		f = v.FieldByName(goName(name))
+	}
+	if !f.IsValid() || !f.CanInterface() {
+		return nil, fmt.Errorf("%s has no exported field %s", v.Type(), name)
+	}
+	return valueToParrot(f), nil
+}
@@ -0,0 +1,418 @@
+// Package interop converts between Go and Parrot values with reflection, so
+// that arbitrary Go functions, methods and struct fields can be used from
+// Parrot code.
+package interop
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/sllt/parrot/types"
+)
+
+var (
+	parrotType = reflect.TypeOf((*types.ParrotType)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+	bigIntType = reflect.TypeOf((*big.Int)(nil))
+	bigRatType = reflect.TypeOf((*big.Rat)(nil))
+	regexType  = reflect.TypeOf((*regexp.Regexp)(nil))
+)
+
+// isParrot reports whether v already is a Parrot value that needs no
+// conversion.
+func isParrot(v interface{}) bool {
+	switch v.(type) {
+	case types.Int64, types.Float64, types.BigInt, types.Ratio, types.Char, types.Regex, types.Symbol, types.List, types.Vector,
+		types.HashMap, types.Set, types.Func, types.ParrotFunc, *types.Atom,
+		types.Channel, types.GoObject:
+		return true
+	}
+	return false
+}
+
+// ToParrot converts a Go value to its Parrot counterpart. Integers become
+// Int64, or BigInt when they do not fit, floats Float64, slices and arrays
+// Vector and maps HashMap. Functions are wrapped with WrapFunc. Structs,
+// pointers and everything else are kept as GoObject, on which methods can
+// be called.
+func ToParrot(val interface{}) types.ParrotType {
+	if val == nil || isParrot(val) {
+		return val
+	}
+	return valueToParrot(reflect.ValueOf(val))
+}
+
+func valueToParrot(v reflect.Value) types.ParrotType {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return types.Int64{v.Int()}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if n := v.Uint(); n > math.MaxInt64 {
+			return types.BigInt{new(big.Int).SetUint64(n)}
+		}
+		return types.Int64{int64(v.Uint())}
+	case reflect.Float32, reflect.Float64:
+		return types.Float64{v.Float()}
+	case reflect.String:
+		return v.String()
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return ToParrot(v.Elem().Interface())
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		if v.IsNil() {
+			return nil
+		}
+	}
+	if v.CanInterface() && isParrot(v.Interface()) {
+		return v.Interface()
+	}
+	switch v.Type() {
+	case bigIntType:
+		return types.BigInt{new(big.Int).Set(v.Interface().(*big.Int))}
+	case bigRatType:
+		return types.NewRatio(new(big.Rat).Set(v.Interface().(*big.Rat)))
+	case regexType:
+		if re, e := types.NewRegex(v.Interface().(*regexp.Regexp).String()); e == nil {
+			return re
+		}
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 && v.Kind() == reflect.Slice {
+			return string(v.Bytes())
+		}
+		lst := make([]types.ParrotType, v.Len())
+		for i := range lst {
+			lst[i] = valueToParrot(v.Index(i))
+		}
+		return types.NewVector(lst...)
+	case reflect.Map:
+		m := types.PersistentMap{}.Transient()
+		for _, k := range v.MapKeys() {
+			m.Assoc(valueToParrot(k), valueToParrot(v.MapIndex(k)))
+		}
+		return types.HashMap{m.Persistent(), nil}
+	case reflect.Func:
+		fn, _ := WrapFunc(v.Interface())
+		return fn
+	case reflect.Struct:
+		// keep structs addressable so that pointer methods can be called
+		p := reflect.New(v.Type())
+		p.Elem().Set(v)
+		return types.GoObject{p.Interface()}
+	}
+	return types.GoObject{v.Interface()}
+}
+
+// ToGo converts a Parrot value to a Go value of type t.
+func ToGo(val types.ParrotType, t reflect.Type) (reflect.Value, error) {
+	if t == parrotType {
+		if val == nil {
+			return reflect.Zero(t), nil
+		}
+		return reflect.ValueOf(&val).Elem(), nil
+	}
+	if obj, ok := val.(types.GoObject); ok {
+		v := reflect.ValueOf(obj.Val)
+		if v.Type().AssignableTo(t) {
+			return v, nil
+		}
+		if v.Kind() == reflect.Ptr && v.Type().Elem().AssignableTo(t) {
+			return v.Elem(), nil
+		}
+		return cannotConvert(val, t)
+	}
+	if val == nil {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map, reflect.Func, reflect.Chan:
+			return reflect.Zero(t), nil
+		}
+		return cannotConvert(val, t)
+	}
+	if t.Kind() == reflect.Interface {
+		if t.NumMethod() == 0 {
+			return ToGo(val, naturalType(val))
+		}
+		if reflect.TypeOf(val).Implements(t) {
+			return reflect.ValueOf(val), nil
+		}
+		return cannotConvert(val, t)
+	}
+
+	switch t {
+	case bigIntType:
+		if n, ok := types.BigIntOf(val); ok {
+			return reflect.ValueOf(new(big.Int).Set(n)), nil
+		}
+		return cannotConvert(val, t)
+	case bigRatType:
+		if r, ok := types.RatOf(val); ok {
+			return reflect.ValueOf(new(big.Rat).Set(r)), nil
+		}
+		return cannotConvert(val, t)
+	case regexType:
+		if re, ok := val.(types.Regex); ok {
+			return reflect.ValueOf(re.Val), nil
+		}
+		return cannotConvert(val, t)
+	}
+	v := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.Bool:
+		b, ok := val.(bool)
+		if !ok {
+			return cannotConvert(val, t)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := toInt(val)
+		if !ok || v.OverflowInt(i) {
+			return cannotConvert(val, t)
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if n, ok := val.(types.BigInt); ok && n.Val.IsUint64() {
+			if v.OverflowUint(n.Val.Uint64()) {
+				return cannotConvert(val, t)
+			}
+			v.SetUint(n.Val.Uint64())
+			break
+		}
+		i, ok := toInt(val)
+		if !ok || i < 0 || v.OverflowUint(uint64(i)) {
+			return cannotConvert(val, t)
+		}
+		v.SetUint(uint64(i))
+	case reflect.Float32, reflect.Float64:
+		switch tval := val.(type) {
+		case types.Float64:
+			v.SetFloat(tval.Val)
+		case types.BigInt:
+			f, _ := new(big.Float).SetInt(tval.Val).Float64()
+			v.SetFloat(f)
+		case types.Ratio:
+			f, _ := tval.Val.Float64()
+			v.SetFloat(f)
+		default:
+			i, ok := toInt(val)
+			if !ok {
+				return cannotConvert(val, t)
+			}
+			v.SetFloat(float64(i))
+		}
+	case reflect.String:
+		switch tval := val.(type) {
+		case string:
+			v.SetString(strings.TrimPrefix(tval, "\u029e"))
+		case types.Symbol:
+			v.SetString(tval.Val)
+		case types.Char:
+			v.SetString(string(tval.Val))
+		default:
+			return cannotConvert(val, t)
+		}
+	case reflect.Slice:
+		if s, ok := val.(string); ok && t.Elem().Kind() == reflect.Uint8 {
+			return reflect.ValueOf([]byte(s)).Convert(t), nil
+		}
+		if s, ok := val.(types.Set); ok {
+			val = types.List{s.Val.Keys(), nil}
+		}
+		slc, e := types.GetSlice(val)
+		if e != nil {
+			return cannotConvert(val, t)
+		}
+		v = reflect.MakeSlice(t, len(slc), len(slc))
+		for i, x := range slc {
+			xv, e := ToGo(x, t.Elem())
+			if e != nil {
+				return reflect.Value{}, e
+			}
+			v.Index(i).Set(xv)
+		}
+	case reflect.Array:
+		slc, e := types.GetSlice(val)
+		if e != nil || len(slc) != t.Len() {
+			return cannotConvert(val, t)
+		}
+		for i, x := range slc {
+			xv, e := ToGo(x, t.Elem())
+			if e != nil {
+				return reflect.Value{}, e
+			}
+			v.Index(i).Set(xv)
+		}
+	case reflect.Map:
+		hm, ok := val.(types.HashMap)
+		if !ok {
+			return cannotConvert(val, t)
+		}
+		v = reflect.MakeMapWithSize(t, hm.Val.Len())
+		var err error
+		hm.Val.Range(func(k, x types.ParrotType) bool {
+			var kv, xv reflect.Value
+			if kv, err = ToGo(k, t.Key()); err != nil {
+				return false
+			}
+			if kt := reflect.TypeOf(kv.Interface()); kt != nil && !kt.Comparable() {
+				err = fmt.Errorf("cannot use %T as a Go map key", k)
+				return false
+			}
+			if xv, err = ToGo(x, t.Elem()); err != nil {
+				return false
+			}
+			v.SetMapIndex(kv, xv)
+			return true
+		})
+		if err != nil {
+			return reflect.Value{}, err
+		}
+	case reflect.Struct:
+		hm, ok := val.(types.HashMap)
+		if !ok {
+			return cannotConvert(val, t)
+		}
+		var err error
+		hm.Val.Range(func(key, x types.ParrotType) bool {
+			k, _ := key.(string)
+			f, ok := t.FieldByNameFunc(func(name string) bool {
+				return strings.EqualFold(name, goName(strings.TrimPrefix(k, "\u029e")))
+			})
+			if !ok || f.PkgPath != "" {
+				err = fmt.Errorf("%s has no exported field %s", t, k)
+				return false
+			}
+			var xv reflect.Value
+			if xv, err = ToGo(x, f.Type); err != nil {
+				return false
+			}
+			v.FieldByIndex(f.Index).Set(xv)
+			return true
+		})
+		if err != nil {
+			return reflect.Value{}, err
+		}
+	case reflect.Func:
+		if !types.ParrotFunc_Q(val) && !types.Func_Q(val) {
+			return cannotConvert(val, t)
+		}
+		return makeFunc(val, t), nil
+	default:
+		return cannotConvert(val, t)
+	}
+	return v, nil
+}
+
+// naturalType is the Go type a Parrot value converts to when the target is
+// an empty interface.
+func naturalType(val types.ParrotType) reflect.Type {
+	switch val.(type) {
+	case types.Int64, int:
+		return reflect.TypeOf(int64(0))
+	case types.Float64:
+		return reflect.TypeOf(float64(0))
+	case types.Char:
+		return reflect.TypeOf(rune(0))
+	case types.BigInt:
+		return bigIntType
+	case types.Ratio:
+		return bigRatType
+	case types.Regex:
+		return regexType
+	case types.Symbol:
+		return reflect.TypeOf("")
+	case types.List, types.Vector, types.Set:
+		return reflect.TypeOf([]interface{}{})
+	case types.HashMap:
+		for _, k := range val.(types.HashMap).Val.Keys() {
+			if _, ok := k.(string); !ok {
+				return reflect.TypeOf(map[interface{}]interface{}{})
+			}
+		}
+		return reflect.TypeOf(map[string]interface{}{})
+	}
+	return reflect.TypeOf(val)
+}
+
+func toInt(val types.ParrotType) (int64, bool) {
+	switch tval := val.(type) {
+	case types.Int64:
+		return tval.Val, true
+	case int:
+		return int64(tval), true
+	case types.Char:
+		return int64(tval.Val), true
+	case types.BigInt:
+		if tval.Val.IsInt64() {
+			return tval.Val.Int64(), true
+		}
+	}
+	return 0, false
+}
+
+func cannotConvert(val types.ParrotType, t reflect.Type) (reflect.Value, error) {
+	if val == nil {
+		return reflect.Value{}, fmt.Errorf("cannot use nil as Go %s", t)
+	}
+	return reflect.Value{}, fmt.Errorf("cannot use %T as Go %s", val, t)
+}
+
+// makeFunc turns a Parrot function into a Go function of type t.
+func makeFunc(fn types.ParrotType, t reflect.Type) reflect.Value {
+	return reflect.MakeFunc(t, func(in []reflect.Value) []reflect.Value {
+		args := make([]types.ParrotType, len(in))
+		for i, arg := range in {
+			args[i] = valueToParrot(arg)
+		}
+		res, e := types.Apply(fn, args, false)
+		out := make([]reflect.Value, t.NumOut())
+		for i := range out {
+			out[i] = reflect.Zero(t.Out(i))
+		}
+		last := t.NumOut() - 1
+		if e != nil {
+			if last >= 0 && t.Out(last) == errorType {
+				out[last] = reflect.ValueOf(&e).Elem()
+				return out
+			}
+			panic(e)
+		}
+		if last >= 0 && t.Out(0) != errorType {
+			v, e := ToGo(res, t.Out(0))
+			if e != nil {
+				if t.Out(last) == errorType {
+					out[last] = reflect.ValueOf(&e).Elem()
+					return out
+				}
+				panic(e)
+			}
+			out[0] = v
+		}
+		return out
+	})
+}
+
+// goName turns a kebab-case Parrot name into a Go name: write-string
+// becomes WriteString.
+func goName(name string) string {
+	parts := strings.Split(name, "-")
+	for i, part := range parts {
+		if part != "" {
+			r := []rune(part)
+			r[0] = unicode.ToUpper(r[0])
+			parts[i] = string(r)
+		}
+	}
+	return strings.Join(parts, "")
+}
@@ -0,0 +1,187 @@
+package interop
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sllt/parrot/printer"
+	"github.com/sllt/parrot/types"
+)
+
+type point struct {
+	X, Y int
+	Name string
+}
+
+func (p point) Sum() int { return p.X + p.Y }
+
+func (p *point) Move(dx, dy int) { p.X += dx; p.Y += dy }
+
+func (p *point) WriteName(name string) error {
+	if name == "" {
+		return errors.New("empty name")
+	}
+	p.Name = name
+	return nil
+}
+
+func TestToParrot(t *testing.T) {
+	for _, c := range []struct {
+		val  interface{}
+		want string
+	}{
+		{nil, "nil"},
+		{true, "true"},
+		{int8(-3), "-3"},
+		{uint16(7), "7"},
+		{uint64(math.MaxInt64), "9223372036854775807"},
+		{uint64(math.MaxUint64), "18446744073709551615N"},
+		{float32(1.5), "1.5"},
+		{"s", `"s"`},
+		{[]byte("bytes"), `"bytes"`},
+		{[]int{1, 2}, "[1 2]"},
+		{[2]string{"a", "b"}, `["a" "b"]`},
+		{map[string]int{"a": 1}, `{"a" 1}`},
+		{big.NewInt(5), "5N"},
+		{big.NewRat(1, 3), "1/3"},
+		{[]interface{}{1, nil, []string{"x"}}, `[1 nil ["x"]]`},
+		{types.Int64{4}, "4"},
+	} {
+		if got := printer.PrintStr(ToParrot(c.val), true); got != c.want {
+			t.Errorf("ToParrot(%#v) = %s, want %s", c.val, got, c.want)
+		}
+	}
+	obj, ok := ToParrot(point{1, 2, ""}).(types.GoObject)
+	if !ok {
+		t.Fatalf("a struct is not kept as a GoObject")
+	}
+	if _, ok := obj.Val.(*point); !ok {
+		t.Errorf("a struct is kept as %T, want *point so that pointer methods can be called", obj.Val)
+	}
+}
+
+func TestToGo(t *testing.T) {
+	for _, c := range []struct {
+		val  types.ParrotType
+		typ  interface{}
+		want interface{}
+	}{
+		{types.Int64{3}, int8(0), int8(3)},
+		{types.Int64{3}, float64(0), float64(3)},
+		{ToParrot(uint64(math.MaxUint64)), uint64(0), uint64(math.MaxUint64)},
+		{types.NewRatio(big.NewRat(1, 2)), float64(0), 0.5},
+		{"s", "", "s"},
+		{types.Symbol{"sym"}, "", "sym"},
+		{types.Char{'é'}, "", "é"},
+		{"bytes", []byte(nil), []byte("bytes")},
+		{types.NewVector(types.Int64{1}, types.Int64{2}), []int(nil), []int{1, 2}},
+		{types.NewVector("a", "b"), [2]string{}, [2]string{"a", "b"}},
+		{nil, []int(nil), []int(nil)},
+	} {
+		v, e := ToGo(c.val, reflect.TypeOf(c.typ))
+		if e != nil {
+			t.Errorf("ToGo(%v, %T): %v", c.val, c.typ, e)
+		} else if !reflect.DeepEqual(v.Interface(), c.want) {
+			t.Errorf("ToGo(%v, %T) = %#v, want %#v", c.val, c.typ, v.Interface(), c.want)
+		}
+	}
+	hm, _ := types.NewHashMap(types.List{[]types.ParrotType{"ʞx", types.Int64{1}, "ʞname", "p"}, nil})
+	v, e := ToGo(hm, reflect.TypeOf(point{}))
+	if e != nil || v.Interface() != (point{1, 0, "p"}) {
+		t.Errorf("ToGo of a map to a struct = %v, %v", v, e)
+	}
+	for _, c := range []struct {
+		val types.ParrotType
+		typ interface{}
+	}{
+		{types.Int64{300}, int8(0)},
+		{types.Int64{-1}, uint(0)},
+		{ToParrot(uint64(math.MaxUint64)), uint32(0)},
+		{ToParrot(uint64(math.MaxUint64)), int64(0)},
+		{"s", 0},
+		{types.Int64{1}, ""},
+		{types.NewVector("a"), []int(nil)},
+		{types.NewVector("a", "b", "c"), [2]string{}},
+	} {
+		if _, e := ToGo(c.val, reflect.TypeOf(c.typ)); e == nil {
+			t.Errorf("ToGo(%v, %T) did not fail", c.val, c.typ)
+		}
+	}
+}
+
+func TestWrapFunc(t *testing.T) {
+	call := func(fn interface{}, args ...types.ParrotType) (string, error) {
+		f, e := WrapFunc(fn)
+		if e != nil {
+			return "", e
+		}
+		res, e := f.Fn(args)
+		return printer.PrintStr(res, true), e
+	}
+	for _, c := range []struct {
+		fn   interface{}
+		args []types.ParrotType
+		want string
+	}{
+		{strings.ToUpper, []types.ParrotType{"abc"}, `"ABC"`},
+		{strings.Join, []types.ParrotType{types.NewVector("a", "b"), "-"}, `"a-b"`},
+		{func(xs ...int) int { return len(xs) }, []types.ParrotType{types.Int64{1}, types.Int64{2}}, "2"},
+		{func() (int, string) { return 1, "a" }, nil, `[1 "a"]`},
+		{func() (int, error) { return 1, nil }, nil, "1"},
+		{func() {}, nil, "nil"},
+		{func(f func(int) int) int { return f(20) }, []types.ParrotType{types.Func{func(a []types.ParrotType) (types.ParrotType, error) {
+			return types.Int64{a[0].(types.Int64).Val + 1}, nil
+		}, nil, false, nil}}, "21"},
+	} {
+		if got, e := call(c.fn, c.args...); e != nil || got != c.want {
+			t.Errorf("calling %T with %v = %s, %v, want %s", c.fn, c.args, got, e, c.want)
+		}
+	}
+	for _, c := range []struct {
+		fn   interface{}
+		args []types.ParrotType
+		want string
+	}{
+		{strings.ToUpper, nil, "wrong number of args (0)"},
+		{strings.ToUpper, []types.ParrotType{types.Int64{1}}, "argument 0: cannot use"},
+		{func() (int, error) { return 0, errors.New("failed") }, nil, "failed"},
+		{func() { panic("oops") }, nil, "panic in Go call: oops"},
+		{42, nil, "cannot wrap int"},
+	} {
+		if _, e := call(c.fn, c.args...); e == nil || !strings.Contains(e.Error(), c.want) {
+			t.Errorf("calling %T: got %v, want an error containing %q", c.fn, e, c.want)
+		}
+	}
+}
+
+func TestMethodsAndFields(t *testing.T) {
+	obj := ToParrot(point{1, 2, ""})
+	if _, e := CallMethod(obj, "move", []types.ParrotType{types.Int64{10}, types.Int64{20}}); e != nil {
+		t.Fatal(e)
+	}
+	if res, e := CallMethod(obj, "Sum", nil); e != nil || res != (types.Int64{33}) {
+		t.Errorf("Sum = %v, %v, want 33", res, e)
+	}
+	if _, e := CallMethod(obj, "write-name", []types.ParrotType{"p"}); e != nil {
+		t.Fatal(e)
+	}
+	if res, e := Field(obj, "Name"); e != nil || res != "p" {
+		t.Errorf("Name = %v, %v, want \"p\"", res, e)
+	}
+	if _, e := CallMethod(obj, "write-name", []types.ParrotType{""}); e == nil || e.Error() != "empty name" {
+		t.Errorf("an error result is returned as the error of the call, got %v", e)
+	}
+	if _, e := CallMethod(obj, "Fly", nil); e == nil || !strings.Contains(e.Error(), "has no method Fly") {
+		t.Errorf("calling a missing method: %v", e)
+	}
+	if _, e := CallMethod(nil, "Sum", nil); e == nil {
+		t.Error("called a method on nil")
+	}
+	if _, e := Field(obj, "Z"); e == nil {
+		t.Error("read a missing field")
+	}
+}
@@ -0,0 +1,45 @@
+package parrot
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+type account struct {
+	Owner   string
+	Balance int
+}
+
+func (a *account) Deposit(n int) int {
+	a.Balance += n
+	return a.Balance
+}
+
+func TestDefine(t *testing.T) {
+	for name, opts := range backends {
+		it := New(opts...)
+		it.Define("strings/upper", strings.ToUpper)
+		it.Define("new-buffer", func() *bytes.Buffer { return &bytes.Buffer{} })
+		it.Define("acct", &account{"ann", 10})
+		it.Define("limit", 3)
+		t.Run(name, func(t *testing.T) {
+			expectIn(t, it, map[string]string{
+				`(strings/upper "parrot")`: `"PARROT"`,
+				`(let [b (new-buffer)] (. b WriteString "hi") (. b write-string "!") (. b String))`: `"hi!"`,
+				`(.- acct Owner)`: `"ann"`,
+				`(+ limit 1)`:     "4",
+			})
+			expectIn(t, it, map[string]string{`(. acct Deposit 5)`: "15"})
+			expectIn(t, it, map[string]string{`(.- acct Balance)`: "15"})
+			for src, want := range map[string]string{
+				`(strings/upper 1)`:   "argument 0: cannot use",
+				`(. acct Withdraw 1)`: "has no method Withdraw",
+			} {
+				if _, e := it.EvalString(src); e == nil || !strings.Contains(e.Error(), want) {
+					t.Errorf("%s: got %v, want an error containing %q", src, e, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,315 @@
+package parrot
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+import (
+	"github.com/sllt/parrot/core"
+	. "github.com/sllt/parrot/env"
+	"github.com/sllt/parrot/interop"
+	"github.com/sllt/parrot/printer"
+	"github.com/sllt/parrot/reader"
+	. "github.com/sllt/parrot/types"
+)
+
+// prelude is evaluated in the core namespace of every interpreter.
+var prelude = []string{
+	"(def *host-language* \"go\")",
+	"(def not (fn (a) (if a false true)))",
+	"(defmacro cond (fn (& xs) (if (> (count xs) 0) (list 'if (first xs) (if (> (count xs) 1) (nth xs 1) (throw \"odd number of forms to cond\")) (cons 'cond (rest (rest xs)))))))",
+	"(def *gensym-counter* (atom 0))",
+	"(def gensym (fn [] (symbol (str \"G__\" (swap! *gensym-counter* (fn [x] (+ 1 x)))))))",
+	"(defmacro or (fn (& xs) (if (empty? xs) nil (if (= 1 (count xs)) (first xs) (let (condvar (gensym)) `(let (~condvar ~(first xs)) (if ~condvar ~condvar (or ~@(rest xs)))))))))",
+	"(defmacro defn (fn [name & fdecl] `(def ~name (fn ~name ~@fdecl))))",
+	"(defmacro reset (fn [& body] `(reset* (fn [] ~@body))))",
+	"(defmacro shift (fn [k & body] `(shift* (fn [~k] ~@body))))",
+	"(defmacro lazy-seq (fn [& body] `(lazy-seq* (fn [] ~@body))))",
+	"(defmacro lazy-cat (fn [& colls] `(concat ~@(map (fn [c] `(lazy-seq ~c)) colls))))",
+	"(defmacro for (fn [bindings body] (for* bindings body)))",
+	"(defmacro doseq (fn [bindings & body] `(dorun (for ~bindings (do ~@body)))))",
+	"(defn curry [func args] (fn [arg] (apply func (cons args (list arg)))))",
+}
+
+// Interpreter is an isolated Parrot runtime. Each interpreter has its own
+// namespaces, module search path and standard streams, so several of them
+// can run side by side in one program.
+type Interpreter struct {
+	Namespaces  *Registry
+	Modules     *ModuleLoader
+	Stdout      io.Writer
+	Stderr      io.Writer
+	Stdin       io.Reader
+	host        *core.Host
+	searchPath  []string
+	ctx         context.Context
+	limits      Limits
+	bytecode    bool
+	pretty      int // width Rep pretty prints in, or 0
+	printLength int // items of each lazy seq Rep prints, or 0 for all
+}
+
+// Option configures an Interpreter created by New.
+type Option func(*Interpreter)
+
+// WithStdout makes println and prn write to w instead of os.Stdout.
+func WithStdout(w io.Writer) Option {
+	return func(it *Interpreter) { it.Stdout = w }
+}
+
+// WithStderr makes eprintln write to w instead of os.Stderr.
+func WithStderr(w io.Writer) Option {
+	return func(it *Interpreter) { it.Stderr = w }
+}
+
+// WithStdin makes readline read from r instead of os.Stdin.
+func WithStdin(r io.Reader) Option {
+	return func(it *Interpreter) { it.Stdin = r }
+}
+
+// WithCapabilities sets what the builtins of the interpreter may do to the
+// host. Builtins that need a capability that is not in caps, such as system
+// without core.Exec, fail with a *core.PermissionError. Interpreters have
+// core.AllCapabilities unless this option is given.
+func WithCapabilities(caps core.Capability) Option {
+	return func(it *Interpreter) { it.host.Capabilities = caps }
+}
+
+// WithContext makes the interpreter stop all evaluation, including
+// goroutines started with go, once ctx is done.
+func WithContext(ctx context.Context) Option {
+	return func(it *Interpreter) { it.ctx = ctx }
+}
+
+// WithLimits bounds the steps, depth and memory of each evaluation started
+// from Go. Evaluation that exceeds them fails with a *types.LimitError.
+func WithLimits(limits Limits) Option {
+	return func(it *Interpreter) { it.limits = limits }
+}
+
+// WithBytecode makes the interpreter compile the forms it evaluates to
+// bytecode and run them on the virtual machine of package vm, instead of
+// compiling them to Go closures.
+func WithBytecode() Option {
+	return func(it *Interpreter) { it.bytecode = true }
+}
+
+// WithPrettyPrint makes Rep pretty print the values it returns, in lines
+// of at most width columns, as the REPL does with -pprint.
+func WithPrettyPrint(width int) Option {
+	return func(it *Interpreter) { it.pretty = width }
+}
+
+// WithIndentRules adds rules to those the interpreter lays out code by when
+// it pretty prints, with Rep and with pprint. Each maps the symbol a list
+// starts with to how many of its args stay on the first line.
+func WithIndentRules(rules map[string]int) Option {
+	return func(it *Interpreter) {
+		for k, n := range rules {
+			it.host.IndentRules[k] = n
+		}
+	}
+}
+
+// DefaultPrintLength is how many items of each lazy seq Rep prints unless
+// WithPrintLength says otherwise: all of them.
+const DefaultPrintLength = 0
+
+// WithPrintLength makes Rep print at most n items of each lazy seq in the
+// values it returns, followed by "...". Returning an infinite lazy seq then
+// prints its first items instead of running forever. Lists, vectors and
+// maps are printed whole. 0 prints every item.
+func WithPrintLength(n int) Option {
+	return func(it *Interpreter) { it.printLength = n }
+}
+
+// WithSearchPath replaces DefaultSearchPath as the directories required
+// namespaces are looked up in.
+func WithSearchPath(dirs ...string) Option {
+	return func(it *Interpreter) { it.searchPath = dirs }
+}
+
+// New returns an interpreter whose core namespace holds the builtins and
+// the prelude, and whose current namespace is user.
+func New(opts ...Option) *Interpreter {
+	it := &Interpreter{Stdout: os.Stdout, Stderr: os.Stderr, Stdin: os.Stdin,
+		ctx: context.Background(), printLength: DefaultPrintLength}
+	it.host = &core.Host{Capabilities: core.AllCapabilities, IndentRules: printer.DefaultIndentRules()}
+	for _, opt := range opts {
+		opt(it)
+	}
+	it.host.Stdout, it.host.Stderr, it.host.Stdin = it.Stdout, it.Stderr, it.Stdin
+	if it.searchPath == nil {
+		it.searchPath = DefaultSearchPath()
+	}
+	it.Namespaces = NewRegistry(NewBudget(it.ctx, it.limits))
+	it.host.Budget = it.Namespaces.Budget
+	it.Namespaces.Eval = Eval
+	if it.bytecode {
+		it.Namespaces.Eval = EvalBytecode
+	}
+	it.Modules = NewModuleLoader(it.Namespaces, it.searchPath, it.host)
+	it.Namespaces.Loader = it.Modules.Load
+
+	root := it.Namespaces.Core.Env
+	builtins := []map[string]ParrotType{
+		core.NS,
+		core.HostNS(it.host),
+		namespaceFunctions(it.Namespaces),
+	}
+	for _, ns := range builtins {
+		for k, v := range ns {
+			if fn, ok := v.(Func); ok {
+				root.Set(Symbol{k}, fn)
+				continue
+			}
+			root.Set(Symbol{k}, Func{v.(func([]ParrotType) (ParrotType, error)), nil, false, nil})
+		}
+	}
+	// parrot.string is defined here rather than loaded from a file, so
+	// requiring it finds it already there
+	strs := it.Namespaces.FindOrCreate("parrot.string").Env
+	for k, v := range core.StringNS {
+		strs.Set(Symbol{k}, Func{v.(func([]ParrotType) (ParrotType, error)), nil, false, nil})
+	}
+	root.Set(Symbol{"eval"}, BudgetFunc(func(a []ParrotType, b *Budget) (ParrotType, error) {
+		return it.Namespaces.Eval(a[0], it.Env().WithBudget(b))
+	}, it.Namespaces.Budget))
+	root.Set(Symbol{"disassemble"}, Func{func(a []ParrotType) (ParrotType, error) {
+		fn, ok := a[0].(ParrotFunc)
+		if !ok {
+			return nil, errors.New("disassemble requires a fn")
+		}
+		return Disassemble(fn)
+	}, nil, false, nil})
+	root.Set(Symbol{"load-file"}, BudgetFunc(func(a []ParrotType, b *Budget) (ParrotType, error) {
+		if e := it.host.Check(core.FSRead, "load-file"); e != nil {
+			return nil, e
+		}
+		return loadFile(a[0].(string), it.Namespaces, b)
+	}, it.Namespaces.Budget))
+	root.Set(Symbol{"*ARGV*"}, List{})
+	root.Set(Symbol{"*out*"}, NewWriter("*out*", it.Stdout))
+	root.Set(Symbol{"*err*"}, NewWriter("*err*", it.Stderr))
+
+	user := it.Namespaces.Current
+	it.Namespaces.Current = it.Namespaces.Core
+	for _, src := range prelude {
+		it.Rep(src)
+	}
+	it.Namespaces.Current = user
+	return it
+}
+
+// Env returns the env of the current namespace.
+func (it *Interpreter) Env() EnvType {
+	return it.Namespaces.Current.Env
+}
+
+// start begins an evaluation under ctx and returns its budget and the
+// function that ends it. Every evaluation started from Go has a budget of
+// its own, even one nested in another, such as when a Go function calls
+// back into the interpreter, or one running alongside another.
+func (it *Interpreter) start(ctx context.Context) (*Budget, func()) {
+	return it.Namespaces.Budget.Evaluation(ctx)
+}
+
+// Eval evaluates a form in the current namespace.
+func (it *Interpreter) Eval(form ParrotType) (ParrotType, error) {
+	return it.EvalContext(it.ctx, form)
+}
+
+// EvalContext is like Eval, but fails with ctx.Err() once ctx is done.
+func (it *Interpreter) EvalContext(ctx context.Context, form ParrotType) (ParrotType, error) {
+	budget, end := it.start(ctx)
+	defer end()
+	return it.Namespaces.Eval(form, it.Env().WithBudget(budget))
+}
+
+// EvalString evaluates every form in src in the current namespace and
+// returns the value of the last one. Like LoadFile, it restores the
+// current namespace afterwards.
+func (it *Interpreter) EvalString(src string) (ParrotType, error) {
+	return it.EvalStringContext(it.ctx, src)
+}
+
+// EvalStringContext is like EvalString, but fails with ctx.Err() once ctx
+// is done.
+func (it *Interpreter) EvalStringContext(ctx context.Context, src string) (ParrotType, error) {
+	budget, end := it.start(ctx)
+	defer end()
+	return evalReader(strings.NewReader(src), "", it.Namespaces, budget)
+}
+
+// LoadFile evaluates every form of the named file.
+func (it *Interpreter) LoadFile(file string) (ParrotType, error) {
+	return it.LoadFileContext(it.ctx, file)
+}
+
+// LoadFileContext is like LoadFile, but fails with ctx.Err() once ctx is
+// done.
+func (it *Interpreter) LoadFileContext(ctx context.Context, file string) (ParrotType, error) {
+	budget, end := it.start(ctx)
+	defer end()
+	return loadFile(file, it.Namespaces, budget)
+}
+
+// CompileFile compiles the named source file to bytecode in out, which
+// LoadFile then runs without reading and expanding the source again. The
+// forms of the file are run as they are compiled.
+func (it *Interpreter) CompileFile(file, out string) error {
+	budget, end := it.start(it.ctx)
+	defer end()
+	return compileFile(file, out, it.Namespaces, budget)
+}
+
+// Rep reads and evaluates every form in str and prints the value of the
+// last one. Unlike EvalString, an ns form in str changes the current
+// namespace for good, as it does at the REPL.
+func (it *Interpreter) Rep(str string) (ParrotType, error) {
+	var exp ParrotType
+	rdr := reader.NewReader(strings.NewReader(str), "")
+	read := 0
+	for {
+		form, e := rdr.Read()
+		if e == io.EOF {
+			break
+		}
+		if e != nil {
+			return nil, e
+		}
+		if exp, e = it.Eval(form); e != nil {
+			return nil, e
+		}
+		read++
+	}
+	if read == 0 {
+		return nil, errors.New("<empty line>")
+	}
+	if it.pretty > 0 {
+		exp, e := Abbreviate(exp, it.printLength)
+		if e != nil {
+			return nil, e
+		}
+		return printer.Pretty(exp, true, it.pretty, it.host.IndentRules), nil
+	}
+	return PrintN(exp, it.printLength)
+}
+
+// Define makes a Go value available to Parrot code under name, converting
+// it with interop.ToParrot: functions become callable, structs and pointers
+// expose their methods and fields. A name of the form ns/x defines x in the
+// namespace ns, creating it if needed; other names go into the core
+// namespace.
+func (it *Interpreter) Define(name string, val interface{}) {
+	env := it.Namespaces.Core.Env
+	if i := strings.Index(name, "/"); i > 0 && i < len(name)-1 {
+		env = it.Namespaces.FindOrCreate(name[:i]).Env
+		name = name[i+1:]
+	}
+	env.Set(Symbol{name}, interop.ToParrot(val))
+}
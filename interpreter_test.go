@@ -0,0 +1,66 @@
+package parrot
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sllt/parrot/printer"
+)
+
+func TestInterpretersAreIndependent(t *testing.T) {
+	var outA, outB bytes.Buffer
+	a, b := New(WithStdout(&outA)), New(WithStdout(&outB))
+	if _, e := a.EvalString(`(def x :a) (def + -) (ns shared) (def y 1) (println "from a")`); e != nil {
+		t.Fatal(e)
+	}
+	b.Define("x", "from go")
+	expectIn(t, a, map[string]string{`x`: ":a", `(+ 3 1)`: "2", `shared/y`: "1"})
+	expectIn(t, b, map[string]string{`x`: `"from go"`, `(+ 3 1)`: "4"})
+	if _, e := b.EvalString(`shared/y`); e == nil {
+		t.Error("a namespace defined in one interpreter is visible in another")
+	}
+	if _, e := b.EvalString(`(println "from b")`); e != nil {
+		t.Fatal(e)
+	}
+	if outA.String() != "from a\n" || outB.String() != "from b\n" {
+		t.Errorf("interpreters wrote %q and %q", outA.String(), outB.String())
+	}
+}
+
+func TestStandardStreams(t *testing.T) {
+	var out, errOut bytes.Buffer
+	it := New(WithStdout(&out), WithStderr(&errOut), WithStdin(strings.NewReader("typed\n")))
+	expectIn(t, it, map[string]string{`(readline "> ")`: `"typed"`})
+	if _, e := it.EvalString(`(prn "p") (eprintln "e")`); e != nil {
+		t.Fatal(e)
+	}
+	if !strings.HasSuffix(out.String(), "\"p\"\n") || errOut.String() != "e\n" {
+		t.Errorf("wrote %q and %q", out.String(), errOut.String())
+	}
+}
+
+// TestInterpretersInParallel runs interpreters on several goroutines at
+// once. Run it with -race.
+func TestInterpretersInParallel(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			it := New()
+			src := fmt.Sprintf(`(def n %d) (defn f [x] (* x n)) (reduce + (map f (range 100)))`, i)
+			res, e := it.EvalString(src)
+			if e != nil {
+				t.Error(e)
+				return
+			}
+			if got, want := printer.PrintStr(res, true), fmt.Sprint(4950*i); got != want {
+				t.Errorf("interpreter %d: got %s, want %s", i, got, want)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
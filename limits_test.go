@@ -0,0 +1,173 @@
+package parrot
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/sllt/parrot/types"
+)
+
+func TestLimits(t *testing.T) {
+	for name, opts := range backends {
+		t.Run(name, func(t *testing.T) {
+			var le *LimitError
+			e := runError(t, `(def f (fn [] (f))) (f)`, append(opts, WithLimits(Limits{MaxSteps: 1000}))...)
+			if !errors.As(e, &le) || le.Limit != "steps" {
+				t.Errorf("got %v, want a steps LimitError", e)
+			}
+			e = runError(t, `(def f (fn [n] (+ 1 (f n)))) (f 1)`, append(opts, WithLimits(Limits{MaxDepth: 50}))...)
+			if !errors.As(e, &le) || le.Limit != "depth" {
+				t.Errorf("got %v, want a depth LimitError", e)
+			}
+			// try does not catch running out of the budget
+			e = runError(t, `(try (loop [] (recur)) (catch e :caught))`, append(opts, WithLimits(Limits{MaxSteps: 1000}))...)
+			if !errors.As(e, &le) {
+				t.Errorf("got %v, want a LimitError", e)
+			}
+			expect(t, map[string]string{
+				`(loop [i 0] (if (< i 100) (recur (+ i 1)) i))`: "100",
+				// tail calls do not count against the depth
+				`(defn f [n] (if (= n 0) :done (f (- n 1)))) (f 1000)`: ":done",
+			}, append(opts, WithLimits(Limits{MaxSteps: 100000, MaxDepth: 50}))...)
+		})
+	}
+}
+
+// TestStepsPerEvaluation checks that each evaluation started from Go gets
+// the whole step budget, however many ran before it.
+func TestStepsPerEvaluation(t *testing.T) {
+	it := New(WithLimits(Limits{MaxSteps: 5000}))
+	for i := 0; i < 5; i++ {
+		if _, e := it.EvalString(`(loop [i 0] (if (< i 200) (recur (+ i 1)) i))`); e != nil {
+			t.Fatalf("evaluation %d: %v", i, e)
+		}
+	}
+	// a Go function calling back into the interpreter starts an evaluation
+	// of its own, but the steps of the one calling it still add up
+	it.Define("callback", func() (interface{}, error) {
+		return it.EvalString(`(loop [i 0] (if (< i 200) (recur (+ i 1)) i))`)
+	})
+	var le *LimitError
+	if _, e := it.EvalString(`(loop [n 0] (callback) (recur (+ n 1)))`); !errors.As(e, &le) {
+		t.Errorf("got %v, want a LimitError", e)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	for _, bytecode := range []bool{false, true} {
+		for _, src := range []string{
+			`(loop [] (recur))`,
+			`(receive (makeChan))`,
+			`(send (makeChan) 1)`,
+		} {
+			opts := []Option{}
+			if bytecode {
+				opts = append(opts, WithBytecode())
+			}
+			it := New(opts...)
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			done := make(chan error, 1)
+			go func() {
+				_, e := it.EvalStringContext(ctx, src)
+				done <- e
+			}()
+			select {
+			case e := <-done:
+				if !errors.Is(e, context.DeadlineExceeded) {
+					t.Errorf("%s: got %v, want context.DeadlineExceeded", src, e)
+				}
+			case <-time.After(2 * time.Second):
+				t.Errorf("%s: not stopped by the timeout", src)
+			}
+			cancel()
+		}
+	}
+}
+
+// TestEvaluationsApart checks that each evaluation started from Go stops
+// when its own context is done, whatever other evaluations run alongside
+// it or around it.
+func TestEvaluationsApart(t *testing.T) {
+	for name, opts := range backends {
+		t.Run(name, func(t *testing.T) {
+			it := New(opts...)
+			timeout := func(src string) {
+				ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+				defer cancel()
+				done := make(chan error, 1)
+				go func() {
+					_, e := it.EvalStringContext(ctx, src)
+					done <- e
+				}()
+				select {
+				case e := <-done:
+					if !errors.Is(e, context.DeadlineExceeded) {
+						t.Errorf("%s: got %v, want context.DeadlineExceeded", src, e)
+					}
+				case <-time.After(3 * time.Second):
+					t.Errorf("%s: not stopped by its timeout", src)
+				}
+			}
+			if _, e := it.EvalString(`(defn spin [& _] (loop [] (recur)))`); e != nil {
+				t.Fatal(e)
+			}
+
+			// alongside an evaluation without a deadline
+			ctx, cancel := context.WithCancel(context.Background())
+			running := make(chan error, 1)
+			go func() {
+				_, e := it.EvalContext(ctx, List{[]ParrotType{Symbol{"spin"}, nil}, nil})
+				running <- e
+			}()
+			timeout(`(spin nil)`)
+			// a fn defined earlier and called back by a builtin
+			timeout(`(reduce spin 0 [1])`)
+			timeout(`(receive (makeChan))`)
+			cancel()
+			if e := <-running; !errors.Is(e, context.Canceled) {
+				t.Errorf("got %v, want context.Canceled", e)
+			}
+
+			// nested in another evaluation
+			it.Define("nested", func() (interface{}, error) {
+				ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+				defer cancel()
+				_, e := it.EvalStringContext(ctx, `(spin nil)`)
+				if !errors.Is(e, context.DeadlineExceeded) {
+					t.Errorf("nested: got %v, want context.DeadlineExceeded", e)
+				}
+				return nil, nil
+			})
+			if _, e := it.EvalString(`(nested)`); e != nil {
+				t.Error(e)
+			}
+
+			// fns outlive the deadline of the evaluation that made them
+			ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+			_, e := it.EvalStringContext(ctx, `(def inc1 (fn [x] (+ x 1)))`)
+			cancel()
+			if e != nil {
+				t.Fatal(e)
+			}
+			time.Sleep(20 * time.Millisecond)
+			if got, e := it.Rep(`(map inc1 [1 2])`); e != nil || got != "(2 3)" {
+				t.Errorf("got %v, %v, want (2 3)", got, e)
+			}
+		})
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	for name, opts := range backends {
+		t.Run(name, func(t *testing.T) {
+			var le *LimitError
+			e := runError(t, `(loop [xs []] (recur (conj xs (vec (range 100)))))`,
+				append(opts, WithLimits(Limits{MaxMemory: 64 << 20}))...)
+			if !errors.As(e, &le) || le.Limit != "memory" {
+				t.Errorf("got %v, want a memory LimitError", e)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package parrot
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sllt/parrot/printer"
+)
+
+// writeFile writes src to a file called name in a new temporary directory
+// and returns its path.
+func writeFile(t *testing.T, name, src string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if e := os.WriteFile(path, []byte(src), 0o644); e != nil {
+		t.Fatal(e)
+	}
+	return path
+}
+
+func TestLoadFileEvaluatesEachForm(t *testing.T) {
+	path := writeFile(t, "m.pr", `; a macro defined by one form applies to the next
+(defmacro unless (fn [c & body] `+"`"+`(if ~c nil (do ~@body))))
+(def a (unless false 1))
+(ns other)
+(def b (+ user/a 1))
+(println "loaded")
+[user/a b]
+`)
+	for name, opts := range backends {
+		var out bytes.Buffer
+		it := New(append([]Option{WithStdout(&out)}, opts...)...)
+		res, e := it.LoadFile(path)
+		if e != nil {
+			t.Fatalf("%s: %v", name, e)
+		}
+		if got := printer.PrintStr(res, true); got != "[1 2]" {
+			t.Errorf("%s: LoadFile = %s, want the value of the last form, [1 2]", name, got)
+		}
+		if out.String() != "loaded\n" {
+			t.Errorf("%s: printed %q", name, out.String())
+		}
+		if cur := it.Namespaces.Current.Name; cur != "user" {
+			t.Errorf("%s: the current namespace is %s after loading, want user", name, cur)
+		}
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	path := writeFile(t, "bad.pr", "(def before 1)\n\n  (undefined-thing 2)\n(def after 3)\n")
+	it := New()
+	_, e := it.LoadFile(path)
+	if e == nil || !strings.Contains(e.Error(), path+":3:3: in (undefined-thing 2)") {
+		t.Errorf("got %v, want an error at %s:3:3", e, path)
+	}
+	expectIn(t, it, map[string]string{`before`: "1"})
+	if _, e := it.EvalString(`after`); e == nil {
+		t.Error("forms after the failing one were evaluated")
+	}
+
+	path = writeFile(t, "unclosed.pr", "(def x 1)\n(def y")
+	if _, e := New().LoadFile(path); e == nil || !strings.Contains(e.Error(), "opened at "+path+":2:1") {
+		t.Errorf("got %v, want an unclosed list error", e)
+	}
+
+	path = writeFile(t, "empty.pr", "; nothing but a comment\n")
+	if res, e := New().LoadFile(path); e != nil || res != nil {
+		t.Errorf("loading a file without forms = %v, %v, want nil", res, e)
+	}
+}
+
+// expectIn is expect in an interpreter that already exists.
+func expectIn(t *testing.T, it *Interpreter, cases map[string]string) {
+	t.Helper()
+	for src, want := range cases {
+		res, e := it.EvalString(src)
+		if e != nil {
+			t.Errorf("%s: %v", src, e)
+		} else if got := printer.PrintStr(res, true); got != want {
+			t.Errorf("%s = %s, want %s", src, got, want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package parrot
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+import (
+	"github.com/sllt/parrot/core"
+	. "github.com/sllt/parrot/env"
+)
+
+// ModuleLoader finds the file that defines a namespace on a search path and
+// loads it into a registry. Each namespace is loaded at most once.
+type ModuleLoader struct {
+	Path    []string
+	reg     *Registry
+	host    *core.Host        // checked for FSRead before a file is read
+	loaded  map[string]string // namespace -> file it was loaded from
+	loading []string          // namespaces being loaded, outermost first
+}
+
+// DefaultSearchPath returns the directories listed in PARROT_PATH followed by
+// the working directory.
+func DefaultSearchPath() []string {
+	path := []string{}
+	for _, dir := range filepath.SplitList(os.Getenv("PARROT_PATH")) {
+		if dir != "" {
+			path = append(path, dir)
+		}
+	}
+	return append(path, ".")
+}
+
+// NewModuleLoader returns a loader of namespaces into reg. Loading a file
+// requires the FSRead capability of host, unless host is nil.
+func NewModuleLoader(reg *Registry, path []string, host *core.Host) *ModuleLoader {
+	return &ModuleLoader{Path: path, reg: reg, host: host, loaded: map[string]string{}}
+}
+
+// AddPath appends the dirs that are not on the search path yet.
+func (l *ModuleLoader) AddPath(dirs ...string) {
+outer:
+	for _, dir := range dirs {
+		for _, known := range l.Path {
+			if filepath.Clean(known) == filepath.Clean(dir) {
+				continue outer
+			}
+		}
+		l.Path = append(l.Path, dir)
+	}
+}
+
+// Resolve returns the first file on the search path that defines the
+// namespace called name.
+func (l *ModuleLoader) Resolve(name string) (string, error) {
+	rel := namespaceFile(name)
+	for _, dir := range l.Path {
+		file := filepath.Join(dir, rel)
+		if info, e := os.Stat(file); e == nil && !info.IsDir() {
+			return file, nil
+		}
+	}
+	return "", fmt.Errorf("namespace '%s' not found: no %s in search path %s",
+		name, rel, strings.Join(l.Path, string(filepath.ListSeparator)))
+}
+
+// Load loads the namespace called name unless it is loaded already or was
+// defined without being loaded from a file. Requiring a namespace that is
+// still being loaded is an error naming the cycle.
+func (l *ModuleLoader) Load(name string) error {
+	for i, loading := range l.loading {
+		if loading == name {
+			cycle := append(append([]string{}, l.loading[i:]...), name)
+			return errors.New("circular require: " + strings.Join(cycle, " -> "))
+		}
+	}
+	if _, ok := l.loaded[name]; ok || l.reg.Find(name) != nil {
+		return nil
+	}
+	if l.host != nil {
+		if e := l.host.Check(core.FSRead, "require"); e != nil {
+			return e
+		}
+	}
+	file, e := l.Resolve(name)
+	if e != nil {
+		return e
+	}
+	l.loading = append(l.loading, name)
+	defer func() { l.loading = l.loading[:len(l.loading)-1] }()
+	if _, e := LoadFile(file, l.reg); e != nil {
+		l.reg.Remove(name)
+		return e
+	}
+	if l.reg.Find(name) == nil {
+		return fmt.Errorf("%s does not define namespace '%s'", file, name)
+	}
+	l.loaded[name] = file
+	return nil
+}
+
+// Loaded returns the file every loaded namespace was read from.
+func (l *ModuleLoader) Loaded() map[string]string {
+	loaded := map[string]string{}
+	for name, file := range l.loaded {
+		loaded[name] = file
+	}
+	return loaded
+}
@@ -0,0 +1,91 @@
+package parrot
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTree writes files, relative paths to their contents, under a new
+// temporary directory and returns it.
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, src := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if e := os.MkdirAll(filepath.Dir(path), 0o755); e != nil {
+			t.Fatal(e)
+		}
+		if e := os.WriteFile(path, []byte(src), 0o644); e != nil {
+			t.Fatal(e)
+		}
+	}
+	return dir
+}
+
+func TestRequireFromSearchPath(t *testing.T) {
+	first := writeTree(t, map[string]string{
+		"util/str_help.pr": `(ns util.str-help) (def loads (atom 0)) (swap! loads inc) (defn shout [s] (str s "!"))`,
+		"app.pr":           `(ns app (:require [util.str-help :as h])) (defn run [] (h/shout "hi"))`,
+	})
+	second := writeTree(t, map[string]string{
+		"util/str_help.pr": `(ns util.str-help) (defn shout [s] "shadowed")`,
+		"other.pr":         `(ns other)`,
+	})
+	for name, opts := range backends {
+		it := New(append([]Option{WithSearchPath(first, second)}, opts...)...)
+		expectIn(t, it, map[string]string{
+			`(require 'app) (app/run)`: `"hi!"`,
+			// each namespace is loaded once
+			`(require 'util.str-help) (require 'util.str-help) @util.str-help/loads`: "1",
+			// later directories are searched too
+			`(require 'other) :ok`: ":ok",
+		})
+		loaded := it.Modules.Loaded()
+		if want := filepath.Join(first, "util", "str_help.pr"); loaded["util.str-help"] != want {
+			t.Errorf("%s: util.str-help loaded from %s, want %s", name, loaded["util.str-help"], want)
+		}
+	}
+}
+
+func TestRequireErrors(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"a.pr":     `(ns a (:require b))`,
+		"b.pr":     `(ns b (:require c))`,
+		"c.pr":     `(ns c (:require a))`,
+		"wrong.pr": `(ns not-wrong)`,
+		"broken.pr": `(ns broken)
+(undefined-thing)`,
+	})
+	opt := WithSearchPath(dir)
+	expectError(t, map[string]string{
+		`(require 'a)`:       "circular require: a -> b -> c -> a",
+		`(require 'missing)`: "namespace 'missing' not found: no missing.pr in search path " + dir,
+		`(require 'wrong)`:   "does not define namespace 'wrong'",
+		`(require 'broken)`:  "'undefined-thing' not found",
+	}, opt)
+	// a namespace that failed to load is not left half defined
+	it := New(opt)
+	it.EvalString(`(require 'broken)`)
+	if it.Namespaces.Find("broken") != nil {
+		t.Error("broken is defined after failing to load")
+	}
+}
+
+func TestSearchPath(t *testing.T) {
+	t.Setenv("PARROT_PATH", "one"+string(filepath.ListSeparator)+"two")
+	if got := strings.Join(DefaultSearchPath(), " "); got != "one two ." {
+		t.Errorf("DefaultSearchPath() = %s, want one two .", got)
+	}
+	dir := writeTree(t, map[string]string{"late.pr": `(ns late) (def x 1)`})
+	it := New(WithSearchPath(t.TempDir()))
+	if _, e := it.EvalString(`(require 'late)`); e == nil {
+		t.Fatal("required a namespace that is not on the search path")
+	}
+	it.Modules.AddPath(dir, dir)
+	if len(it.Modules.Path) != 2 {
+		t.Errorf("AddPath added a directory twice: %v", it.Modules.Path)
+	}
+	expectIn(t, it, map[string]string{`(require 'late) late/x`: "1"})
+}
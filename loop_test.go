@@ -0,0 +1,28 @@
+package parrot
+
+import (
+	"testing"
+)
+
+func TestLoopRecur(t *testing.T) {
+	expectBoth(t, map[string]string{
+		`(loop [i 0 acc []] (if (< i 3) (recur (+ i 1) (conj acc i)) acc))`:  "[0 1 2]",
+		`((fn [n acc] (if (= n 0) acc (recur (- n 1) (+ acc n)))) 100000 0)`: "5000050000",
+		`(loop [i 0] (cond (= i 5) :five :else (recur (+ i 1))))`:            ":five",
+		`(loop [i 0] (let [j (+ i 1)] (if (< j 10) (recur j) j)))`:           "10",
+		`(loop [i 0] (do (+ 1 1) (if (< i 3) (recur (+ i 1)) i)))`:           "3",
+		`(loop [a 1 b a] [a b])`: "[1 1]",
+		`(loop [i 0] (if (< i 3) (recur (loop [j i] (if (< j 10) (recur (+ j 5)) j))) i))`: "10",
+		`(defn f [x & r] (if (empty? r) x (recur (+ x (first r)) (rest r)))) (f 1 2 3)`:    "6",
+		`(loop [] 1)`: "1",
+	})
+	expectErrorBoth(t, map[string]string{
+		`(loop [i 0] (+ 1 (recur i)))`:             "can only recur from tail position",
+		`(fn [x] (do (recur x) 1))`:                "can only recur from tail position",
+		`(recur 1)`:                                "can only recur from tail position",
+		`(loop [i 0] (try (recur 1) (catch e 1)))`: "can only recur from tail position",
+		`(loop [i 0] (fn [] (recur i)) (recur i))`: "recur expects 0 args, got 1",
+		`(loop [i 0] (recur))`:                     "recur expects 1 args, got 0",
+		`(loop [i] i)`:                             "even number of forms",
+	})
+}
@@ -0,0 +1,162 @@
+package parrot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+import (
+	. "github.com/sllt/parrot/env"
+	"github.com/sllt/parrot/printer"
+	. "github.com/sllt/parrot/types"
+)
+
+func keywordIs(obj ParrotType, name string) bool {
+	kw, _ := NewKeyword(name)
+	return obj == kw
+}
+
+func symbolNames(obj ParrotType) ([]string, error) {
+	slc, e := GetSlice(obj)
+	if e != nil {
+		return nil, e
+	}
+	names := []string{}
+	for _, sym := range slc {
+		if !Symbol_Q(sym) {
+			return nil, errors.New("expected a list of symbols")
+		}
+		names = append(names, sym.(Symbol).Val)
+	}
+	return names, nil
+}
+
+// requireSpec loads the namespace named by spec for ns. spec is a symbol or
+// a vector of a symbol followed by the options :as alias and
+// :refer [names] or :refer :all.
+func requireSpec(ns *Namespace, spec ParrotType) error {
+	if Symbol_Q(spec) {
+		_, e := ns.Registry().Require(spec.(Symbol).Val)
+		return e
+	}
+	slc, e := GetSlice(spec)
+	if e != nil || len(slc) == 0 || !Symbol_Q(slc[0]) {
+		return fmt.Errorf("invalid require spec %s", printer.PrintStr(spec, true))
+	}
+	if len(slc)%2 != 1 {
+		return fmt.Errorf("odd number of options in require spec %s", printer.PrintStr(spec, true))
+	}
+	target, e := ns.Registry().Require(slc[0].(Symbol).Val)
+	if e != nil {
+		return e
+	}
+	for i := 1; i < len(slc); i += 2 {
+		opt, val := slc[i], slc[i+1]
+		switch {
+		case keywordIs(opt, "as") && Symbol_Q(val):
+			ns.Alias(val.(Symbol).Val, target)
+		case keywordIs(opt, "refer") && keywordIs(val, "all"):
+			ns.Refer(target, nil)
+		case keywordIs(opt, "refer"):
+			names, e := symbolNames(val)
+			if e != nil {
+				return e
+			}
+			if e := ns.Refer(target, names); e != nil {
+				return e
+			}
+		default:
+			return fmt.Errorf("invalid require option %s %s", printer.PrintStr(opt, true), printer.PrintStr(val, true))
+		}
+	}
+	return nil
+}
+
+// evalNs implements (ns name docstring? (:require spec...)*). It switches the
+// current namespace, creating it if needed.
+func evalNs(args []ParrotType, env EnvType) error {
+	cur := NamespaceOf(env)
+	if cur == nil {
+		return errors.New("ns used outside of a namespace")
+	}
+	if len(args) == 0 || !Symbol_Q(args[0]) {
+		return errors.New("ns requires a namespace name")
+	}
+	reg := cur.Registry()
+	ns := reg.FindOrCreate(args[0].(Symbol).Val)
+	reg.Current = ns
+	for _, clause := range args[1:] {
+		if String_Q(clause) && !Keyword_Q(clause) {
+			continue
+		}
+		slc, e := GetSlice(clause)
+		if e != nil || len(slc) == 0 || !keywordIs(slc[0], "require") {
+			return fmt.Errorf("unsupported ns clause %s", printer.PrintStr(clause, true))
+		}
+		for _, spec := range slc[1:] {
+			if e := requireSpec(ns, spec); e != nil {
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+// namespaceFile maps a namespace name to the file that defines it: a.b-c is
+// defined in a/b_c.pr.
+func namespaceFile(name string) string {
+	return strings.Replace(strings.Replace(name, ".", "/", -1), "-", "_", -1) + ".pr"
+}
+
+// namespaceFunctions returns the builtins that manage the namespaces of reg.
+func namespaceFunctions(reg *Registry) map[string]ParrotType {
+	return map[string]ParrotType{
+		"in-ns": func(a []ParrotType) (ParrotType, error) {
+			if len(a) != 1 || !Symbol_Q(a[0]) {
+				return nil, errors.New("in-ns requires a symbol")
+			}
+			reg.Current = reg.FindOrCreate(a[0].(Symbol).Val)
+			return nil, nil
+		},
+		"require": func(a []ParrotType) (ParrotType, error) {
+			for _, spec := range a {
+				if e := requireSpec(reg.Current, spec); e != nil {
+					return nil, e
+				}
+			}
+			return nil, nil
+		},
+		"refer": func(a []ParrotType) (ParrotType, error) {
+			if len(a) != 1 && len(a) != 3 || !Symbol_Q(a[0]) {
+				return nil, errors.New("refer requires a symbol and optionally :only [names]")
+			}
+			target := reg.Find(a[0].(Symbol).Val)
+			if target == nil {
+				return nil, errors.New("namespace '" + a[0].(Symbol).Val + "' not found")
+			}
+			if len(a) == 1 {
+				return nil, reg.Current.Refer(target, nil)
+			}
+			if !keywordIs(a[1], "only") {
+				return nil, fmt.Errorf("invalid refer option %s", printer.PrintStr(a[1], true))
+			}
+			names, e := symbolNames(a[2])
+			if e != nil {
+				return nil, e
+			}
+			return nil, reg.Current.Refer(target, names)
+		},
+		"alias": func(a []ParrotType) (ParrotType, error) {
+			if len(a) != 2 || !Symbol_Q(a[0]) || !Symbol_Q(a[1]) {
+				return nil, errors.New("alias requires two symbols")
+			}
+			target := reg.Find(a[1].(Symbol).Val)
+			if target == nil {
+				return nil, errors.New("namespace '" + a[1].(Symbol).Val + "' not found")
+			}
+			reg.Current.Alias(a[0].(Symbol).Val, target)
+			return nil, nil
+		},
+	}
+}
@@ -0,0 +1,39 @@
+package parrot
+
+import (
+	"testing"
+)
+
+func TestNamespaces(t *testing.T) {
+	expectBoth(t, map[string]string{
+		`(ns a) (def x 1) (ns b) (def x 2) a/x`:                                "1",
+		`(ns a) (def x 1) (ns b) (def x 2) x`:                                  "2",
+		`(ns a.b) (def x 1) (ns c) a.b/x`:                                      "1",
+		`(ns a) (+ 1 2)`:                                                       "3",
+		`(in-ns 'a) (def x 1) (in-ns 'user) a/x`:                               "1",
+		`(ns a "a docstring") (def x 1) (ns b (:require [a :as z])) z/x`:       "1",
+		`(ns a) (def x 1) (def y 2) (ns b (:require [a :refer [x]])) x`:        "1",
+		`(ns a) (def x 1) (def y 2) (ns b (:require [a :refer :all])) (+ x y)`: "3",
+		`(ns a) (def x 1) (ns b (:require [a :as z :refer [x]])) [x z/x]`:      "[1 1]",
+		`(ns a) (def x 1) (ns b (:require [a :refer [x]])) (def x 2) [x a/x]`:  "[2 1]",
+		`(ns a) (def x 1) (ns b) (refer 'a :only '[x]) x`:                      "1",
+		`(ns a) (def x 1) (ns b) (refer 'a) x`:                                 "1",
+		`(ns a) (def x 1) (ns b) (alias 'q 'a) q/x`:                            "1",
+		`(ns a) (def x 1) (ns b) (require '[a :as q]) q/x`:                     "1",
+		// fns look names up in the namespace they were defined in
+		`(ns a) (defn f [] (g)) (defn g [] :a) (ns b) (defn g [] :b) (a/f)`: ":a",
+		// a referred name sees later redefinitions in its namespace
+		`(ns a) (def x 1) (ns b (:require [a :refer [x]])) (ns a) (def x 2) (ns b) x`: "2",
+	})
+	expectErrorBoth(t, map[string]string{
+		`(ns a) (def x 1) (ns b) x`:                  "'x' not found",
+		`(ns a) (ns b) a/x`:                          "'a/x' not found",
+		`(ns a) (ns b (:require [a :refer [nope]]))`: "'nope' is not defined in namespace a",
+		`(ns a) (ns b (:require [a :as]))`:           "odd number of options",
+		`(ns a) (ns b (:require [a :rename x]))`:     "invalid require option",
+		`(ns b (:use a))`:                            "unsupported ns clause",
+		`(ns)`:                                       "ns requires a namespace name",
+		`(refer 'nowhere)`:                           "namespace 'nowhere' not found",
+		`(alias 'q 'nowhere)`:                        "namespace 'nowhere' not found",
+	})
+}
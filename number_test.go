@@ -0,0 +1,38 @@
+package parrot
+
+import (
+	"testing"
+)
+
+func TestNumbers(t *testing.T) {
+	expectBoth(t, map[string]string{
+		`(* 9223372036854775807 2)`:  "18446744073709551614N",
+		`(+ 9223372036854775807 1)`:  "9223372036854775808N",
+		`(- -9223372036854775808 1)`: "-9223372036854775809N",
+		`(/ 1 3)`:                    "1/3",
+		`(+ 1/3 2/3)`:                "1",
+		`(+ 1/2 0.25)`:               "0.75",
+		`(/ 6 3)`:                    "2",
+		`1N`:                         "1N",
+		`12M`:                        "12",
+		`1.0M`:                       "1",
+		`(= 1 1N)`:                   "true",
+		`(= 1 1.0)`:                  "true",
+		`(= 1/2 0.5)`:                "true",
+		`(quot 7 2)`:                 "3",
+		`(rem -7 2)`:                 "-1",
+		`(mod -7 2)`:                 "1",
+		`(numerator 6/4)`:            "3",
+		`(denominator 6/4)`:          "2",
+	})
+}
+
+func TestDecimalLiterals(t *testing.T) {
+	expectBoth(t, map[string]string{
+		`1.5M`:                   "3/2",
+		`0.1M`:                   "1/10",
+		`-.5M`:                   "-1/2",
+		`(+ 0.1M 0.2M)`:          "3/10",
+		`(= (+ 0.1M 0.2M) 0.3M)`: "true",
+	})
+}
@@ -2,14 +2,12 @@ package parrot
 
 import (
 	"errors"
-	"io/ioutil"
-	// "fmt"
-	// "os"
-	// "strings"
+	"fmt"
+	"io"
+	"os"
 )
 
 import (
-	"github.com/sllt/parrot/core"
 	. "github.com/sllt/parrot/env"
 	"github.com/sllt/parrot/printer"
 	"github.com/sllt/parrot/reader"
@@ -119,261 +117,175 @@ func macroexpand(ast ParrotType, env EnvType) (ParrotType, error) {
 // 	return nil, nil
 // }
 
-func evalAst(ast ParrotType, env EnvType) (ParrotType, error) {
-	if Symbol_Q(ast) {
-		return env.Get(ast.(Symbol))
-	} else if List_Q(ast) {
-		lst := []ParrotType{}
-		for _, a := range ast.(List).Val {
-			exp, e := Eval(a, env)
-			if e != nil {
-				return nil, e
-			}
-			lst = append(lst, exp)
-		}
-		return List{lst, nil}, nil
-	} else if Vector_Q(ast) {
-		lst := []ParrotType{}
-		for _, a := range ast.(Vector).Val {
-			exp, e := Eval(a, env)
-			if e != nil {
-				return nil, e
-			}
-			lst = append(lst, exp)
-		}
-		return Vector{lst, nil}, nil
-	} else if HashMap_Q(ast) {
-		m := ast.(HashMap)
-		new_hm := HashMap{map[string]ParrotType{}, nil}
-		for k, v := range m.Val {
-			ke, e1 := Eval(k, env)
-			if e1 != nil {
-				return nil, e1
-			}
-			if _, ok := ke.(string); !ok {
-				return nil, errors.New("non string hash-map key")
-			}
-			kv, e2 := Eval(v, env)
-			if e2 != nil {
-				return nil, e2
-			}
-			new_hm.Val[ke.(string)] = kv
-		}
-		return new_hm, nil
-	} else {
-		return ast, nil
+// stackTrace lists the frames of the call stack, innermost first.
+func stackTrace(f *Frame) []Frame {
+	trace := []Frame{}
+	for ; f != nil; f = f.Caller {
+		trace = append(trace, *f)
 	}
+	return trace
 }
 
-func Eval(ast ParrotType, env EnvType) (ParrotType, error) {
-	var e error
-	for {
-
-		switch ast.(type) {
-		case List: // continue
-		default:
-			return evalAst(ast, env)
+// traceError attaches the call stack below call to an error raised while
+// evaluating the form at pos. Errors that already carry a trace are kept.
+func traceError(e error, call *Frame, pos Position) error {
+	var te *EvalError
+	if errors.As(e, &te) {
+		if te.Pos.Line == 0 {
+			te.Pos = pos
 		}
+		return e
+	}
+	return &EvalError{e, pos, stackTrace(call)}
+}
 
-		// apply list
-		ast, e = macroexpand(ast, env)
-		if e != nil {
-			return nil, e
-		}
-		if !List_Q(ast) {
-			return evalAst(ast, env)
-		}
-		if len(ast.(List).Val) == 0 {
-			return ast, nil
-		}
+// extendTrace continues the trace of an error that was raised by Parrot code
+// called back from Go, such as a macro or a function passed to map, through
+// the named Go function called at pos.
+func extendTrace(e error, name string, call *Frame, pos Position) error {
+	var te *EvalError
+	if errors.As(e, &te) {
+		te.Trace = append(te.Trace, Frame{Name: name, Pos: pos})
+		te.Trace = append(te.Trace, stackTrace(call)...)
+	}
+	return e
+}
 
-		a0 := ast.(List).Val[0]
-		var a1 ParrotType = nil
-		var a2 ParrotType = nil
-		switch len(ast.(List).Val) {
-		case 1:
-			a1 = nil
-			a2 = nil
-		case 2:
-			a1 = ast.(List).Val[1]
-			a2 = nil
-		default:
-			a1 = ast.(List).Val[1]
-			a2 = ast.(List).Val[2]
-		}
-		a0sym := "__<*fn*>__"
-		if Symbol_Q(a0) {
-			a0sym = a0.(Symbol).Val
-		}
-		switch a0sym {
-		case "def":
-			res, e := Eval(a2, env)
-			if e != nil {
-				return nil, e
-			}
-			return env.Set(a1.(Symbol), res), nil
-		case "let":
-			let_env, e := NewEnv(env, nil, nil)
-			if e != nil {
-				return nil, e
-			}
-			arr1, e := GetSlice(a1)
-			if e != nil {
-				return nil, e
-			}
-			for i := 0; i < len(arr1); i += 2 {
-				if !Symbol_Q(arr1[i]) {
-					return nil, errors.New("non-symbol bind value")
-				}
-				exp, e := Eval(arr1[i+1], let_env)
-				if e != nil {
-					return nil, e
-				}
-				let_env.Set(arr1[i].(Symbol), exp)
-			}
-			ast = a2
-			env = let_env
-		case "quote":
-			return a1, nil
-		case "quasiquote":
-			ast = quasiquote(a1)
-		case "defmacro":
-			fn, e := Eval(a2, env)
-			fn = fn.(ParrotFunc).SetMacro()
-			if e != nil {
-				return nil, e
-			}
-			return env.Set(a1.(Symbol), fn), nil
-		case "macroexpand":
-			return macroexpand(a1, env)
-		case "try":
-			var exc ParrotType
-			exp, e := Eval(a1, env)
-			if e == nil {
-				return exp, nil
-			} else {
-				if a2 != nil && List_Q(a2) {
-					a2s, _ := GetSlice(a2)
-					if Symbol_Q(a2s[0]) && (a2s[0].(Symbol).Val == "catch") {
-						switch e.(type) {
-						case ParrotError:
-							exc = e.(ParrotError).Obj
-						default:
-							exc = e.Error()
-						}
-						binds := NewList(a2s[1])
-						new_env, e := NewEnv(env, binds, NewList(exc))
-						if e != nil {
-							return nil, e
-						}
-						exp, e = Eval(a2s[2], new_env)
-						if e == nil {
-							return exp, nil
-						}
-					}
-				}
-				return nil, e
-			}
-		case "do":
-			lst := ast.(List).Val
-			_, e := evalAst(List{lst[1 : len(lst)-1], nil}, env)
-			if e != nil {
-				return nil, e
-			}
-			if len(lst) == 1 {
-				return nil, nil
-			}
-			ast = lst[len(lst)-1]
-		case "if":
-			cond, e := Eval(a1, env)
-			if e != nil {
-				return nil, e
-			}
-			if cond == nil || cond == false {
-				if len(ast.(List).Val) >= 4 {
-					ast = ast.(List).Val[3]
-				} else {
-					return nil, nil
-				}
-			} else {
-				ast = a2
-			}
-		case "fn":
-			fn := ParrotFunc{Eval, a2, env, a1, false, NewEnv, nil, false}
-			return fn, nil
-		default:
-			el, e := evalAst(ast, env)
-			if e != nil {
-				return nil, e
-			}
-			f := el.(List).Val[0]
-			if ParrotFunc_Q(f) {
-				fn := f.(ParrotFunc)
-				ast = fn.Exp
-				env, e = NewEnv(fn.Env, fn.Params, List{el.(List).Val[1:], nil})
-				if e != nil {
-					return nil, e
-				}
-			} else {
-				fn, ok := f.(Func)
-				if !ok {
-					return nil, errors.New("attempt to call non-function")
-				}
-				return fn.Fn(el.(List).Val[1:])
-			}
+// Eval compiles ast and runs it in env. The forms of a top-level do are
+// compiled and run one at a time, so that macros defined by one of them
+// apply to the next.
+func Eval(ast ParrotType, env EnvType) (ParrotType, error) {
+	var res ParrotType
+	for _, form := range topLevel(ast) {
+		var e error
+		if res, e = evalForm(form, env); e != nil {
+			return nil, e
 		}
+	}
+	return res, nil
+}
 
-	} // TCO loop
+func evalForm(ast ParrotType, env EnvType) (ParrotType, error) {
+	body, fs, e := compileTop(ast, env)
+	if e != nil {
+		return nil, e
+	}
+	fr := &frame{slots: make([]ParrotType, fs.nslots), env: env, call: env.Frame(), budget: env.Budget()}
+	res, e := body(fr)
+	if e != nil || res != tailMarker {
+		return res, e
+	}
+	tc := fr.tail
+	return tc.fn.Compiled.Call(tc.args, &Frame{Name: tc.name, Pos: tc.pos, Caller: fr.call}, fr.budget)
 }
 
 // print
 func Print(exp ParrotType) (string, error) {
+	if e := Realize(exp); e != nil {
+		return "", e
+	}
 	return printer.PrintStr(exp, true), nil
 }
 
-func Run(str string) (ParrotType, error) {
-	b, e := ioutil.ReadFile(str)
+// PrintN is like Print, but prints at most length items of each lazy seq
+// in exp, so that printing an infinite one stops. A length of 0 or less
+// prints every item.
+func PrintN(exp ParrotType, length int) (string, error) {
+	exp, e := Abbreviate(exp, length)
 	if e != nil {
-		return nil, e
+		return "", e
 	}
-	return Rep(string(b))
+	return printer.PrintStr(exp, true), nil
 }
 
-// repl
-func Rep(str string) (ParrotType, error) {
-	var exp ParrotType
-	var res string
-	var e error
-	if exp, e = Read(str); e != nil {
-		return nil, e
+// PrettyPrint is like Print, but breaks exp across lines to fit in width
+// columns.
+func PrettyPrint(exp ParrotType, width int) (string, error) {
+	if e := Realize(exp); e != nil {
+		return "", e
 	}
-	if exp, e = Eval(exp, Repl_env); e != nil {
-		return nil, e
+	return printer.Pretty(exp, true, width, nil), nil
+}
+
+// PrettyPrintN is like PrettyPrint, but prints at most length items of each
+// lazy seq in exp, as PrintN does.
+func PrettyPrintN(exp ParrotType, width, length int) (string, error) {
+	exp, e := Abbreviate(exp, length)
+	if e != nil {
+		return "", e
 	}
-	if res, e = Print(exp); e != nil {
-		return nil, e
+	return printer.Pretty(exp, true, width, nil), nil
+}
+
+// describeForm returns a short, printable name for a top-level form.
+func describeForm(form ParrotType) string {
+	slc, e := GetSlice(form)
+	if e != nil || !List_Q(form) || len(slc) == 0 {
+		return printer.PrintStr(form, true)
 	}
-	return res, nil
+	desc := "(" + printer.PrintStr(slc[0], true)
+	shown := 1
+	if len(slc) > 1 && !List_Q(slc[1]) && !Vector_Q(slc[1]) && !HashMap_Q(slc[1]) {
+		desc += " " + printer.PrintStr(slc[1], true)
+		shown++
+	}
+	if len(slc) > shown {
+		desc += " ..."
+	}
+	return desc + ")"
 }
 
-var Repl_env, _ = NewEnv(nil, nil, nil)
+// EvalReader reads the top-level forms from in one at a time and evaluates
+// each in the current namespace of reg before reading the next, so that
+// macros defined by earlier forms apply to later ones. It returns the value
+// of the last form. The current namespace is restored afterwards.
+func EvalReader(in io.Reader, file string, reg *Registry) (ParrotType, error) {
+	return evalReader(in, file, reg, reg.Budget)
+}
 
-func init() {
-	for k, v := range core.NS {
-		Repl_env.Set(Symbol{k}, Func{v.(func([]ParrotType) (ParrotType, error)), nil, false})
+// evalReader is EvalReader evaluating under budget.
+func evalReader(in io.Reader, file string, reg *Registry, budget *Budget) (ParrotType, error) {
+	cur := reg.Current
+	defer func() { reg.Current = cur }()
+	rdr := reader.NewReader(in, file)
+	eval := reg.Eval
+	if eval == nil {
+		eval = Eval
 	}
-	Repl_env.Set(Symbol{"eval"}, Func{func(a []ParrotType) (ParrotType, error) {
-		return Eval(a[0], Repl_env)
-	}, nil, false})
-	Repl_env.Set(Symbol{"*ARGV*"}, List{})
+	var res ParrotType
+	for {
+		form, e := rdr.Read()
+		if e == io.EOF {
+			return res, nil
+		}
+		if e != nil {
+			return nil, e
+		}
+		if res, e = eval(form, reg.Current.Env.WithBudget(budget)); e != nil {
+			if pos, ok := GetPosition(form); ok {
+				return nil, fmt.Errorf("%s: in %s: %w", pos, describeForm(form), e)
+			}
+			return nil, fmt.Errorf("in %s: %w", describeForm(form), e)
+		}
+	}
+}
+
+// LoadFile evaluates every top-level form of the named file in the current
+// namespace of reg. Files with the BytecodeExt extension hold forms compiled
+// by CompileFile, which are run as they are.
+func LoadFile(file string, reg *Registry) (ParrotType, error) {
+	return loadFile(file, reg, reg.Budget)
+}
 
-	Rep("(def *host-language* \"go\")")
-	Rep("(def not (fn (a) (if a false true)))")
-	Rep("(def load-file (fn (f) (eval (read-string (str \"(do \" (slurp f) \")\")))))")
-	Rep("(defmacro cond (fn (& xs) (if (> (count xs) 0) (list 'if (first xs) (if (> (count xs) 1) (nth xs 1) (throw \"odd number of forms to cond\")) (cons 'cond (rest (rest xs)))))))")
-	Rep("(def *gensym-counter* (atom 0))")
-	Rep("(def gensym (fn [] (symbol (str \"G__\" (swap! *gensym-counter* (fn* [x] (+ 1 x)))))))")
-	Rep("(defmacro or (fn (& xs) (if (empty? xs) nil (if (= 1 (count xs)) (first xs) (let (condvar (gensym)) `(let (~condvar ~(first xs)) (if ~condvar ~condvar (or ~@(rest xs)))))))))")
-	Rep("(defmacro defn (fn [name args body] `(def ~name (fn ~args ~body))))")
-	Rep("(defn curry [func args] (fn [arg] (apply func (cons args (list arg)))))")
+// loadFile is LoadFile evaluating under budget.
+func loadFile(file string, reg *Registry, budget *Budget) (ParrotType, error) {
+	if isBytecode(file) {
+		return loadBytecode(file, reg, budget)
+	}
+	f, e := os.Open(file)
+	if e != nil {
+		return nil, e
+	}
+	defer f.Close()
+	return evalReader(f, file, reg, budget)
 }
@@ -0,0 +1,73 @@
+package parrot
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/sllt/parrot/printer"
+)
+
+// evalSrc evaluates src in a new interpreter with opts and returns the printed
+// value of its last form and what it wrote to standard output.
+func evalSrc(t *testing.T, src string, opts ...Option) (string, string) {
+	t.Helper()
+	var out bytes.Buffer
+	it := New(append([]Option{WithStdout(&out)}, opts...)...)
+	res, e := it.EvalString(src)
+	if e != nil {
+		t.Fatalf("%s: %v", src, e)
+	}
+	return printer.PrintStr(res, true), out.String()
+}
+
+// runError evaluates src, which must fail, and returns its error.
+func runError(t *testing.T, src string, opts ...Option) error {
+	t.Helper()
+	it := New(append([]Option{WithStdout(&bytes.Buffer{})}, opts...)...)
+	_, e := it.EvalString(src)
+	if e == nil {
+		t.Fatalf("%s: expected an error", src)
+	}
+	return e
+}
+
+// expect checks that each key of cases evaluates to the printed value.
+func expect(t *testing.T, cases map[string]string, opts ...Option) {
+	t.Helper()
+	for src, want := range cases {
+		if got, _ := evalSrc(t, src, opts...); got != want {
+			t.Errorf("%s = %s, want %s", src, got, want)
+		}
+	}
+}
+
+// expectError checks that each key of cases fails with an error that
+// contains the value.
+func expectError(t *testing.T, cases map[string]string, opts ...Option) {
+	t.Helper()
+	for src, want := range cases {
+		if e := runError(t, src, opts...); !strings.Contains(e.Error(), want) {
+			t.Errorf("%s: error %q, want it to contain %q", src, e, want)
+		}
+	}
+}
+
+// backends are the options that select each way of running code.
+var backends = map[string][]Option{"closures": nil, "bytecode": {WithBytecode()}}
+
+// expectBoth is expect on every backend.
+func expectBoth(t *testing.T, cases map[string]string) {
+	t.Helper()
+	for name, opts := range backends {
+		t.Run(name, func(t *testing.T) { expect(t, cases, opts...) })
+	}
+}
+
+// expectErrorBoth is expectError on every backend.
+func expectErrorBoth(t *testing.T, cases map[string]string) {
+	t.Helper()
+	for name, opts := range backends {
+		t.Run(name, func(t *testing.T) { expectError(t, cases, opts...) })
+	}
+}
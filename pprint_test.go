@@ -0,0 +1,64 @@
+package parrot
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPprint(t *testing.T) {
+	expectBoth(t, map[string]string{
+		`(pprint-str [1 2 3])`:                                               `"[1 2 3]"`,
+		`(pprint-str [1 2 3 4 5 6 7 8 9 10] {:width 10})`:                    `"[1 2 3 4 5\n 6 7 8 9\n 10]"`,
+		`(pprint-str '(my-let [a 1] (f a)) {:width 14})`:                     `"(my-let [a 1]\n        (f a))"`,
+		`(pprint-str '(my-let [a 1] (f a)) {:width 14 :indent {'my-let 1}})`: `"(my-let [a 1]\n  (f a))"`,
+		`(pprint-str '(my-let [a 1] (f a)) {:width 14 :indent {:my-let 1}})`: `"(my-let [a 1]\n  (f a))"`,
+		`(pprint-str (map inc [1 2]))`:                                       `"(2 3)"`,
+	})
+	expectErrorBoth(t, map[string]string{
+		`(pprint-str)`:                   "pprint-str requires 1 or 2 args",
+		`(pprint-str 1 2)`:               "pprint-str: expected an options map, got 2",
+		`(pprint-str 1 {:indent 1})`:     "pprint-str: :indent requires a map, got 1",
+		`(pprint-str 1 {:indent {1 1}})`: "pprint-str: cannot use 1 as an :indent key",
+		`(pprint-str 1 {:width "x"})`:    `expected an integer, got "x"`,
+	})
+}
+
+func TestPprintWritesToStdout(t *testing.T) {
+	var out bytes.Buffer
+	it := New(WithStdout(&out))
+	if _, e := it.EvalString(`(pprint '(let [a 1] (+ a 1)) {:width 12})`); e != nil {
+		t.Fatal(e)
+	}
+	if got, want := out.String(), "(let [a 1]\n  (+ a 1))\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRepPrettyPrints(t *testing.T) {
+	got, e := New(WithPrettyPrint(12)).Rep(`'(defn f [x] (inc x))`)
+	if want := "(defn f [x]\n  (inc x))"; e != nil || got != want {
+		t.Errorf("got %q, %v, want %q", got, e, want)
+	}
+	got, e = New().Rep(`'(defn f [x] (inc x))`)
+	if want := "(defn f [x] (inc x))"; e != nil || got != want {
+		t.Errorf("without pretty printing got %q, %v, want %q", got, e, want)
+	}
+}
+
+func TestWithIndentRules(t *testing.T) {
+	src := `(pprint-str '(my-let [a 1] (f a)) {:width 14})`
+	got, e := New(WithIndentRules(map[string]int{"my-let": 1})).EvalString(src)
+	if want := "(my-let [a 1]\n  (f a))"; e != nil || got != want {
+		t.Errorf("got %q, %v, want %q", got, e, want)
+	}
+	got, e = New(WithIndentRules(map[string]int{"my-let": 1}), WithPrettyPrint(14)).Rep(`'(my-let [a 1] (f a))`)
+	if want := "(my-let [a 1]\n  (f a))"; e != nil || got != want {
+		t.Errorf("Rep got %q, %v, want %q", got, e, want)
+	}
+
+	// the rules of one interpreter are not those of another
+	got, e = New().EvalString(src)
+	if want := "(my-let [a 1]\n        (f a))"; e != nil || got != want {
+		t.Errorf("another interpreter got %q, %v, want %q", got, e, want)
+	}
+}
@@ -0,0 +1,79 @@
+package parrot
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrintLength(t *testing.T) {
+	for _, c := range []struct {
+		length int
+		src    string
+		want   string
+	}{
+		{3, `(range)`, "(0 1 2 ...)"},
+		{3, `(def nat (range))`, "(0 1 2 ...)"},
+		{3, `[1 2 3]`, "[1 2 3]"},
+		{3, `[1 2 3 4]`, "[1 2 3 4]"},
+		{3, `(list 1 2 3 4)`, "(1 2 3 4)"},
+		{3, `[(range 5)]`, "[(0 1 2 ...)]"},
+		{3, `(list (range) [(repeat :x)])`, "((0 1 2 ...) [(:x :x :x ...)])"},
+		{3, `{:nat (iterate inc 1)}`, "{:nat (1 2 3 ...)}"},
+		{0, `(range 5)`, "(0 1 2 3 4)"},
+		{DefaultPrintLength, `(count (take 1000 (range)))`, "1000"},
+	} {
+		for name, opts := range backends {
+			it := New(append([]Option{WithPrintLength(c.length)}, opts...)...)
+			got, e := it.Rep(c.src)
+			if e != nil {
+				t.Errorf("%s: %s: %v", name, c.src, e)
+			} else if got != c.want {
+				t.Errorf("%s: %s with a print length of %d = %s, want %s", name, c.src, c.length, got, c.want)
+			}
+		}
+	}
+	// printing a value does not realize more of it than it prints
+	it := New(WithPrintLength(2))
+	if _, e := it.Rep(`(def seen (atom 0)) (def s (map (fn [x] (swap! seen inc) x) (range)))`); e != nil {
+		t.Fatal(e)
+	}
+	if got, e := it.Rep(`@seen`); e != nil || got != "3" {
+		t.Errorf("printing 2 items realized %v (%v), want 3", got, e)
+	}
+	got, e := New(WithPrettyPrint(20), WithPrintLength(4)).Rep(`(range)`)
+	if e != nil || got != "(0 1 2 3 ...)" {
+		t.Errorf("pretty printing (range) = %q, %v", got, e)
+	}
+	// without the option, Rep prints every item
+	if got, e := New().Rep(`(range 200)`); e != nil || !strings.HasSuffix(got.(string), " 198 199)") {
+		t.Errorf("(range 200) = %q, %v, want every item", got, e)
+	}
+}
+
+func TestPrintN(t *testing.T) {
+	nat, e := New().EvalString(`[(range) (range 3)]`)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if got, e := PrintN(nat, 2); e != nil || got != "[(0 1 ...) (0 1 ...)]" {
+		t.Errorf("PrintN = %q, %v", got, e)
+	}
+	three, _ := New().EvalString(`[1 2 3]`)
+	if got, e := Print(three); e != nil || got != "[1 2 3]" {
+		t.Errorf("Print = %q, %v", got, e)
+	}
+}
+
+func TestRestOfString(t *testing.T) {
+	expectBoth(t, map[string]string{
+		`(rest "abc")`:                `(\b \c)`,
+		`(rest "a")`:                  `()`,
+		`(rest "")`:                   `()`,
+		`(next "abc")`:                `(\b \c)`,
+		`(next "a")`:                  `nil`,
+		`(= (rest "abc") '(\b \c))`:   `true`,
+		`(let [[a & r] "abc"] [a r])`: `[\a (\b \c)]`,
+		`(apply str (rest "héllo"))`:  `"éllo"`,
+		`(count (rest (apply str (repeat 10000 "x"))))`: "9999",
+	})
+}
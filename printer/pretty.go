@@ -0,0 +1,252 @@
+package printer
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sllt/parrot/types"
+)
+
+// Pretty printing. A value is turned into a document of text, line breaks
+// and groups, as in Wadler's "A prettier printer", and the document is laid
+// out by breaking the lines of a group only when the group does not fit in
+// the width left on the line.
+
+// indentRules says how lists that start with these symbols are laid out
+// when they do not fit on one line: (let [a 1] body) keeps its first arg,
+// the bindings, on the line of let, and puts each other arg on a line of
+// its own, indented by two. Lists that start with other symbols are laid
+// out as calls, with their args lined up under the first one.
+var indentRules = map[string]int{
+	"def":      1,
+	"defmacro": 1,
+	"defn":     2,
+	"fn":       1,
+	"let":      1,
+	"loop":     1,
+	"if":       1,
+	"do":       0,
+	"try":      0,
+	"catch":    2,
+	"ns":       1,
+	"cond":     0,
+	"for":      1,
+	"doseq":    1,
+	"lazy-seq": 0,
+	"reset":    0,
+	"shift":    1,
+}
+
+// DefaultIndentRules returns a copy of the rules Pretty lays out code by
+// unless it is given others, for a caller to add its own to.
+func DefaultIndentRules() map[string]int {
+	rules := make(map[string]int, len(indentRules))
+	for k, n := range indentRules {
+		rules[k] = n
+	}
+	return rules
+}
+
+// A doc is a text, line, concat, nest, align or group.
+type doc interface{}
+
+// text is printed as it is.
+type text string
+
+// line is a space, or a newline when the group it is in is broken.
+type line struct{}
+
+// concat is docs one after another.
+type concat []doc
+
+// nest is d, with the newlines in it indented by n more columns.
+type nest struct {
+	n int
+	d doc
+}
+
+// align is d, with the newlines in it indented to the column d starts at.
+type align struct{ d doc }
+
+// group is d, on one line if it fits, and broken at all its lines if not.
+type group struct{ d doc }
+
+// join puts sep between docs.
+func join(docs []doc, sep doc) doc {
+	res := make(concat, 0, 2*len(docs))
+	for i, d := range docs {
+		if i > 0 {
+			res = append(res, sep)
+		}
+		res = append(res, d)
+	}
+	return res
+}
+
+// prettyPrinter turns values into docs.
+type prettyPrinter struct {
+	readably bool
+	rules    map[string]int
+}
+
+// seq lays out items between start and end, lined up under the first one.
+// Items that are not collections fill the lines, as many on each as fit.
+func (p prettyPrinter) seq(start string, items []types.ParrotType, end string) doc {
+	docs := make([]doc, len(items))
+	var sep doc = line{}
+	fill := true
+	for i, x := range items {
+		docs[i] = p.doc(x)
+		if _, ok := docs[i].(text); !ok {
+			fill = false
+		}
+	}
+	if fill {
+		sep = group{line{}}
+	}
+	return group{concat{text(start), align{join(docs, sep)}, text(end)}}
+}
+
+// form lays out a list that starts with a symbol, following the rules.
+func (p prettyPrinter) form(head types.Symbol, args []types.ParrotType) doc {
+	docs := make([]doc, len(args))
+	for i, x := range args {
+		docs[i] = p.doc(x)
+	}
+	n, ok := p.rules[head.Val]
+	if !ok {
+		return group{concat{text("(" + head.Val + " "), align{join(docs, line{})}, text(")")}}
+	}
+	if n > len(docs) {
+		n = len(docs)
+	}
+	res := concat{text("(" + head.Val)}
+	for _, d := range docs[:n] {
+		res = append(res, text(" "), d)
+	}
+	for _, d := range docs[n:] {
+		res = append(res, nest{2, concat{line{}, d}})
+	}
+	return group{align{append(res, text(")"))}}
+}
+
+func (p prettyPrinter) doc(obj types.ParrotType) doc {
+	switch tobj := obj.(type) {
+	case types.List:
+		if len(tobj.Val) > 1 {
+			if head, ok := tobj.Val[0].(types.Symbol); ok {
+				return p.form(head, tobj.Val[1:])
+			}
+		}
+		return p.seq("(", tobj.Val, ")")
+	case *types.LazySeq, types.Cons:
+		slc, _ := types.GetSlice(tobj)
+		return p.seq("(", slc, ")")
+	case types.Vector:
+		return p.seq("[", tobj.Val.Slice(), "]")
+	case types.Set:
+		return p.seq("#{", tobj.Val.Keys(), "}")
+	case types.HashMap:
+		pairs := make([]doc, 0, tobj.Val.Len())
+		tobj.Val.Range(func(k, v types.ParrotType) bool {
+			pairs = append(pairs, concat{p.doc(k), text(" "), p.doc(v)})
+			return true
+		})
+		return group{concat{text("{"), align{join(pairs, line{})}, text("}")}}
+	}
+	return text(PrintStr(obj, p.readably))
+}
+
+// command is a doc to lay out at an indentation, flat or broken.
+type command struct {
+	indent int
+	flat   bool
+	d      doc
+}
+
+// fits reports whether cmd, followed by rest up to its first line break,
+// fits in width columns.
+func fits(width int, cmd command, rest []command) bool {
+	stack := []command{cmd}
+	for width >= 0 {
+		if len(stack) == 0 {
+			if len(rest) == 0 {
+				return true
+			}
+			stack = append(stack, rest[len(rest)-1])
+			rest = rest[:len(rest)-1]
+		}
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		switch d := c.d.(type) {
+		case text:
+			width -= utf8.RuneCountInString(string(d))
+		case line:
+			if !c.flat {
+				return true
+			}
+			width--
+		case concat:
+			for i := len(d) - 1; i >= 0; i-- {
+				stack = append(stack, command{c.indent, c.flat, d[i]})
+			}
+		case nest:
+			stack = append(stack, command{c.indent + d.n, c.flat, d.d})
+		case align:
+			stack = append(stack, command{c.indent, c.flat, d.d})
+		case group:
+			stack = append(stack, command{c.indent, c.flat, d.d})
+		}
+	}
+	return false
+}
+
+// layout renders d in width columns.
+func layout(d doc, width int) string {
+	var b strings.Builder
+	col := 0
+	stack := []command{{0, false, d}}
+	for len(stack) > 0 {
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		switch d := c.d.(type) {
+		case text:
+			b.WriteString(string(d))
+			col += utf8.RuneCountInString(string(d))
+		case line:
+			if c.flat {
+				b.WriteByte(' ')
+				col++
+			} else {
+				b.WriteByte('\n')
+				b.WriteString(strings.Repeat(" ", c.indent))
+				col = c.indent
+			}
+		case concat:
+			for i := len(d) - 1; i >= 0; i-- {
+				stack = append(stack, command{c.indent, c.flat, d[i]})
+			}
+		case nest:
+			stack = append(stack, command{c.indent + d.n, c.flat, d.d})
+		case align:
+			stack = append(stack, command{col, c.flat, d.d})
+		case group:
+			flat := command{c.indent, true, d.d}
+			if !c.flat && !fits(width-col, flat, stack) {
+				flat.flat = false
+			}
+			stack = append(stack, flat)
+		}
+	}
+	return b.String()
+}
+
+// Pretty prints obj readably, or for display, across as many lines as it
+// needs to fit in width columns, laying out code as rules say. A nil rules
+// means those of DefaultIndentRules.
+func Pretty(obj types.ParrotType, readably bool, width int, rules map[string]int) string {
+	if rules == nil {
+		rules = indentRules
+	}
+	return layout(prettyPrinter{readably, rules}.doc(obj), width)
+}
@@ -0,0 +1,86 @@
+package printer
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/sllt/parrot/reader"
+	"github.com/sllt/parrot/types"
+)
+
+func read(t *testing.T, src string) types.ParrotType {
+	t.Helper()
+	form, e := reader.ReadStr(src)
+	if e != nil {
+		t.Fatal(e)
+	}
+	return form
+}
+
+func TestPrettyLayout(t *testing.T) {
+	for _, c := range []struct {
+		src   string
+		width int
+		want  string
+	}{
+		{`[1 2 3]`, 80, "[1 2 3]"},
+		{`[1 2 3 4 5 6 7 8 9 10]`, 10, "[1 2 3 4 5\n 6 7 8 9\n 10]"},
+		{`[[1 2] [3 4] [5 6]]`, 10, "[[1 2]\n [3 4]\n [5 6]]"},
+		{`(let [a 1 b 2] (+ a b) (* a b))`, 20, "(let [a 1 b 2]\n  (+ a b)\n  (* a b))"},
+		{`(defn f [x] (if (pos? x) (inc x) (dec x)))`, 25, "(defn f [x]\n  (if (pos? x)\n    (inc x)\n    (dec x)))"},
+		{`(foo bar-baz-quux (qux 1 2 3) [4 5 6])`, 20, "(foo bar-baz-quux\n     (qux 1 2 3)\n     [4 5 6])"},
+		{`{:config {:deps [:a :b :c]}}`, 20, "{:config {:deps [:a\n                 :b\n                 :c]}}"},
+		{`"héllo wörld"`, 5, `"héllo wörld"`},
+		{`#{:a}`, 2, "#{:a}"},
+		{`()`, 2, "()"},
+	} {
+		if got := Pretty(read(t, c.src), true, c.width, nil); got != c.want {
+			t.Errorf("%s in %d columns:\n%s\nwant\n%s", c.src, c.width, got, c.want)
+		}
+	}
+}
+
+func TestPrettyRules(t *testing.T) {
+	form := read(t, `(my-let [a 1] (f a) (g a))`)
+	if got, want := Pretty(form, true, 15, nil), "(my-let [a 1]\n        (f a)\n        (g a))"; got != want {
+		t.Errorf("as a call:\n%s\nwant\n%s", got, want)
+	}
+	if got, want := Pretty(form, true, 15, map[string]int{"my-let": 1}), "(my-let [a 1]\n  (f a)\n  (g a))"; got != want {
+		t.Errorf("with a rule:\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestPrettyReadably(t *testing.T) {
+	if got := Pretty("a\nb", false, 80, nil); got != "a\nb" {
+		t.Errorf("got %q for display", got)
+	}
+	if got := Pretty("a\nb", true, 80, nil); got != `"a\nb"` {
+		t.Errorf("got %q readably", got)
+	}
+}
+
+// TestPrettyFits checks that the lines of nested data fit in the width
+// wherever they can break, and that the output reads back as the value.
+func TestPrettyFits(t *testing.T) {
+	src := `{:name "parrot" :version [1 2 3]
+	         :deps {:readline {:url "github.com/chzyer/readline" :pin [0 1 5]}
+	                :lazy #{:map :filter :take :drop :iterate}}
+	         :body (defn area [{:keys [w h]}] (let [a (* w h)] (if (pos? a) a 0)))}`
+	value := read(t, src)
+	for _, width := range []int{40, 60, 80, 120} {
+		out := Pretty(value, true, width, nil)
+		for _, ln := range strings.Split(out, "\n") {
+			if n := utf8.RuneCountInString(ln); n > width && !strings.Contains(ln, "github.com") {
+				t.Errorf("width %d: line of %d columns: %q", width, n, ln)
+			}
+		}
+		back := read(t, out)
+		if !types.Equal_Q(back, value) {
+			t.Errorf("width %d: %s\nreads back as\n%s", width, out, PrintStr(back, true))
+		}
+	}
+	if out := Pretty(value, true, 1000, nil); strings.Contains(out, "\n") {
+		t.Errorf("broke lines that fit in 1000 columns:\n%s", out)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/sllt/parrot/types"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
 func PrintList(lst []types.ParrotType, pr bool,
@@ -16,42 +17,105 @@ func PrintList(lst []types.ParrotType, pr bool,
 	return start + strings.Join(strList, join) + end
 }
 
+// quoteString returns s as a string literal that reads back as s.
+func quoteString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '\\', '"':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		default:
+			if unicode.IsControl(r) {
+				fmt.Fprintf(&b, `\u%04x`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
 func PrintStr(obj types.ParrotType, print_readably bool) string {
 	switch tobj := obj.(type) {
 	case types.List:
 		return PrintList(tobj.Val, print_readably, "(", ")", " ")
+	case *types.LazySeq, types.Cons:
+		slc, _ := types.GetSlice(tobj)
+		return PrintList(slc, print_readably, "(", ")", " ")
 	case types.Vector:
-		return PrintList(tobj.Val, print_readably, "[", "]", " ")
+		return PrintList(tobj.Val.Slice(), print_readably, "[", "]", " ")
 	case types.HashMap:
-		strList := make([]string, 0, len(tobj.Val)*2)
-		for k, v := range tobj.Val {
+		strList := make([]string, 0, tobj.Val.Len()*2)
+		tobj.Val.Range(func(k, v types.ParrotType) bool {
 			strList = append(strList, PrintStr(k, print_readably))
 			strList = append(strList, PrintStr(v, print_readably))
-		}
+			return true
+		})
 		return "{" + strings.Join(strList, " ") + "}"
+	case types.Set:
+		return PrintList(tobj.Val.Keys(), print_readably, "#{", "}", " ")
 	case string:
 		if strings.HasPrefix(tobj, "\u029e") {
 			return ":" + tobj[2:len(tobj)]
 		} else if print_readably {
-			return `"` + strings.Replace(
-				strings.Replace(
-					strings.Replace(tobj, `\`, `\\`, -1),
-					`"`, `\"`, -1),
-				"\n", `\n`, -1) + `"`
+			return quoteString(tobj)
 		} else {
 			return tobj
 		}
+	case types.Char:
+		if !print_readably {
+			return string(tobj.Val)
+		}
+		if name, ok := types.CharNames[tobj.Val]; ok {
+			return `\` + name
+		}
+		if unicode.IsControl(tobj.Val) {
+			return fmt.Sprintf(`\u%04x`, tobj.Val)
+		}
+		return `\` + string(tobj.Val)
+	case types.Regex:
+		if print_readably {
+			return `#"` + tobj.Val.String() + `"`
+		}
+		return tobj.Val.String()
 	case types.Symbol:
 		return tobj.Val
 	case types.Float64:
 		return fmt.Sprintf("%v", tobj.Val)
 	case types.Int64:
 		return strconv.FormatInt(tobj.Val, 10)
+	case types.BigInt:
+		if print_readably {
+			return tobj.Val.String() + "N"
+		}
+		return tobj.Val.String()
+	case types.Ratio:
+		return tobj.Val.String()
 	case types.Bool:
 		return strconv.FormatBool(tobj.Val)
 	case nil:
 		return "nil"
 	case types.ParrotFunc:
+		if tobj.Arities != nil {
+			arities := make([]string, len(tobj.Arities))
+			for i, a := range tobj.Arities {
+				arities[i] = "(" + PrintStr(a.Params, true) + " " + PrintStr(a.Exp, true) + ")"
+			}
+			return "(fn " + strings.Join(arities, " ") + ")"
+		}
 		return "(fn " +
 			PrintStr(tobj.Params, true) + " " +
 			PrintStr(tobj.Exp, true) + ")"
@@ -60,6 +124,14 @@ func PrintStr(obj types.ParrotType, print_readably bool) string {
 	case *types.Atom:
 		return "(atom " +
 			PrintStr(tobj.Val, true) + ")"
+	case types.GoObject:
+		return fmt.Sprintf("#<%T %v>", tobj.Val, tobj.Val)
+	case *types.Writer:
+		return "#<writer " + types.WriterName(tobj) + ">"
+	case *types.TransientVector:
+		return fmt.Sprintf("#<transient vector of %d>", tobj.Len())
+	case *types.TransientMap:
+		return fmt.Sprintf("#<transient hash-map of %d>", tobj.Len())
 	default:
 		return fmt.Sprintf("%v", obj)
 	}
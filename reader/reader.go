@@ -1,56 +1,66 @@
 package reader
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
+	"io"
+	"math/big"
 	"regexp"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/sllt/parrot/types"
 )
 
-type Reader interface {
-	next() *string
-	peek() *string
+// Reader reads Parrot forms one at a time from an io.Reader.
+type Reader struct {
+	lex   *lexer
+	ahead *Token
+	err   error
 }
 
-type TokenReader struct {
-	tokens   []string
-	position int
+// NewReader returns a Reader over in. Positions of the forms it reads are
+// reported relative to file.
+func NewReader(in io.Reader, file string) *Reader {
+	rr, ok := in.(io.RuneReader)
+	if !ok {
+		rr = bufio.NewReader(in)
+	}
+	return &Reader{lex: newLexer(rr, file)}
 }
 
-func (t *TokenReader) next() *string {
-	if t.position >= len(t.tokens) {
-		return nil
-	}
-	token := t.tokens[t.position]
-	t.position = t.position + 1
-	return &token
+func (r *Reader) next() *Token {
+	token := r.peek()
+	r.ahead = nil
+	return token
 }
 
-func (t *TokenReader) peek() *string {
-	if t.position >= len(t.tokens) {
-		return nil
+func (r *Reader) peek() *Token {
+	if r.ahead == nil && r.err == nil {
+		r.ahead, r.err = r.lex.next()
 	}
-	return &t.tokens[t.position]
+	return r.ahead
 }
 
-func tokenize(str string) []string {
-	results := make([]string, 0, 1)
-	re := regexp.MustCompile(`[\s,]*(~@|[\[\]{}()'` + "`" +
-		`~^@]|"(?:\\.|[^\\"])*"|;.*|[^\s\[\]{}('"` + "`" +
-		`,;)]*)` + `|[-+]?([0-9]*\.[0-9]+|[0-9]+)`)
-	for _, group := range re.FindAllStringSubmatch(str, -1) {
-		if (group[1] == "") || (group[1][0] == ';') {
-			continue
+// Read reads the next top-level form. It returns io.EOF once the input holds
+// no more forms.
+func (r *Reader) Read() (types.ParrotType, error) {
+	if r.peek() == nil {
+		if r.err != nil {
+			return nil, r.err
 		}
-		results = append(results, group[1])
+		return nil, io.EOF
 	}
-	return results
+	form, e := readForm(r)
+	if r.err != nil {
+		return nil, r.err
+	}
+	return form, e
 }
 
-// func readFloat(rdr Reader) (types.ParrotType, error) {
+// func readFloat(rdr *Reader) (types.ParrotType, error) {
 // 	token := rdr.peek()
 // 	if token == nil {
 // 		return nil, errors.New("readFloat underflow")
@@ -67,66 +77,149 @@ func tokenize(str string) []string {
 // 	return nil, nil
 // }
 
-func readAtom(rdr Reader) (types.ParrotType, error) {
+func readAtom(rdr *Reader) (types.ParrotType, error) {
 	token := rdr.next()
 	if token == nil {
 		return nil, errors.New("readAtom underflow")
 	}
-	if match, _ := regexp.MatchString(`^[-+]?[0-9]*\.?[0-9]+$`, *token); match {
+	if match, _ := regexp.MatchString(`^[-+]?[0-9]*\.?[0-9]+$`, token.Val); match {
 
 		// parse int64 number
-		i, e := strconv.Atoi(*token)
+		i, e := strconv.ParseInt(token.Val, 10, 64)
 		if e == nil {
-			return types.Int64{int64(i)}, nil
+			return types.Int64{i}, nil
+		} else if n, ok := new(big.Int).SetString(token.Val, 10); ok {
+			// too large for an int64
+			return types.BigInt{n}, nil
 		} else {
 			// parse float64 number
 
-			f, e := strconv.ParseFloat(*token, 64)
+			f, e := strconv.ParseFloat(token.Val, 64)
 			if e == nil {
 				return types.Float64{f}, nil
 			}
 		}
-		return nil, errors.New("number parse error")
-	} else if (*token)[0] == '"' {
-		str := (*token)[1 : len(*token)-1]
-		val := strings.Replace(
-			strings.Replace(
-				strings.Replace(
-					strings.Replace(str, `\\`, "\u029e", -1),
-					`\"`, `"`, -1),
-				`\n`, "\n", -1),
-			"\u029e", "\\", -1)
-
-		return val, nil
-	} else if (*token)[0] == ':' {
-		return types.NewKeyword((*token)[1:len(*token)])
-	} else if *token == "nil" {
+		return nil, fmt.Errorf("%s: number parse error", token.Pos)
+	} else if match, _ := regexp.MatchString(`^[-+]?[0-9]+N$`, token.Val); match {
+		n, _ := new(big.Int).SetString(strings.TrimSuffix(token.Val, "N"), 10)
+		return types.BigInt{n}, nil
+	} else if match, _ := regexp.MatchString(`^[-+]?[0-9]+/[0-9]+$`, token.Val); match {
+		r, ok := new(big.Rat).SetString(token.Val)
+		if !ok {
+			return nil, fmt.Errorf("%s: divide by zero in %s", token.Pos, token.Val)
+		}
+		return types.NewRatio(r), nil
+	} else if match, _ := regexp.MatchString(`^[-+]?[0-9]*\.?[0-9]+M$`, token.Val); match {
+		// an exact decimal, read as an integer or a ratio
+		r, _ := new(big.Rat).SetString(strings.TrimSuffix(token.Val, "M"))
+		return types.NewRatio(r), nil
+	} else if token.Val[0] == '"' {
+		return unescape(token.Val[1:len(token.Val)-1], token.Pos)
+	} else if token.Val[0] == '\\' {
+		return readChar(token)
+	} else if strings.HasPrefix(token.Val, `#"`) {
+		re, e := types.NewRegex(token.Val[2 : len(token.Val)-1])
+		if e != nil {
+			return nil, fmt.Errorf("%s: invalid regex: %s", token.Pos, e)
+		}
+		return re, nil
+	} else if token.Val[0] == ':' {
+		return types.NewKeyword(token.Val[1:len(token.Val)])
+	} else if token.Val == "nil" {
 		return nil, nil
-	} else if *token == "true" {
+	} else if token.Val == "true" {
 		return true, nil
-	} else if *token == "false" {
+	} else if token.Val == "false" {
 		return false, nil
 	} else {
-		return types.Symbol{*token}, nil
+		return types.Symbol{token.Val}, nil
 	}
-	return token, nil
 }
 
-func readList(rdr Reader, start string, end string) (types.ParrotType, error) {
-	token := rdr.next()
-	if token == nil {
+// unescape returns the string that the body of a string literal stands
+// for. \uXXXX and \xHH stand for the char with that hex code.
+func unescape(str string, pos types.Position) (string, error) {
+	if !strings.ContainsRune(str, '\\') {
+		return str, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(str); i++ {
+		if str[i] != '\\' {
+			b.WriteByte(str[i])
+			continue
+		}
+		i++
+		if i == len(str) {
+			return "", fmt.Errorf("%s: unterminated escape", pos)
+		}
+		switch c := str[i]; c {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case '\\', '"':
+			b.WriteByte(c)
+		case 'u', 'x':
+			n := 4
+			if c == 'x' {
+				n = 2
+			}
+			if i+n >= len(str) {
+				return "", fmt.Errorf("%s: invalid escape \\%s", pos, str[i:])
+			}
+			code, e := strconv.ParseUint(str[i+1:i+1+n], 16, 32)
+			if e != nil {
+				return "", fmt.Errorf("%s: invalid escape \\%s", pos, str[i:i+1+n])
+			}
+			b.WriteRune(rune(code))
+			i += n
+		default:
+			return "", fmt.Errorf("%s: unsupported escape \\%c", pos, c)
+		}
+	}
+	return b.String(), nil
+}
+
+// readChar reads a char literal: \a, a name such as \newline, or \uXXXX.
+func readChar(token *Token) (types.ParrotType, error) {
+	s := token.Val[1:]
+	if r, n := utf8.DecodeRuneInString(s); n == len(s) && n > 0 {
+		return types.Char{r}, nil
+	}
+	for r, name := range types.CharNames {
+		if s == name {
+			return types.Char{r}, nil
+		}
+	}
+	if len(s) == 5 && s[0] == 'u' {
+		if code, e := strconv.ParseUint(s[1:], 16, 32); e == nil {
+			return types.Char{rune(code)}, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: unsupported char \\%s", token.Pos, s)
+}
+
+func readList(rdr *Reader, start string, end string) (types.ParrotType, error) {
+	open := rdr.next()
+	if open == nil {
 		return nil, errors.New("readList unferflow")
 	}
-	if *token != start {
-		return nil, errors.New("expected '" + start + "'")
+	if open.Val != start {
+		return nil, fmt.Errorf("%s: expected '%s'", open.Pos, start)
 	}
 	astList := []types.ParrotType{}
-	token = rdr.peek()
+	token := rdr.peek()
 	for ; true; token = rdr.peek() {
 		if token == nil {
-			return nil, errors.New("exepected '" + end + "', got EOF")
+			return nil, fmt.Errorf("expected '%s' to close '%s' opened at %s, got EOF", end, start, open.Pos)
 		}
-		if *token == end {
+		if token.Val == end {
 			break
 		}
 		f, e := readForm(rdr)
@@ -136,60 +229,78 @@ func readList(rdr Reader, start string, end string) (types.ParrotType, error) {
 		astList = append(astList, f)
 	}
 	rdr.next()
-	return types.List{astList, nil}, nil
+	return types.List{astList, open.Pos}, nil
 }
 
-func readVector(rdr Reader) (types.ParrotType, error) {
+func readVector(rdr *Reader) (types.ParrotType, error) {
 	lst, e := readList(rdr, "[", "]")
 	if e != nil {
 		return nil, e
 	}
-	vec := types.Vector{lst.(types.List).Val, nil}
+	vec := types.NewVector(lst.(types.List).Val...)
+	vec.Meta = lst.(types.List).Meta
 	return vec, nil
 }
 
-func readHashMap(rdr Reader) (types.ParrotType, error) {
+func readHashMap(rdr *Reader) (types.ParrotType, error) {
 	lst, e := readList(rdr, "{", "}")
 	if e != nil {
 		return nil, e
 	}
-	return types.NewHashMap(lst)
+	hm, e := types.NewHashMap(lst)
+	if e != nil {
+		return nil, fmt.Errorf("%s: %s", lst.(types.List).Meta, e)
+	}
+	return types.HashMap{hm.(types.HashMap).Val, lst.(types.List).Meta}, nil
 }
 
-func readForm(rdr Reader) (types.ParrotType, error) {
+func readSet(rdr *Reader) (types.ParrotType, error) {
+	lst, e := readList(rdr, "#{", "}")
+	if e != nil {
+		return nil, e
+	}
+	set := types.NewSet(lst.(types.List).Val...)
+	if set.Val.Len() != len(lst.(types.List).Val) {
+		return nil, fmt.Errorf("%s: duplicate item in set literal", lst.(types.List).Meta)
+	}
+	set.Meta = lst.(types.List).Meta
+	return set, nil
+}
+
+func readForm(rdr *Reader) (types.ParrotType, error) {
 	token := rdr.peek()
 	if token == nil {
 		return nil, errors.New("readForm underflow")
 	}
-	switch *token {
+	switch token.Val {
 	case `'`:
 		rdr.next()
 		form, e := readForm(rdr)
 		if e != nil {
 			return nil, e
 		}
-		return types.List{[]types.ParrotType{types.Symbol{"quote"}, form}, nil}, nil
+		return types.List{[]types.ParrotType{types.Symbol{"quote"}, form}, token.Pos}, nil
 	case "`":
 		rdr.next()
 		form, e := readForm(rdr)
 		if e != nil {
 			return nil, e
 		}
-		return types.List{[]types.ParrotType{types.Symbol{"quasiquote"}, form}, nil}, nil
+		return types.List{[]types.ParrotType{types.Symbol{"quasiquote"}, form}, token.Pos}, nil
 	case `~`:
 		rdr.next()
 		form, e := readForm(rdr)
 		if e != nil {
 			return nil, e
 		}
-		return types.List{[]types.ParrotType{types.Symbol{"unquote"}, form}, nil}, nil
+		return types.List{[]types.ParrotType{types.Symbol{"unquote"}, form}, token.Pos}, nil
 	case `~@`:
 		rdr.next()
 		form, e := readForm(rdr)
 		if e != nil {
 			return nil, e
 		}
-		return types.List{[]types.ParrotType{types.Symbol{"splice-unquote"}, form}, nil}, nil
+		return types.List{[]types.ParrotType{types.Symbol{"splice-unquote"}, form}, token.Pos}, nil
 	case `^`:
 		rdr.next()
 		meta, e := readForm(rdr)
@@ -200,28 +311,30 @@ func readForm(rdr Reader) (types.ParrotType, error) {
 		if e != nil {
 			return nil, e
 		}
-		return types.List{[]types.ParrotType{types.Symbol{"with-meta"}, form, meta}, nil}, nil
+		return types.List{[]types.ParrotType{types.Symbol{"with-meta"}, form, meta}, token.Pos}, nil
 	case `@`:
 		rdr.next()
 		form, e := readForm(rdr)
 		if e != nil {
 			return nil, e
 		}
-		return types.List{[]types.ParrotType{types.Symbol{"deref"}, form}, nil}, nil
+		return types.List{[]types.ParrotType{types.Symbol{"deref"}, form}, token.Pos}, nil
 	case ")":
-		return nil, errors.New("unexpected ')'")
+		return nil, fmt.Errorf("%s: unexpected ')'", token.Pos)
 	case "(":
 		return readList(rdr, "(", ")")
 	case "]":
-		return nil, errors.New("unexpected ']'")
+		return nil, fmt.Errorf("%s: unexpected ']'", token.Pos)
 	case "[":
 		return readVector(rdr)
 	case "}":
-		return nil, errors.New("unexpected '}'")
+		return nil, fmt.Errorf("%s: unexpected '}'", token.Pos)
 	case "\n":
 		fmt.Println("hello")
 	case "{":
 		return readHashMap(rdr)
+	case "#{":
+		return readSet(rdr)
 	default:
 		return readAtom(rdr)
 	}
@@ -229,10 +342,15 @@ func readForm(rdr Reader) (types.ParrotType, error) {
 }
 
 func ReadStr(str string) (types.ParrotType, error) {
-	tokens := tokenize(str)
-	if len(tokens) == 0 {
+	return ReadStrFile(str, "")
+}
+
+// ReadStrFile is like ReadStr, but records file as the source of every
+// position it reads.
+func ReadStrFile(str string, file string) (types.ParrotType, error) {
+	form, e := NewReader(strings.NewReader(str), file).Read()
+	if e == io.EOF {
 		return nil, errors.New("<empty line>")
 	}
-
-	return readForm(&TokenReader{tokens: tokens, position: 0})
+	return form, e
 }
@@ -0,0 +1,209 @@
+package reader
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/sllt/parrot/printer"
+	"github.com/sllt/parrot/types"
+)
+
+func pos(t *testing.T, form types.ParrotType) types.Position {
+	t.Helper()
+	p, ok := types.GetPosition(form)
+	if !ok {
+		t.Fatalf("%v has no position", form)
+	}
+	return p
+}
+
+func TestPositions(t *testing.T) {
+	form, e := ReadStrFile("(def x\n  [1 {:a #{2}}]\n  '(y))", "a.pr")
+	if e != nil {
+		t.Fatal(e)
+	}
+	lst := form.(types.List)
+	vec := lst.Val[2].(types.Vector)
+	item, _ := vec.Val.Nth(1)
+	hm := item.(types.HashMap)
+	set, _ := hm.Val.Get(types.ParrotType("ʞa"))
+	quoted := lst.Val[3].(types.List)
+	for _, c := range []struct {
+		form types.ParrotType
+		want types.Position
+	}{
+		{lst, types.Position{"a.pr", 1, 1}},
+		{vec, types.Position{"a.pr", 2, 3}},
+		{hm, types.Position{"a.pr", 2, 6}},
+		{set, types.Position{"a.pr", 2, 10}},
+		{quoted, types.Position{"a.pr", 3, 3}},
+		{quoted.Val[1], types.Position{"a.pr", 3, 4}},
+	} {
+		if got := pos(t, c.form); got != c.want {
+			t.Errorf("%v at %v, want %v", c.form, got, c.want)
+		}
+	}
+	if got := pos(t, lst).String(); got != "a.pr:1:1" {
+		t.Errorf("position prints as %q", got)
+	}
+}
+
+func TestPositionsCountRunes(t *testing.T) {
+	form, e := ReadStr(`("é" (x))`)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if got := pos(t, form.(types.List).Val[1]); got != (types.Position{"", 1, 6}) {
+		t.Errorf("(x) at %v, want 1:6", got)
+	}
+}
+
+func TestReadForms(t *testing.T) {
+	r := NewReader(strings.NewReader("1 ; comment\n(a b)\n\n[c]"), "f.pr")
+	var forms []types.ParrotType
+	for {
+		form, e := r.Read()
+		if e == io.EOF {
+			break
+		}
+		if e != nil {
+			t.Fatal(e)
+		}
+		forms = append(forms, form)
+	}
+	if len(forms) != 3 {
+		t.Fatalf("read %d forms, want 3", len(forms))
+	}
+	if got := pos(t, forms[2]); got != (types.Position{"f.pr", 4, 1}) {
+		t.Errorf("[c] at %v, want f.pr:4:1", got)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	for src, want := range map[string]string{
+		"(a\n (b)": "expected ')' to close '(' opened at 1:1, got EOF",
+		"[1 2":     "expected ']' to close '[' opened at 1:1",
+		"\n  )":    "2:3: unexpected ')'",
+		"(a ]":     "1:4: unexpected ']'",
+		"{:a}":     "1:1: Odd number",
+		"#{1 1}":   "1:1: duplicate item in set literal",
+		`"abc`:     "1:1: unterminated string",
+		"":         "<empty line>",
+	} {
+		_, e := ReadStr(src)
+		if e == nil {
+			t.Errorf("%q: expected an error", src)
+		} else if !strings.Contains(e.Error(), want) {
+			t.Errorf("%q: error %q, want it to contain %q", src, e, want)
+		}
+	}
+}
+
+func TestReadSet(t *testing.T) {
+	form, e := ReadStr("#{1 [2] :a #{}}")
+	if e != nil {
+		t.Fatal(e)
+	}
+	s, ok := form.(types.Set)
+	if !ok {
+		t.Fatalf("read %T, want a set", form)
+	}
+	items := []types.ParrotType{types.Int64{1}, types.NewVector(types.Int64{2}), "ʞa", types.NewSet()}
+	for _, x := range items {
+		if !s.Has(x) {
+			t.Errorf("%v is missing from the set", x)
+		}
+	}
+	if s.Val.Len() != len(items) {
+		t.Errorf("read %d items, want %d", s.Val.Len(), len(items))
+	}
+}
+
+func TestReadStrings(t *testing.T) {
+	for src, want := range map[string]string{
+		`"plain"`:           "plain",
+		`"a\nb\tc\rd"`:      "a\nb\tc\rd",
+		`"\b\f"`:            "\b\f",
+		`"say \"hi\" \\o/"`: `say "hi" \o/`,
+		`"caf\u00e9"`:       "café",
+		`"\x41\x7e"`:        "A~",
+		`"\u03bb\u03bb"`:    "λλ",
+		`"é"`:               "é",
+	} {
+		form, e := ReadStr(src)
+		if e != nil {
+			t.Errorf("%s: %v", src, e)
+		} else if form != want {
+			t.Errorf("%s: read %q, want %q", src, form, want)
+		}
+	}
+}
+
+func TestReadChars(t *testing.T) {
+	for src, want := range map[string]rune{
+		`\a`:         'a',
+		`\é`:         'é',
+		`\\`:         '\\',
+		`\(`:         '(',
+		`\newline`:   '\n',
+		`\space`:     ' ',
+		`\tab`:       '\t',
+		`\return`:    '\r',
+		`\backspace`: '\b',
+		`\formfeed`:  '\f',
+		`\u03bb`:     'λ',
+	} {
+		form, e := ReadStr(src)
+		if e != nil {
+			t.Errorf("%s: %v", src, e)
+		} else if form != (types.Char{want}) {
+			t.Errorf("%s: read %v, want %q", src, form, want)
+		}
+	}
+	form, e := ReadStr(`[\a \b]`)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if got := printer.PrintStr(form, true); got != `[\a \b]` {
+		t.Errorf("read %s, want [\\a \\b]", got)
+	}
+}
+
+func TestEscapeErrors(t *testing.T) {
+	for src, want := range map[string]string{
+		`"\q"`:    "1:1: unsupported escape \\q",
+		`"\u12"`:  "1:1: invalid escape \\u12",
+		`"\xZZ"`:  "1:1: invalid escape \\xZZ",
+		`\nope`:   "1:1: unsupported char \\nope",
+		`\u12345`: "1:1: unsupported char \\u12345",
+	} {
+		_, e := ReadStr(src)
+		if e == nil {
+			t.Errorf("%s: expected an error", src)
+		} else if !strings.Contains(e.Error(), want) {
+			t.Errorf("%s: error %q, want it to contain %q", src, e, want)
+		}
+	}
+}
+
+// TestPrintRoundTrip checks that printing readably gives back what was
+// read.
+func TestPrintRoundTrip(t *testing.T) {
+	values := []types.ParrotType{
+		"tab\there\nand \"quotes\" \\ back",
+		"\x00\x1f\u2028",
+		"café λ",
+		types.Char{'a'}, types.Char{'\n'}, types.Char{' '}, types.Char{'\x01'}, types.Char{'λ'}, types.Char{'\\'},
+		types.NewVector(types.Char{'"'}, "\u00e9"),
+	}
+	for _, v := range values {
+		src := printer.PrintStr(v, true)
+		got, e := ReadStr(src)
+		if e != nil {
+			t.Errorf("%q printed as %s, which does not read: %v", v, src, e)
+		} else if !types.Equal_Q(got, v) {
+			t.Errorf("%q printed as %s, which reads as %q", v, src, got)
+		}
+	}
+}
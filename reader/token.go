@@ -0,0 +1,159 @@
+package reader
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/sllt/parrot/types"
+)
+
+// Token is a single lexical token and the position it starts at.
+type Token struct {
+	Val string
+	Pos types.Position
+}
+
+// lexer splits Parrot source into tokens, keeping track of line and column.
+type lexer struct {
+	in       io.RuneReader
+	file     string
+	line     int
+	col      int
+	ahead    rune
+	hasAhead bool
+	err      error
+}
+
+func newLexer(in io.RuneReader, file string) *lexer {
+	return &lexer{in: in, file: file, line: 1, col: 1}
+}
+
+func (l *lexer) peekRune() (rune, bool) {
+	if !l.hasAhead {
+		r, _, err := l.in.ReadRune()
+		if err != nil {
+			if err != io.EOF {
+				l.err = err
+			}
+			return 0, false
+		}
+		l.ahead = r
+		l.hasAhead = true
+	}
+	return l.ahead, true
+}
+
+func (l *lexer) nextRune() (rune, bool) {
+	r, ok := l.peekRune()
+	if !ok {
+		return 0, false
+	}
+	l.hasAhead = false
+	if r == '\n' {
+		l.line++
+		l.col = 1
+	} else {
+		l.col++
+	}
+	return r, true
+}
+
+func isDelimiter(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune("[]{}()'\"`,;", r)
+}
+
+// next returns the next token, or nil at the end of the input.
+func (l *lexer) next() (*Token, error) {
+	for {
+		r, ok := l.peekRune()
+		if !ok {
+			return nil, l.err
+		}
+		pos := types.Position{l.file, l.line, l.col}
+		switch {
+		case unicode.IsSpace(r) || r == ',':
+			l.nextRune()
+		case r == ';':
+			for r, ok := l.nextRune(); ok && r != '\n'; r, ok = l.nextRune() {
+			}
+		case r == '~':
+			l.nextRune()
+			if r, ok := l.peekRune(); ok && r == '@' {
+				l.nextRune()
+				return &Token{"~@", pos}, nil
+			}
+			return &Token{"~", pos}, nil
+		case strings.ContainsRune("[]{}()'`^@", r):
+			l.nextRune()
+			return &Token{string(r), pos}, nil
+		case r == '"':
+			return l.readString(pos)
+		case r == '\\':
+			// A char literal: the char after the backslash is taken even
+			// if it is a delimiter, as in \(.
+			l.nextRune()
+			prefix := `\`
+			if r, ok := l.nextRune(); ok {
+				prefix += string(r)
+			}
+			return l.readAtom(pos, prefix), nil
+		case r == '#':
+			l.nextRune()
+			r, ok := l.peekRune()
+			if ok && r == '{' {
+				l.nextRune()
+				return &Token{"#{", pos}, nil
+			}
+			if ok && r == '"' {
+				// a regex, whose backslashes are kept for the regex
+				token, e := l.readString(pos)
+				if e != nil {
+					return nil, e
+				}
+				token.Val = "#" + token.Val
+				return token, nil
+			}
+			return l.readAtom(pos, "#"), nil
+		default:
+			return l.readAtom(pos, ""), nil
+		}
+	}
+}
+
+// readAtom reads the rest of a token that starts with prefix, up to the
+// next delimiter.
+func (l *lexer) readAtom(pos types.Position, prefix string) *Token {
+	var b strings.Builder
+	b.WriteString(prefix)
+	for r, ok := l.peekRune(); ok && !isDelimiter(r); r, ok = l.peekRune() {
+		b.WriteRune(r)
+		l.nextRune()
+	}
+	return &Token{b.String(), pos}
+}
+
+func (l *lexer) readString(pos types.Position) (*Token, error) {
+	var b strings.Builder
+	r, _ := l.nextRune()
+	b.WriteRune(r)
+	for {
+		r, ok := l.nextRune()
+		if !ok {
+			if l.err != nil {
+				return nil, l.err
+			}
+			return nil, fmt.Errorf("%s: unterminated string, got EOF", pos)
+		}
+		b.WriteRune(r)
+		switch r {
+		case '\\':
+			if r, ok = l.nextRune(); ok {
+				b.WriteRune(r)
+			}
+		case '"':
+			return &Token{b.String(), pos}, nil
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package parrot
+
+import (
+	"testing"
+)
+
+func TestRegexLiterals(t *testing.T) {
+	expectBoth(t, map[string]string{
+		`#"\d+"`:       `#"\d+"`,
+		`(str #"a.c")`: `"a.c"`,
+		`[(regex? #"x") (regex? "x") (regex? (re-pattern "x"))]`:    "[true false true]",
+		`(re-find #"\d+" "ab 12 cd")`:                               `"12"`,
+		`(re-matches #"[a-z]+@[a-z]+" "me@host")`:                   `"me@host"`,
+		`(re-seq #"\w+" "split these words")`:                       `("split" "these" "words")`,
+		`(let [[_ k v] (re-find #"(\w+)=(\d+)" "n=42")] [k v])`:     `["n" "42"]`,
+		`(get (re-named-groups #"(?P<user>\w+)@" "me@host") :user)`: `"me"`,
+		`(re-replace #"\d+" "a1b22" (fn [m] (count m)))`:            `"a1b2"`,
+		`(re-replace #"(\w)(\w)" "abcd" "$2$1")`:                    `"badc"`,
+		`(filter (fn [s] (re-matches #"\d+" s)) ["1" "a" "22"])`:    `("1" "22")`,
+		`(read-string "#\"[\\\"]\"")`:                               `#"[\"]"`,
+	})
+	expectErrorBoth(t, map[string]string{
+		`#"("`:             "invalid regex",
+		`(re-find 1 "x")`:  "re-find: expected a regex, got 1",
+		`(re-find #"x" 1)`: "re-find: expected a string, got 1",
+	})
+}
@@ -0,0 +1,87 @@
+package parrot
+
+import (
+	"testing"
+)
+
+func TestLazySeqs(t *testing.T) {
+	expectBoth(t, map[string]string{
+		`(take 5 (iterate inc 0))`:                                             "(0 1 2 3 4)",
+		`(take 3 (drop 2 (range)))`:                                            "(2 3 4)",
+		`(take 4 (repeat :x))`:                                                 "(:x :x :x :x)",
+		`(take 5 (cycle [1 2]))`:                                               "(1 2 1 2 1)",
+		`(nth (iterate inc 0) 1000)`:                                           "1000",
+		`(take 3 (map * (range) (iterate inc 1)))`:                             "(0 2 6)",
+		`(take 3 (filter (fn [n] (= 0 (mod n 3))) (range)))`:                   "(0 3 6)",
+		`(lazy-cat [1 2] (list 3) "ab")`:                                       `(1 2 3 \a \b)`,
+		`(defn nats [n] (lazy-seq (cons n (nats (inc n))))) (take 3 (nats 7))`: "(7 8 9)",
+		`(seq? (lazy-seq nil))`:                                                "true",
+		`(seq (lazy-seq nil))`:                                                 "nil",
+		`(count (range 100000))`:                                               "100000",
+		// map realizes nothing until it is asked to
+		`(def calls (atom 0)) (def s (map (fn [x] (swap! calls inc) x) [1 2 3])) [@calls (realized? s)]`:           "[0 false]",
+		`(def calls (atom 0)) (def s (map (fn [x] (swap! calls inc) x) [1 2 3])) (doall s) [@calls (realized? s)]`: "[3 true]",
+		`(def calls (atom 0)) (dorun (map (fn [x] (swap! calls inc)) (range 4))) @calls`:                           "4",
+	})
+}
+
+func TestSeqLibrary(t *testing.T) {
+	expectBoth(t, map[string]string{
+		`(range 1 10 3)`: "(1 4 7)",
+		`(range 3 0 -1)`: "(3 2 1)",
+		`(filter (fn [n] (= 1 (mod n 2))) [1 2 3 4 5])`:    "(1 3 5)",
+		`(remove (fn [n] (= 1 (mod n 2))) (list 1 2 3 4))`: "(2 4)",
+		`(reduce + 0 (range 101))`:                         "5050",
+		`(reduce + [])`:                                    "0",
+		`(reduce conj [] "ab")`:                            `[\a \b]`,
+		`(partition 2 [1 2 3 4 5])`:                        "((1 2) (3 4))",
+		`(partition 2 1 [1 2 3])`:                          "((1 2) (2 3))",
+		`(interleave [1 2 3] "ab")`:                        `(1 \a 2 \b)`,
+		`(take-while (fn [n] (< n 0)) [-2 -1 0 1])`:        "(-2 -1)",
+		`(drop-while (fn [n] (< n 0)) [-2 -1 0 1])`:        "(0 1)",
+		`(mapcat (fn [x] [x x]) [1 2])`:                    "(1 1 2 2)",
+		`(map + [1 2 3] [10 20])`:                          "(11 22)",
+		`(into [] (list 1 2))`:                             "[1 2]",
+		`(into #{} [1 1 2])`:                               "#{1 2}",
+		`(some (fn [x] (> x 2)) [1 3])`:                    "true",
+		`(some (fn [x] (> x 2)) [1 2])`:                    "nil",
+		`(every? number? [1 2])`:                           "true",
+		`(last (range 5))`:                                 "4",
+		`(reverse [1 2 3])`:                                "(3 2 1)",
+		`(vec (take 3 (iterate (fn [x] (* 2 x)) 1)))`:      "[1 2 4]",
+		`(concat)`:            "()",
+		`(apply + (range 5))`: "10",
+	})
+}
+
+func TestSeqAbstraction(t *testing.T) {
+	expectBoth(t, map[string]string{
+		`(seq {:a 1})`:         "([:a 1])",
+		`(seq "")`:             "nil",
+		`(seq [])`:             "nil",
+		`(seq nil)`:            "nil",
+		`(next [1])`:           "nil",
+		`(rest nil)`:           "()",
+		`(first "abc")`:        `\a`,
+		`(rest "abc")`:         `(\b \c)`,
+		`(first #{:only})`:     ":only",
+		`(map inc (list 1 2))`: "(2 3)",
+		`(def c (makeChan 3)) (send c 1) (send c 2) (closeChan c) (doall (seq c))`: "(1 2)",
+	})
+}
+
+func TestForAndDoseq(t *testing.T) {
+	expectBoth(t, map[string]string{
+		`(for [x [1 2 3] y [:a :b] :when (= 1 (mod x 2))] [x y])`:                  "([1 :a] [1 :b] [3 :a] [3 :b])",
+		`(for [x (range) :let [y (* x x)] :while (< y 20)] y)`:                     "(0 1 4 9 16)",
+		`(for [[k v] {:a 1}] [v k])`:                                               "([1 :a])",
+		`(for [] 1)`:                                                               "(1)",
+		`(def acc (atom [])) (doseq [x [1 2] y "ab"] (swap! acc conj [x y])) @acc`: `[[1 \a] [1 \b] [2 \a] [2 \b]]`,
+		`(doseq [x [1 2]] x)`:                                                      "nil",
+	})
+	expectErrorBoth(t, map[string]string{
+		`(for [x] x)`:                 "even number of forms",
+		`(for [x [1] :until true] x)`: "unknown modifier :until",
+		`(for (x [1]) x)`:             "for requires a vector of bindings",
+	})
+}
@@ -0,0 +1,45 @@
+package parrot
+
+import (
+	"testing"
+)
+
+func TestSets(t *testing.T) {
+	expectBoth(t, map[string]string{
+		`#{}`:                                  "#{}",
+		`#{(+ 1 1)}`:                           "#{2}",
+		`(= #{1 2 3} #{3 2 1})`:                "true",
+		`[(#{1 2} 2) (#{1 2} 5)]`:              "[2 nil]",
+		`(filter #{1 3} [1 2 3 4])`:            "(1 3)",
+		`(= (set [1 1 2]) #{1 2})`:             "true",
+		`[(set? #{}) (set? []) (set? {})]`:     "[true false false]",
+		`(= (hash-set 1 1) #{1})`:              "true",
+		`(= (conj #{1} 2 1) #{1 2})`:           "true",
+		`(disj #{1 2 3} 2 3)`:                  "#{1}",
+		`(disj nil 1)`:                         "nil",
+		`(contains? #{[1]} '(1))`:              "true",
+		`[(get #{:a} :a) (get #{:a} :b)]`:      "[:a nil]",
+		`[(count #{}) (empty? #{}) (seq #{})]`: "[0 true nil]",
+		`(count (into #{} (range 1000)))`:      "1000",
+	})
+}
+
+func TestSetOperations(t *testing.T) {
+	expectBoth(t, map[string]string{
+		`(= (union #{1} #{2} #{3}) #{1 2 3})`:                           "true",
+		`[(union) (union #{1}) (union nil #{1})]`:                       "[#{} #{1} #{1}]",
+		`(intersection #{1 2 3} #{2 3} #{3})`:                           "#{3}",
+		`(intersection #{1} #{2})`:                                      "#{}",
+		`(= (difference #{1 2 3} #{2}) #{1 3})`:                         "true",
+		`(difference #{1 2} #{1} #{2})`:                                 "#{}",
+		`[(subset? #{1} #{1 2}) (subset? #{3} #{1}) (subset? #{} #{})]`: "[true false true]",
+		`[(superset? #{1 2} #{1}) (superset? #{1} #{1 2})]`:             "[true false]",
+	})
+	expectErrorBoth(t, map[string]string{
+		`#{1 1}`:           "duplicate item in set literal",
+		`(disj [1] 1)`:     "disj: expected a set, got [1]",
+		`(union #{1} [2])`: "union: expected a set, got [2]",
+		`(#{1})`:           "a set takes 1 argument, got 0",
+		`(set 1 2)`:        "set requires 1 arg",
+	})
+}
@@ -0,0 +1,19 @@
+package parrot
+
+import (
+	"testing"
+)
+
+func TestStringNamespace(t *testing.T) {
+	expectBoth(t, map[string]string{
+		`(require '[parrot.string :as s]) (s/join ", " (s/split-lines "a\nb"))`:              `"a, b"`,
+		`(require '[parrot.string :as s]) (map s/upper-case ["a" "b"])`:                      `("A" "B")`,
+		`(require '[parrot.string :as s]) [(s/count "héllo") (count "héllo")]`:               "[5 5]",
+		`(require '[parrot.string :as s]) (s/substring "héllo" 1 3)`:                         `"él"`,
+		`(parrot.string/trim "  x ")`:                                                        `"x"`,
+		`(require '[parrot.string :as s]) (s/replace "a1b2" #"\d" (fn [d] (str "<" d ">")))`: `"a<1>b<2>"`,
+	})
+	expectErrorBoth(t, map[string]string{
+		`(trim " x ")`: "'trim' not found",
+	})
+}
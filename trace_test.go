@@ -0,0 +1,65 @@
+package parrot
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	. "github.com/sllt/parrot/types"
+)
+
+func TestStackTrace(t *testing.T) {
+	src := `(defn inner [x]
+  (+ x :a))
+(defn middle [x]
+  (+ 1 (inner x)))
+(defn outer [x]
+  (middle x))
+(outer 1)`
+	for name, opts := range backends {
+		e := runError(t, src, opts...)
+		var ee *EvalError
+		if !errors.As(e, &ee) {
+			t.Fatalf("%s: got %T %v, want an *EvalError", name, e, e)
+		}
+		if ee.Pos != (Position{"", 2, 3}) {
+			t.Errorf("%s: failed at %v, want 2:3", name, ee.Pos)
+		}
+		if len(ee.Trace) < 2 {
+			t.Fatalf("%s: trace %v, want inner and middle", name, ee.Trace)
+		}
+		inner, middle := ee.Trace[0], ee.Trace[1]
+		if inner.Name != "inner" || inner.Pos != (Position{"", 4, 8}) {
+			t.Errorf("%s: innermost frame %+v, want inner called at 4:8", name, inner)
+		}
+		// outer calls middle in tail position, so middle takes over its frame
+		if middle.Name != "middle" || middle.Pos != (Position{"", 6, 3}) || middle.Tail != 1 {
+			t.Errorf("%s: second frame %+v, want middle called at 6:3 after a tail call", name, middle)
+		}
+		want := "    at 2:3\n    in inner, called at 4:8\n    in middle, called at 6:3 (after 1 tail calls)"
+		if got := ee.StackTrace(); !strings.HasPrefix(got, want) {
+			t.Errorf("%s: StackTrace() =\n%s\nwant it to start with\n%s", name, got, want)
+		}
+	}
+}
+
+func TestStackTraceOfCaughtError(t *testing.T) {
+	expectBoth(t, map[string]string{
+		`(defn f [] (throw "boom")) (try (f) (catch e e))`: `"boom"`,
+		`(try (nth [] 3) (catch e :caught))`:               ":caught",
+	})
+}
+
+// TestPositionsAreNotMeta checks that the positions the reader records stay
+// out of what meta returns.
+func TestPositionsAreNotMeta(t *testing.T) {
+	expectBoth(t, map[string]string{
+		`(meta '(1 2))`:                  "nil",
+		`(meta [1])`:                     "nil",
+		`(meta {})`:                      "nil",
+		`(meta #{1})`:                    "nil",
+		`(meta (read-string "[1 2]"))`:   "nil",
+		`(meta (with-meta [1] {:a 1}))`:  "{:a 1}",
+		`(meta (with-meta '(1) {:a 1}))`: "{:a 1}",
+	})
+}
@@ -0,0 +1,41 @@
+package parrot
+
+import (
+	"testing"
+)
+
+func TestTransients(t *testing.T) {
+	expectBoth(t, map[string]string{
+		`(persistent! (conj! (transient [1]) 2 3))`:                                                                             "[1 2 3]",
+		`(persistent! (assoc! (transient [1 2]) 0 :a 2 :c))`:                                                                    "[:a 2 :c]",
+		`(let [m (persistent! (dissoc! (assoc! (transient {:a 1}) :b 2) :a))] [(count m) (get m :b)])`:                          "[1 2]",
+		`(persistent! (conj! (transient {}) [:k :v]))`:                                                                          "{:k :v}",
+		`(let [v [1 2] t (transient v)] (conj! t 3) [v (persistent! t)])`:                                                       "[[1 2] [1 2 3]]",
+		`(count (persistent! (reduce conj! (transient []) (range 100000))))`:                                                    "100000",
+		`(let [m (persistent! (reduce (fn [t i] (assoc! t i (* i i))) (transient {}) (range 50000)))] [(count m) (get m 300)])`: "[50000 90000]",
+	})
+	expectErrorBoth(t, map[string]string{
+		`(let [t (transient [])] (persistent! t) (conj! t 1))`:    "transient used after persistent!",
+		`(let [t (transient {})] (persistent! t) (assoc! t 1 1))`: "transient used after persistent!",
+		`(transient '(1))`:             "transient requires a vector or hash-map",
+		`(conj! {} [1 2])`:             "conj! requires a transient",
+		`(conj! (transient {}) 1)`:     "conj! on a hash-map requires [key value] vectors",
+		`(assoc! (transient [1]) 5 1)`: "assoc!: index out of range",
+		`(assoc! (transient {}) :a)`:   "assoc! requires odd number of arguments",
+		`(dissoc! (transient [1]) 0)`:  "dissoc! requires a transient hash-map",
+		`(persistent! [1])`:            "persistent! requires a transient",
+	})
+}
+
+func TestPersistentUpdates(t *testing.T) {
+	expectBoth(t, map[string]string{
+		`(assoc [1 2] 2 3)`: "[1 2 3]",
+		`(let [v (vec (range 2000)) w (assoc v 1500 :x)] [(get v 1500) (get w 1500)])`:            "[1500 :x]",
+		`(let [v (vec (range 1056)) w (conj v :y)] [(count v) (nth w 1056)])`:                     "[1056 :y]",
+		`(let [m (reduce (fn [m i] (assoc m i i)) {} (range 100000))] [(count m) (get m 99999)])`: "[100000 99999]",
+		`(let [m {:a 1} n (assoc m :b 2) o (dissoc n :a)] [m (count n) o])`:                       "[{:a 1} 2 {:b 2}]",
+	})
+	expectErrorBoth(t, map[string]string{
+		`(assoc [1 2] 5 3)`: "index out of range",
+	})
+}
@@ -0,0 +1,210 @@
+package types
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/metrics"
+	"sync/atomic"
+)
+
+// Limits bounds the work evaluation may do. A zero field means no limit.
+// MaxSteps counts iterations of the Eval loop, so tail calls count too.
+// MaxDepth bounds how deeply Eval may nest, which grows by at least one
+// for every call that is not a tail call. MaxMemory bounds the bytes held
+// by the Go heap, which all goroutines of the program share, so it guards
+// the host against a runaway evaluation rather than accounting for each.
+type Limits struct {
+	MaxSteps  int64
+	MaxDepth  int64
+	MaxMemory int64
+}
+
+// LimitError is returned when evaluation runs out of its step, depth or
+// memory budget.
+type LimitError struct {
+	Limit string // "steps", "depth" or "memory"
+	Max   int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("evaluation exceeded the %s limit of %d", e.Limit, e.Max)
+}
+
+// ExitError is returned when code calls exit. It is up to the host to end
+// the program with Code, or to carry on.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit with status %d", e.Code)
+}
+
+// IsInterrupt reports whether e stops evaluation for good: a LimitError, an
+// ExitError or the cancellation of the evaluation's context. try does not
+// catch these.
+func IsInterrupt(e error) bool {
+	var le *LimitError
+	var ee *ExitError
+	return errors.As(e, &le) || errors.As(e, &ee) || errors.Is(e, context.Canceled) ||
+		errors.Is(e, context.DeadlineExceeded)
+}
+
+// how many steps pass between two checks of the contexts, and of the heap
+const (
+	ctxCheckInterval = 64
+	memCheckInterval = 1024
+)
+
+type run struct {
+	steps int64 // first, to keep it aligned for atomic access
+	ended int32 // set once the evaluation is over, updated atomically
+	Limits
+	base context.Context // cancels everything, goroutines included
+	ctx  context.Context // cancels the evaluation
+}
+
+// Budget tracks one evaluation against Limits and its context. All code of
+// the evaluation shares its step count and context; goroutines started
+// with go run on a Fork with a depth of their own. A budget may be used by
+// several goroutines at once.
+//
+// Once its evaluation is over, a budget only stops code that still runs
+// under it, such as goroutines and fns called back later, when the context
+// of the interpreter is done.
+//
+// The body of a reset runs on a budget that also holds its prompt, which
+// the shifts in the body find there.
+type Budget struct {
+	depth int64 // first, to keep it aligned for atomic access
+	*run
+	prompt interface{} // of the innermost reset, or nil
+}
+
+// NewBudget returns a budget that stops evaluation when ctx is done.
+func NewBudget(ctx context.Context, limits Limits) *Budget {
+	return &Budget{0, &run{Limits: limits, base: ctx, ctx: ctx}, nil}
+}
+
+// Evaluation returns a budget for an evaluation of its own, with b's
+// limits and a fresh step count, that stops when either ctx or the context
+// of b is done. The evaluation is over once end is called.
+func (b *Budget) Evaluation(ctx context.Context) (eval *Budget, end func()) {
+	r := &run{Limits: b.Limits, base: b.base, ctx: ctx}
+	return &Budget{0, r, nil}, func() { atomic.StoreInt32(&r.ended, 1) }
+}
+
+func (b *Budget) over() bool {
+	return atomic.LoadInt32(&b.ended) == 1
+}
+
+// context returns the context of the evaluation, or that of the
+// interpreter once the evaluation is over.
+func (b *Budget) context() context.Context {
+	if b.over() {
+		return b.base
+	}
+	return b.ctx
+}
+
+// Err returns the error of whichever of the contexts of b is done, or nil.
+func (b *Budget) Err() error {
+	if e := b.base.Err(); e != nil {
+		return e
+	}
+	return b.context().Err()
+}
+
+// Step accounts for one step of evaluation.
+func (b *Budget) Step() error {
+	steps := atomic.AddInt64(&b.steps, 1)
+	if b.MaxSteps > 0 && steps > b.MaxSteps && !b.over() {
+		return &LimitError{"steps", b.MaxSteps}
+	}
+	if b.MaxMemory > 0 && steps%memCheckInterval == 1 && heapSize() > uint64(b.MaxMemory) {
+		return &LimitError{"memory", b.MaxMemory}
+	}
+	if steps%ctxCheckInterval == 1 {
+		return b.Err()
+	}
+	return nil
+}
+
+// heapSize returns the bytes taken up by objects on the Go heap.
+func heapSize() uint64 {
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	metrics.Read(sample)
+	return sample[0].Value.Uint64()
+}
+
+// Enter accounts for a nested evaluation, which must be ended with Leave.
+func (b *Budget) Enter() error {
+	depth := atomic.AddInt64(&b.depth, 1)
+	if b.MaxDepth > 0 && depth > b.MaxDepth {
+		atomic.AddInt64(&b.depth, -1)
+		return &LimitError{"depth", b.MaxDepth}
+	}
+	return nil
+}
+
+func (b *Budget) Leave() {
+	atomic.AddInt64(&b.depth, -1)
+}
+
+// Fork returns a budget for a new goroutine.
+func (b *Budget) Fork() *Budget {
+	if b == nil {
+		return nil
+	}
+	return &Budget{0, b.run, nil}
+}
+
+// Delimit returns a budget for a new goroutine that runs the body of a
+// reset with prompt p.
+func (b *Budget) Delimit(p interface{}) *Budget {
+	return &Budget{0, b.run, p}
+}
+
+// Prompt returns the prompt of the innermost reset code running under b is
+// in, or nil.
+func (b *Budget) Prompt() interface{} {
+	if b == nil {
+		return nil
+	}
+	return b.prompt
+}
+
+// Send sends x on ch, or gives up with the error of the context that is done
+// if evaluation is cancelled first. A nil budget waits for ever.
+func (b *Budget) Send(ch chan ParrotType, x ParrotType) error {
+	if b == nil {
+		ch <- x
+		return nil
+	}
+	ctx := b.context()
+	select {
+	case ch <- x:
+		return nil
+	case <-b.base.Done():
+		return b.base.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Receive receives from ch like Send sends.
+func (b *Budget) Receive(ch chan ParrotType) (ParrotType, error) {
+	if b == nil {
+		return <-ch, nil
+	}
+	ctx := b.context()
+	select {
+	case x := <-ch:
+		return x, nil
+	case <-b.base.Done():
+		return nil, b.base.Err()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
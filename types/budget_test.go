@@ -0,0 +1,140 @@
+package types
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBudgetLimits(t *testing.T) {
+	b := NewBudget(context.Background(), Limits{MaxSteps: 3, MaxDepth: 2})
+	for i := 0; i < 3; i++ {
+		if e := b.Step(); e != nil {
+			t.Fatalf("step %d: %v", i, e)
+		}
+	}
+	var le *LimitError
+	if e := b.Step(); !errors.As(e, &le) || le.Limit != "steps" {
+		t.Errorf("4th step: got %v, want a steps LimitError", e)
+	}
+	eval, _ := b.Evaluation(context.Background())
+	if e := eval.Step(); e != nil {
+		t.Errorf("an evaluation has steps of its own: %v", e)
+	}
+
+	if e := b.Enter(); e != nil {
+		t.Fatal(e)
+	}
+	if e := b.Enter(); e != nil {
+		t.Fatal(e)
+	}
+	if e := b.Enter(); !errors.As(e, &le) || le.Limit != "depth" {
+		t.Errorf("3rd Enter: got %v, want a depth LimitError", e)
+	}
+	b.Leave()
+	if e := b.Enter(); e != nil {
+		t.Errorf("Enter after Leave: %v", e)
+	}
+	if e := b.Fork().Enter(); e != nil {
+		t.Errorf("a fork has a depth of its own: %v", e)
+	}
+}
+
+func TestBudgetEvaluation(t *testing.T) {
+	b := NewBudget(context.Background(), Limits{MaxSteps: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	eval, end := b.Evaluation(ctx)
+	if e := eval.Err(); !errors.Is(e, context.Canceled) {
+		t.Errorf("Err = %v, want context.Canceled", e)
+	}
+	if e := b.Err(); e != nil {
+		t.Errorf("the context of an evaluation cancelled its interpreter: %v", e)
+	}
+	eval.Step()
+	var le *LimitError
+	if e := eval.Step(); !errors.As(e, &le) {
+		t.Errorf("2nd step: got %v, want a LimitError", e)
+	}
+	end()
+	if e := eval.Err(); e != nil {
+		t.Errorf("Err after the evaluation = %v, want nil", e)
+	}
+	if e := eval.Step(); e != nil {
+		t.Errorf("Step after the evaluation = %v, want nil", e)
+	}
+
+	base, stop := context.WithCancel(context.Background())
+	stop()
+	eval, end = NewBudget(base, Limits{}).Evaluation(context.Background())
+	end()
+	if e := eval.Err(); !errors.Is(e, context.Canceled) {
+		t.Errorf("Err = %v, want the interpreter's context.Canceled", e)
+	}
+}
+
+func TestBudgetMemory(t *testing.T) {
+	b := NewBudget(context.Background(), Limits{MaxMemory: 1})
+	var le *LimitError
+	if e := b.Step(); !errors.As(e, &le) || le.Limit != "memory" {
+		t.Errorf("got %v, want a memory LimitError", e)
+	}
+	b = NewBudget(context.Background(), Limits{MaxMemory: 1 << 40})
+	if e := b.Step(); e != nil {
+		t.Errorf("got %v with a heap below the limit", e)
+	}
+}
+
+// TestBudgetConcurrent uses a budget from several goroutines at once, as
+// goroutines started with go and the bodies of reset do. Run it with -race.
+func TestBudgetConcurrent(t *testing.T) {
+	b := NewBudget(context.Background(), Limits{MaxDepth: 1000})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				if e := b.Enter(); e != nil {
+					t.Error(e)
+					return
+				}
+				b.Step()
+				b.Leave()
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		_, end := b.Evaluation(context.Background())
+		end()
+	}
+	wg.Wait()
+	if b.depth != 0 {
+		t.Errorf("depth = %d after balanced Enter and Leave, want 0", b.depth)
+	}
+}
+
+func TestBudgetChannelsCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	b, end := NewBudget(context.Background(), Limits{}).Evaluation(ctx)
+	defer end()
+	ch := make(chan ParrotType)
+	if _, e := b.Receive(ch); !errors.Is(e, context.DeadlineExceeded) {
+		t.Errorf("Receive = %v, want context.DeadlineExceeded", e)
+	}
+	if e := b.Send(ch, 1); !errors.Is(e, context.DeadlineExceeded) {
+		t.Errorf("Send = %v, want context.DeadlineExceeded", e)
+	}
+
+	b = NewBudget(context.Background(), Limits{})
+	ch = make(chan ParrotType, 1)
+	if e := b.Send(ch, Int64{1}); e != nil {
+		t.Fatal(e)
+	}
+	if x, e := b.Receive(ch); e != nil || x != (Int64{1}) {
+		t.Errorf("Receive = %v, %v, want 1", x, e)
+	}
+}
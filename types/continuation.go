@@ -0,0 +1,21 @@
+package types
+
+import "errors"
+
+// Escape carries a value from a continuation back to where it was
+// captured, unwinding the calls in between like an error. try does not
+// catch it.
+type Escape struct {
+	Target interface{} // what captured the continuation
+	Val    ParrotType
+}
+
+func (e *Escape) Error() string {
+	return "continuation invoked outside of the form that captured it"
+}
+
+// IsEscape reports whether e unwinds the stack for a continuation.
+func IsEscape(e error) bool {
+	var esc *Escape
+	return errors.As(e, &esc)
+}
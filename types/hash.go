@@ -0,0 +1,79 @@
+package types
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"reflect"
+)
+
+// Hash returns a hash of obj that agrees with Equal_Q: values that are
+// equal have the same hash. Lists, vectors and other sequences hash alike
+// when they have the same items, and the hash of a map does not depend on
+// the order of its entries. Values compared by identity, such as atoms,
+// hash by their type alone.
+func Hash(obj ParrotType) uint32 {
+	switch v := obj.(type) {
+	case nil:
+		return 0
+	case string:
+		return hashBytes(0, []byte(v))
+	case Symbol:
+		return hashBytes(1, []byte(v.Val))
+	case Int64, int, BigInt, Ratio, Float64:
+		// numbers of any kind that are equal have the same value as a
+		// float, even when they are compared exactly
+		f, _ := FloatOf(v)
+		if f == 0 {
+			f = 0 // -0 equals 0
+		}
+		return hashUint(4, math.Float64bits(f))
+	case Char:
+		return hashUint(15, uint64(v.Val))
+	case bool:
+		if v {
+			return 5
+		}
+		return 6
+	case Bool:
+		if v.Val {
+			return 7
+		}
+		return 8
+	case List, Vector, *LazySeq, Cons:
+		slc, _ := GetSlice(v)
+		h := uint32(9)
+		for _, item := range slc {
+			h = h*31 + Hash(item)
+		}
+		return h
+	case HashMap:
+		h := uint32(10)
+		v.Val.Range(func(k, val ParrotType) bool {
+			h += Hash(k) ^ (Hash(val) * 31)
+			return true
+		})
+		return h
+	case Set:
+		h := uint32(12)
+		v.Val.Range(func(k, _ ParrotType) bool {
+			h += Hash(k)
+			return true
+		})
+		return h
+	}
+	return hashBytes(11, []byte(reflect.TypeOf(obj).String()))
+}
+
+func hashBytes(kind byte, b []byte) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte{kind})
+	h.Write(b)
+	return h.Sum32()
+}
+
+func hashUint(kind byte, n uint64) uint32 {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], n)
+	return hashBytes(kind, b[:])
+}
@@ -0,0 +1,89 @@
+package types
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestEqualValuesHashAlike(t *testing.T) {
+	lazy := NewLazySeq(func() (ParrotType, error) {
+		return Cons{Int64{1}, List{[]ParrotType{Int64{2}}, nil}}, nil
+	})
+	pairs := [][2]ParrotType{
+		{Int64{5}, BigInt{big.NewInt(5)}},
+		{Ratio{big.NewRat(1, 2)}, Ratio{big.NewRat(2, 4)}},
+		{Float64{0}, Float64{math.Copysign(0, -1)}},
+		{Int64{1}, Float64{1}},
+		{BigInt{big.NewInt(5)}, Float64{5}},
+		{Ratio{big.NewRat(1, 2)}, Float64{0.5}},
+		{NewVector(Int64{1}), NewVector(Float64{1})},
+		{NewVector(Int64{1}, Int64{2}), List{[]ParrotType{Int64{1}, Int64{2}}, nil}},
+		{NewVector(Int64{1}, Int64{2}), lazy},
+		{NewVector(), List{}},
+		{HashMap{NewMap("ʞa", Int64{1}, "ʞb", Int64{2}), nil}, HashMap{NewMap("ʞb", Int64{2}, "ʞa", Int64{1}), nil}},
+		{HashMap{NewMap(NewVector(Int64{0}), Int64{1}), nil}, HashMap{NewMap(List{[]ParrotType{Int64{0}}, nil}, Int64{1}), nil}},
+		{NewSet(Int64{1}, Int64{2}, Int64{3}), NewSet(Int64{3}, Int64{2}, Int64{1})},
+		{NewVector(NewSet("x"), Symbol{"y"}), NewVector(NewSet("x"), Symbol{"y"})},
+		{Char{'a'}, Char{'a'}},
+		{nil, nil},
+	}
+	for _, p := range pairs {
+		if !Equal_Q(p[0], p[1]) {
+			t.Errorf("%v and %v are not equal", p[0], p[1])
+			continue
+		}
+		if Hash(p[0]) != Hash(p[1]) {
+			t.Errorf("%v and %v are equal but hash to %d and %d", p[0], p[1], Hash(p[0]), Hash(p[1]))
+		}
+	}
+}
+
+func TestDistinctKeys(t *testing.T) {
+	keys := []ParrotType{
+		"k", "ʞk", Symbol{"k"}, Char{'k'},
+		Int64{1}, Float64{1.5}, Ratio{big.NewRat(1, 3)},
+		true, false, nil,
+		NewVector(Int64{1}), NewVector(Int64{1}, Int64{2}), NewVector(Int64{2}, Int64{1}),
+		NewSet(Int64{1}), HashMap{NewMap(Int64{1}, Int64{1}), nil},
+	}
+	m := PersistentMap{}
+	for i, k := range keys {
+		m = m.Assoc(k, i)
+	}
+	if m.Len() != len(keys) {
+		t.Fatalf("got %d entries for %d distinct keys", m.Len(), len(keys))
+	}
+	for i, k := range keys {
+		if got, ok := m.Get(k); !ok || got != i {
+			t.Errorf("%v: got %v, want %d", k, got, i)
+		}
+	}
+}
+
+func TestMapKeysByValue(t *testing.T) {
+	m := NewMap(
+		NewVector(Int64{0}, Int64{0}), "origin",
+		"ʞk", "keyword",
+		"k", "string",
+		Symbol{"k"}, "symbol",
+		Int64{1}, "one",
+		nil, "nil",
+	)
+	lookups := map[string]ParrotType{
+		"origin":  NewVector(Int64{0}, Int64{0}),
+		"keyword": "ʞk",
+		"string":  "k",
+		"symbol":  Symbol{"k"},
+		"one":     Int64{1},
+		"nil":     nil,
+	}
+	for want, key := range lookups {
+		if got, ok := m.Get(key); !ok || got != want {
+			t.Errorf("%v: got %v, want %s", key, got, want)
+		}
+	}
+	if got, ok := m.Get(List{[]ParrotType{Int64{0}, Int64{0}}, nil}); !ok || got != "origin" {
+		t.Errorf("a list did not find the equal vector key: got %v", got)
+	}
+}
@@ -0,0 +1,112 @@
+package types
+
+import "math/big"
+
+// BigInt is an integer of any size. Int64 arithmetic that overflows returns
+// a BigInt, and a BigInt is written with an N suffix, as in 1N.
+type BigInt struct {
+	Val *big.Int
+}
+
+// Ratio is an exact fraction, such as the result of (/ 1 3). Its Val is in
+// lowest terms, and never has a denominator of 1.
+type Ratio struct {
+	Val *big.Rat
+}
+
+func BigInt_Q(obj ParrotType) bool {
+	_, ok := obj.(BigInt)
+	return ok
+}
+
+func Ratio_Q(obj ParrotType) bool {
+	_, ok := obj.(Ratio)
+	return ok
+}
+
+// Integer_Q reports whether obj is an Int64 or a BigInt.
+func Integer_Q(obj ParrotType) bool {
+	switch obj.(type) {
+	case Int64, int, BigInt:
+		return true
+	}
+	return false
+}
+
+// NewRatio returns r as a Ratio, or as an integer if it is one: an Int64
+// if it fits, and a BigInt otherwise.
+func NewRatio(r *big.Rat) ParrotType {
+	if !r.IsInt() {
+		return Ratio{r}
+	}
+	return NewInteger(new(big.Int).Set(r.Num()))
+}
+
+// NewInteger returns n as an Int64 if it fits, and as a BigInt otherwise.
+func NewInteger(n *big.Int) ParrotType {
+	if n.IsInt64() {
+		return Int64{n.Int64()}
+	}
+	return BigInt{n}
+}
+
+// BigIntOf returns the integer obj as a big.Int.
+func BigIntOf(obj ParrotType) (*big.Int, bool) {
+	switch n := obj.(type) {
+	case Int64:
+		return big.NewInt(n.Val), true
+	case int:
+		return big.NewInt(int64(n)), true
+	case BigInt:
+		return n.Val, true
+	}
+	return nil, false
+}
+
+// RatOf returns the exact number obj, an integer or a Ratio, as a big.Rat.
+func RatOf(obj ParrotType) (*big.Rat, bool) {
+	if r, ok := obj.(Ratio); ok {
+		return r.Val, true
+	}
+	if n, ok := BigIntOf(obj); ok {
+		return new(big.Rat).SetInt(n), true
+	}
+	return nil, false
+}
+
+// FloatOf returns the number obj as a float64, rounding it if it is exact.
+func FloatOf(obj ParrotType) (float64, bool) {
+	switch n := obj.(type) {
+	case Float64:
+		return n.Val, true
+	case Int64:
+		return float64(n.Val), true
+	case Ratio:
+		f, _ := n.Val.Float64()
+		return f, true
+	}
+	if n, ok := BigIntOf(obj); ok {
+		f, _ := new(big.Float).SetInt(n).Float64()
+		return f, true
+	}
+	return 0, false
+}
+
+// numberEqual compares the numbers a and b by value, as = does, so that 1,
+// 1N and 1.0 are equal. Integers and ratios are compared exactly, and with
+// a float as floats.
+func numberEqual(a, b ParrotType) bool {
+	if x, ok := a.(Int64); ok {
+		if y, ok := b.(Int64); ok {
+			return x == y
+		}
+	}
+	if x, ok := RatOf(a); ok {
+		if y, ok := RatOf(b); ok {
+			return x.Cmp(y) == 0
+		}
+	}
+	x, _ := FloatOf(a)
+	y, _ := FloatOf(b)
+	return x == y
+}
@@ -0,0 +1,323 @@
+package types
+
+import "math/bits"
+
+// PersistentMap is an immutable hash map: a hash array mapped trie, whose
+// nodes hold up to 32 entries or children each, chosen by 5 bits of the
+// hash of a key per level. Assoc, Dissoc and Get take O(log32 n) time, and
+// the maps they return share all but one path of nodes with the map they
+// were called on. The zero value is an empty map.
+type PersistentMap struct {
+	count int
+	root  *mapNode
+}
+
+// mapNode is either a bitmap node, whose entries are those of the bits set
+// in bitmap, in order, or a collision node, whose entries all have the
+// same hash.
+type mapNode struct {
+	edit      *editToken
+	bitmap    uint32
+	collision bool
+	hash      uint32
+	entries   []mapEntry
+}
+
+// mapEntry is a key and its value, or a child node when node is set.
+type mapEntry struct {
+	key, val ParrotType
+	node     *mapNode
+}
+
+func keyEqual(a, b ParrotType) bool {
+	if s, ok := a.(string); ok {
+		t, ok := b.(string)
+		return ok && s == t
+	}
+	return Equal_Q(a, b)
+}
+
+// NewMap returns a map of the keys and values in kvs, which alternate.
+func NewMap(kvs ...ParrotType) PersistentMap {
+	t := PersistentMap{}.Transient()
+	for i := 0; i+1 < len(kvs); i += 2 {
+		t.Assoc(kvs[i], kvs[i+1])
+	}
+	return t.Persistent()
+}
+
+func (m PersistentMap) Len() int {
+	return m.count
+}
+
+// Get returns the value of key, and whether m has key.
+func (m PersistentMap) Get(key ParrotType) (ParrotType, bool) {
+	if m.root == nil {
+		return nil, false
+	}
+	return m.root.find(0, Hash(key), key)
+}
+
+// Assoc returns m with key set to val.
+func (m PersistentMap) Assoc(key, val ParrotType) PersistentMap {
+	added := false
+	root := m.root
+	if root == nil {
+		root = &mapNode{}
+	}
+	root = root.assoc(nil, 0, Hash(key), key, val, &added)
+	if added {
+		return PersistentMap{m.count + 1, root}
+	}
+	return PersistentMap{m.count, root}
+}
+
+// Dissoc returns m without key.
+func (m PersistentMap) Dissoc(key ParrotType) PersistentMap {
+	if m.root == nil {
+		return m
+	}
+	removed := false
+	root := m.root.dissoc(nil, 0, Hash(key), key, &removed)
+	if !removed {
+		return m
+	}
+	return PersistentMap{m.count - 1, root}
+}
+
+// Range calls f with each key and value in m, until f returns false.
+func (m PersistentMap) Range(f func(key, val ParrotType) bool) {
+	if m.root != nil {
+		m.root.each(f)
+	}
+}
+
+// Keys returns the keys of m.
+func (m PersistentMap) Keys() []ParrotType {
+	keys := make([]ParrotType, 0, m.count)
+	m.Range(func(k, _ ParrotType) bool {
+		keys = append(keys, k)
+		return true
+	})
+	return keys
+}
+
+// Transient returns a transient copy of m.
+func (m PersistentMap) Transient() *TransientMap {
+	return &TransientMap{&editToken{true}, m.count, m.root}
+}
+
+func (n *mapNode) find(shift uint, hash uint32, key ParrotType) (ParrotType, bool) {
+	for {
+		if n.collision {
+			for _, e := range n.entries {
+				if keyEqual(key, e.key) {
+					return e.val, true
+				}
+			}
+			return nil, false
+		}
+		bit := uint32(1) << ((hash >> shift) & trieMask)
+		if n.bitmap&bit == 0 {
+			return nil, false
+		}
+		e := n.entries[n.index(bit)]
+		if e.node == nil {
+			if keyEqual(key, e.key) {
+				return e.val, true
+			}
+			return nil, false
+		}
+		n, shift = e.node, shift+trieBits
+	}
+}
+
+func (n *mapNode) index(bit uint32) int {
+	return bits.OnesCount32(n.bitmap & (bit - 1))
+}
+
+// editable returns n if edit may change it in place, and a copy of it that
+// edit may change otherwise.
+func (n *mapNode) editable(edit *editToken) *mapNode {
+	if edit != nil && n.edit == edit {
+		return n
+	}
+	c := *n
+	c.edit = edit
+	c.entries = append(make([]mapEntry, 0, len(n.entries)+1), n.entries...)
+	return &c
+}
+
+func (n *mapNode) set(edit *editToken, i int, e mapEntry) *mapNode {
+	ret := n.editable(edit)
+	ret.entries[i] = e
+	return ret
+}
+
+func (n *mapNode) assoc(edit *editToken, shift uint, hash uint32, key, val ParrotType, added *bool) *mapNode {
+	if n.collision {
+		if hash == n.hash {
+			for i, e := range n.entries {
+				if keyEqual(key, e.key) {
+					return n.set(edit, i, mapEntry{key, val, nil})
+				}
+			}
+			*added = true
+			ret := n.editable(edit)
+			ret.entries = append(ret.entries, mapEntry{key, val, nil})
+			return ret
+		}
+		// Nest the collision node in a bitmap node, to tell the two
+		// hashes apart at this level or below.
+		parent := &mapNode{edit: edit, bitmap: 1 << ((n.hash >> shift) & trieMask),
+			entries: []mapEntry{{nil, nil, n}}}
+		return parent.assoc(edit, shift, hash, key, val, added)
+	}
+	bit := uint32(1) << ((hash >> shift) & trieMask)
+	i := n.index(bit)
+	if n.bitmap&bit == 0 {
+		*added = true
+		ret := n.editable(edit)
+		ret.entries = append(ret.entries, mapEntry{})
+		copy(ret.entries[i+1:], ret.entries[i:])
+		ret.entries[i] = mapEntry{key, val, nil}
+		ret.bitmap |= bit
+		return ret
+	}
+	e := n.entries[i]
+	if e.node != nil {
+		child := e.node.assoc(edit, shift+trieBits, hash, key, val, added)
+		if child == e.node {
+			return n
+		}
+		return n.set(edit, i, mapEntry{nil, nil, child})
+	}
+	if keyEqual(key, e.key) {
+		return n.set(edit, i, mapEntry{key, val, nil})
+	}
+	*added = true
+	child := pairNode(edit, shift+trieBits, Hash(e.key), e.key, e.val, hash, key, val)
+	return n.set(edit, i, mapEntry{nil, nil, child})
+}
+
+// pairNode returns a node of two entries whose hashes agree up to shift.
+func pairNode(edit *editToken, shift uint, h1 uint32, k1, v1 ParrotType, h2 uint32, k2, v2 ParrotType) *mapNode {
+	if h1 == h2 {
+		return &mapNode{edit: edit, collision: true, hash: h1,
+			entries: []mapEntry{{k1, v1, nil}, {k2, v2, nil}}}
+	}
+	added := false
+	n := (&mapNode{edit: edit}).assoc(edit, shift, h1, k1, v1, &added)
+	return n.assoc(edit, shift, h2, k2, v2, &added)
+}
+
+// dissoc returns n without key, or nil when nothing is left of n.
+func (n *mapNode) dissoc(edit *editToken, shift uint, hash uint32, key ParrotType, removed *bool) *mapNode {
+	if n.collision {
+		for i, e := range n.entries {
+			if keyEqual(key, e.key) {
+				*removed = true
+				if len(n.entries) == 1 {
+					return nil
+				}
+				return n.remove(edit, i, 0)
+			}
+		}
+		return n
+	}
+	bit := uint32(1) << ((hash >> shift) & trieMask)
+	if n.bitmap&bit == 0 {
+		return n
+	}
+	i := n.index(bit)
+	e := n.entries[i]
+	if e.node != nil {
+		child := e.node.dissoc(edit, shift+trieBits, hash, key, removed)
+		if child == e.node {
+			return n
+		}
+		if child != nil {
+			return n.set(edit, i, mapEntry{nil, nil, child})
+		}
+	} else if !keyEqual(key, e.key) {
+		return n
+	} else {
+		*removed = true
+	}
+	if n.bitmap == bit {
+		return nil
+	}
+	return n.remove(edit, i, bit)
+}
+
+func (n *mapNode) remove(edit *editToken, i int, bit uint32) *mapNode {
+	ret := n.editable(edit)
+	ret.entries = append(ret.entries[:i], ret.entries[i+1:]...)
+	ret.bitmap &^= bit
+	return ret
+}
+
+func (n *mapNode) each(f func(key, val ParrotType) bool) bool {
+	for _, e := range n.entries {
+		if e.node != nil {
+			if !e.node.each(f) {
+				return false
+			}
+		} else if !f(e.key, e.val) {
+			return false
+		}
+	}
+	return true
+}
+
+// TransientMap is a map that changes in place, for building a map in many
+// steps without copying a path of nodes at each of them. It must not be
+// used after Persistent, nor by several goroutines at once.
+type TransientMap struct {
+	edit  *editToken
+	count int
+	root  *mapNode
+}
+
+func (t *TransientMap) Len() int {
+	return t.count
+}
+
+// Assoc sets key to val in t.
+func (t *TransientMap) Assoc(key, val ParrotType) error {
+	if !t.edit.live {
+		return errTransient
+	}
+	if t.root == nil {
+		t.root = &mapNode{edit: t.edit}
+	}
+	added := false
+	t.root = t.root.assoc(t.edit, 0, Hash(key), key, val, &added)
+	if added {
+		t.count++
+	}
+	return nil
+}
+
+// Dissoc removes key from t.
+func (t *TransientMap) Dissoc(key ParrotType) error {
+	if !t.edit.live {
+		return errTransient
+	}
+	if t.root == nil {
+		return nil
+	}
+	removed := false
+	t.root = t.root.dissoc(t.edit, 0, Hash(key), key, &removed)
+	if removed {
+		t.count--
+	}
+	return nil
+}
+
+// Persistent returns the entries of t as a persistent map, and ends the use
+// of t.
+func (t *TransientMap) Persistent() PersistentMap {
+	t.edit.live = false
+	return PersistentMap{t.count, t.root}
+}
@@ -0,0 +1,128 @@
+package types
+
+import (
+	"testing"
+)
+
+func mapOf(n int) PersistentMap {
+	m := PersistentMap{}
+	for i := 0; i < n; i++ {
+		m = m.Assoc(Int64{int64(i)}, i)
+	}
+	return m
+}
+
+// checkMap fails t unless m maps the integers below n to themselves, except
+// for the keys in want, which it maps to want's values, or lacks when they
+// are nil.
+func checkMap(t *testing.T, m PersistentMap, n int, want map[int]ParrotType) {
+	t.Helper()
+	count := 0
+	for i := 0; i < n; i++ {
+		var x ParrotType = i
+		if w, ok := want[i]; ok {
+			x = w
+		}
+		got, ok := m.Get(Int64{int64(i)})
+		if x == nil {
+			if ok {
+				t.Fatalf("key %d: got %v, want none", i, got)
+			}
+			continue
+		}
+		count++
+		if !ok || got != x {
+			t.Fatalf("key %d: got %v, want %v", i, got, x)
+		}
+	}
+	if m.Len() != count || len(m.Keys()) != count {
+		t.Fatalf("got %d entries and %d keys, want %d", m.Len(), len(m.Keys()), count)
+	}
+	if _, ok := m.Get(Int64{int64(n)}); ok {
+		t.Errorf("key %d is in the map", n)
+	}
+}
+
+func TestMapAssoc(t *testing.T) {
+	for _, n := range []int{0, 1, 32, 33, 1000, 100000} {
+		checkMap(t, mapOf(n), n, nil)
+	}
+}
+
+func TestMapIsPersistent(t *testing.T) {
+	m := mapOf(5000)
+	replaced := m.Assoc(Int64{7}, "seven")
+	removed := replaced.Dissoc(Int64{8}).Dissoc(Int64{9000})
+	emptied := PersistentMap{}
+	for i := 0; i < 5000; i++ {
+		emptied = emptied.Assoc(Int64{int64(i)}, i)
+	}
+	for i := 0; i < 5000; i++ {
+		emptied = emptied.Dissoc(Int64{int64(i)})
+	}
+	checkMap(t, m, 5000, nil)
+	checkMap(t, replaced, 5000, map[int]ParrotType{7: "seven"})
+	checkMap(t, removed, 5000, map[int]ParrotType{7: "seven", 8: nil})
+	checkMap(t, emptied, 0, nil)
+}
+
+func TestMapCollisions(t *testing.T) {
+	// atoms are compared by identity, and all hash alike
+	a, b := &Atom{1, nil}, &Atom{1, nil}
+	if Hash(a) != Hash(b) {
+		t.Fatal("two atoms hash differently")
+	}
+	m := NewMap(a, "a", b, "b", Int64{-1}, "other")
+	if m.Len() != 3 {
+		t.Fatalf("got %d entries, want 3", m.Len())
+	}
+	for k, want := range map[ParrotType]string{a: "a", b: "b", Int64{-1}: "other"} {
+		if got, ok := m.Get(k); !ok || got != want {
+			t.Errorf("%v: got %v, want %s", k, got, want)
+		}
+	}
+	m2 := m.Assoc(b, "b2").Dissoc(a)
+	if got, ok := m2.Get(b); !ok || got != "b2" {
+		t.Errorf("got %v after replacing a colliding key", got)
+	}
+	if _, ok := m2.Get(a); ok || m2.Len() != 2 {
+		t.Errorf("a colliding key survived dissoc")
+	}
+	if got, _ := m.Get(b); got != "b" {
+		t.Errorf("the original map changed to %v", got)
+	}
+}
+
+func TestMapRangeStops(t *testing.T) {
+	m := mapOf(100)
+	n := 0
+	m.Range(func(_, _ ParrotType) bool {
+		n++
+		return n < 10
+	})
+	if n != 10 {
+		t.Errorf("range went on for %d entries after being stopped at 10", n)
+	}
+}
+
+func TestTransientMap(t *testing.T) {
+	m := mapOf(100)
+	tr := m.Transient()
+	for i := 100; i < 2000; i++ {
+		tr.Assoc(Int64{int64(i)}, i)
+	}
+	tr.Assoc(Int64{0}, "zero")
+	tr.Dissoc(Int64{1})
+	tr.Dissoc(Int64{5000})
+	built := tr.Persistent()
+	checkMap(t, built, 2000, map[int]ParrotType{0: "zero", 1: nil})
+	checkMap(t, m, 100, nil)
+	if e := tr.Assoc(Int64{0}, nil); e != errTransient {
+		t.Errorf("got %v after persistent, want %v", e, errTransient)
+	}
+	if e := tr.Dissoc(Int64{0}); e != errTransient {
+		t.Errorf("got %v after persistent, want %v", e, errTransient)
+	}
+	checkMap(t, built.Assoc(Int64{3}, "three"), 2000, map[int]ParrotType{0: "zero", 1: nil, 3: "three"})
+	checkMap(t, built, 2000, map[int]ParrotType{0: "zero", 1: nil})
+}
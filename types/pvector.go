@@ -0,0 +1,264 @@
+package types
+
+import "errors"
+
+// PersistentVector is an immutable vector. It keeps its items in a trie of
+// nodes with 32 children each, plus a tail of up to 32 items that is not in
+// the trie yet, so that Conj, Assoc and Nth take O(log32 n) time, and share
+// all but one path of nodes with the vector they were called on. The zero
+// value is an empty vector.
+type PersistentVector struct {
+	cnt   int
+	shift uint
+	root  *vecNode
+	tail  []ParrotType
+}
+
+const (
+	trieBits  = 5
+	trieWidth = 1 << trieBits
+	trieMask  = trieWidth - 1
+)
+
+// editToken marks the nodes that a transient created, and may therefore
+// change in place. A transient kills its token when it is made persistent.
+type editToken struct {
+	live bool
+}
+
+// vecNode holds *vecNode children in the inner levels of the trie, and the
+// items of the vector in its leaves.
+type vecNode struct {
+	edit  *editToken
+	array [trieWidth]ParrotType
+}
+
+var emptyVecNode = &vecNode{}
+
+// NewVector returns a vector of items.
+func NewVector(items ...ParrotType) Vector {
+	t := PersistentVector{}.Transient()
+	for _, x := range items {
+		t.Conj(x)
+	}
+	return Vector{t.Persistent(), nil}
+}
+
+func (v PersistentVector) Len() int {
+	return v.cnt
+}
+
+func (v PersistentVector) trie() (*vecNode, uint) {
+	if v.root == nil {
+		return emptyVecNode, trieBits
+	}
+	return v.root, v.shift
+}
+
+func (v PersistentVector) tailOff() int {
+	if v.cnt < trieWidth {
+		return 0
+	}
+	return ((v.cnt - 1) >> trieBits) << trieBits
+}
+
+// leaf returns the items of the leaf, or tail, that holds item i.
+func (v PersistentVector) leaf(i int) []ParrotType {
+	if i >= v.tailOff() {
+		return v.tail
+	}
+	node, shift := v.trie()
+	for level := shift; level > 0; level -= trieBits {
+		node = node.array[(i>>level)&trieMask].(*vecNode)
+	}
+	return node.array[:]
+}
+
+// Nth returns item i, and false if i is out of range.
+func (v PersistentVector) Nth(i int) (ParrotType, bool) {
+	if i < 0 || i >= v.cnt {
+		return nil, false
+	}
+	return v.leaf(i)[i&trieMask], true
+}
+
+// Slice returns a new slice of the items of v.
+func (v PersistentVector) Slice() []ParrotType {
+	slc := make([]ParrotType, 0, v.cnt)
+	for i := 0; i < v.cnt; i += trieWidth {
+		leaf := v.leaf(i)
+		if n := v.cnt - i; n < len(leaf) {
+			leaf = leaf[:n]
+		}
+		slc = append(slc, leaf...)
+	}
+	return slc
+}
+
+// Conj returns v with x added at the end.
+func (v PersistentVector) Conj(x ParrotType) PersistentVector {
+	if v.cnt-v.tailOff() < trieWidth {
+		tail := make([]ParrotType, len(v.tail)+1)
+		copy(tail, v.tail)
+		tail[len(v.tail)] = x
+		return PersistentVector{v.cnt + 1, v.shift, v.root, tail}
+	}
+	root, shift := v.trie()
+	full := &vecNode{}
+	copy(full.array[:], v.tail)
+	if (v.cnt >> trieBits) > (1 << shift) {
+		grown := &vecNode{}
+		grown.array[0] = root
+		grown.array[1] = newPath(nil, shift, full)
+		root, shift = grown, shift+trieBits
+	} else {
+		root = pushTail(nil, v.cnt, shift, root, full)
+	}
+	return PersistentVector{v.cnt + 1, shift, root, []ParrotType{x}}
+}
+
+// Assoc returns v with item i replaced by x. i may be the length of v, to
+// add x at the end.
+func (v PersistentVector) Assoc(i int, x ParrotType) (PersistentVector, error) {
+	if i == v.cnt {
+		return v.Conj(x), nil
+	}
+	if i < 0 || i > v.cnt {
+		return v, errors.New("index out of range")
+	}
+	if i >= v.tailOff() {
+		tail := append([]ParrotType{}, v.tail...)
+		tail[i&trieMask] = x
+		return PersistentVector{v.cnt, v.shift, v.root, tail}, nil
+	}
+	root, shift := v.trie()
+	return PersistentVector{v.cnt, shift, assocPath(nil, shift, root, i, x), v.tail}, nil
+}
+
+// Transient returns a transient copy of v.
+func (v PersistentVector) Transient() *TransientVector {
+	root, shift := v.trie()
+	edit := &editToken{true}
+	tail := make([]ParrotType, len(v.tail), trieWidth)
+	copy(tail, v.tail)
+	return &TransientVector{edit, v.cnt, shift, editable(edit, root), tail}
+}
+
+// editable returns node if edit may change it in place, and a copy of it
+// that edit may change otherwise. A nil edit never changes nodes.
+func editable(edit *editToken, node *vecNode) *vecNode {
+	if edit != nil && node.edit == edit {
+		return node
+	}
+	c := *node
+	c.edit = edit
+	return &c
+}
+
+func newPath(edit *editToken, level uint, node *vecNode) *vecNode {
+	for ; level > 0; level -= trieBits {
+		parent := &vecNode{edit: edit}
+		parent.array[0] = node
+		node = parent
+	}
+	return node
+}
+
+// pushTail adds the full tail node to the trie of a vector of cnt items.
+func pushTail(edit *editToken, cnt int, level uint, parent, tail *vecNode) *vecNode {
+	ret := editable(edit, parent)
+	sub := ((cnt - 1) >> level) & trieMask
+	if level == trieBits {
+		ret.array[sub] = tail
+	} else if child, ok := parent.array[sub].(*vecNode); ok {
+		ret.array[sub] = pushTail(edit, cnt, level-trieBits, child, tail)
+	} else {
+		ret.array[sub] = newPath(edit, level-trieBits, tail)
+	}
+	return ret
+}
+
+func assocPath(edit *editToken, level uint, node *vecNode, i int, x ParrotType) *vecNode {
+	ret := editable(edit, node)
+	if level == 0 {
+		ret.array[i&trieMask] = x
+		return ret
+	}
+	sub := (i >> level) & trieMask
+	ret.array[sub] = assocPath(edit, level-trieBits, node.array[sub].(*vecNode), i, x)
+	return ret
+}
+
+// TransientVector is a vector that changes in place, for building a vector
+// in many steps without copying a path of nodes at each of them. It must
+// not be used after Persistent, nor by several goroutines at once.
+type TransientVector struct {
+	edit  *editToken
+	cnt   int
+	shift uint
+	root  *vecNode
+	tail  []ParrotType
+}
+
+var errTransient = errors.New("transient used after persistent!")
+
+func (t *TransientVector) Len() int {
+	return t.cnt
+}
+
+// Conj adds x at the end of t.
+func (t *TransientVector) Conj(x ParrotType) error {
+	if !t.edit.live {
+		return errTransient
+	}
+	v := PersistentVector{t.cnt, t.shift, t.root, t.tail}
+	if t.cnt-v.tailOff() < trieWidth {
+		t.tail = append(t.tail, x)
+		t.cnt++
+		return nil
+	}
+	full := &vecNode{edit: t.edit}
+	copy(full.array[:], t.tail)
+	if (t.cnt >> trieBits) > (1 << t.shift) {
+		grown := &vecNode{edit: t.edit}
+		grown.array[0] = t.root
+		grown.array[1] = newPath(t.edit, t.shift, full)
+		t.root, t.shift = grown, t.shift+trieBits
+	} else {
+		t.root = pushTail(t.edit, t.cnt, t.shift, t.root, full)
+	}
+	t.tail = make([]ParrotType, 1, trieWidth)
+	t.tail[0] = x
+	t.cnt++
+	return nil
+}
+
+// Assoc replaces item i of t by x. i may be the length of t, to add x at
+// the end.
+func (t *TransientVector) Assoc(i int, x ParrotType) error {
+	if !t.edit.live {
+		return errTransient
+	}
+	if i == t.cnt {
+		return t.Conj(x)
+	}
+	if i < 0 || i > t.cnt {
+		return errors.New("index out of range")
+	}
+	v := PersistentVector{t.cnt, t.shift, t.root, t.tail}
+	if i >= v.tailOff() {
+		t.tail[i&trieMask] = x
+	} else {
+		t.root = assocPath(t.edit, t.shift, t.root, i, x)
+	}
+	return nil
+}
+
+// Persistent returns the items of t as a persistent vector, and ends the
+// use of t.
+func (t *TransientVector) Persistent() PersistentVector {
+	t.edit.live = false
+	tail := make([]ParrotType, len(t.tail))
+	copy(tail, t.tail)
+	return PersistentVector{t.cnt, t.shift, t.root, tail}
+}
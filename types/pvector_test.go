@@ -0,0 +1,118 @@
+package types
+
+import (
+	"testing"
+)
+
+// vectorOf returns the vector of the integers below n, built by Conj.
+func vectorOf(n int) PersistentVector {
+	v := PersistentVector{}
+	for i := 0; i < n; i++ {
+		v = v.Conj(Int64{int64(i)})
+	}
+	return v
+}
+
+// checkVector fails t unless v holds the integers below n, with item i
+// replaced by want[i].
+func checkVector(t *testing.T, v PersistentVector, n int, want map[int]int64) {
+	t.Helper()
+	if v.Len() != n {
+		t.Fatalf("got %d items, want %d", v.Len(), n)
+	}
+	slc := v.Slice()
+	for i := 0; i < n; i++ {
+		x := int64(i)
+		if w, ok := want[i]; ok {
+			x = w
+		}
+		got, ok := v.Nth(i)
+		if !ok || got != (Int64{x}) || slc[i] != got {
+			t.Fatalf("item %d: got %v and %v, want %d", i, got, slc[i], x)
+		}
+	}
+	if _, ok := v.Nth(n); ok {
+		t.Errorf("item %d is past the end", n)
+	}
+}
+
+// sizes cross the boundaries of the tail and of each level of the trie.
+var sizes = []int{0, 1, 31, 32, 33, 64, 1056, 1057, 32*32*32 + 32, 32*32*32 + 33, 100000}
+
+func TestVectorConj(t *testing.T) {
+	for _, n := range sizes {
+		checkVector(t, vectorOf(n), n, nil)
+	}
+}
+
+func TestVectorIsPersistent(t *testing.T) {
+	for _, n := range sizes[1:] {
+		v := vectorOf(n)
+		grown := v.Conj(Int64{-1})
+		changed, e := v.Assoc(0, Int64{-2})
+		if e != nil {
+			t.Fatal(e)
+		}
+		last, e := changed.Assoc(n-1, Int64{-3})
+		if e != nil {
+			t.Fatal(e)
+		}
+		checkVector(t, v, n, nil)
+		checkVector(t, grown, n+1, map[int]int64{n: -1})
+		checkVector(t, changed, n, map[int]int64{0: -2})
+		checkVector(t, last, n, map[int]int64{0: -2, n - 1: -3})
+	}
+}
+
+func TestVectorAssoc(t *testing.T) {
+	v := vectorOf(40)
+	if _, e := v.Assoc(41, nil); e == nil {
+		t.Error("assoc past the end succeeded")
+	}
+	if _, e := v.Assoc(-1, nil); e == nil {
+		t.Error("assoc before the start succeeded")
+	}
+	grown, e := v.Assoc(40, Int64{40})
+	if e != nil {
+		t.Fatal(e)
+	}
+	checkVector(t, grown, 41, nil)
+}
+
+func TestTransientVector(t *testing.T) {
+	for _, n := range sizes {
+		v := vectorOf(n)
+		tr := v.Transient()
+		for i := 0; i < 100; i++ {
+			if e := tr.Conj(Int64{int64(n + i)}); e != nil {
+				t.Fatal(e)
+			}
+		}
+		if n > 0 {
+			if e := tr.Assoc(0, Int64{-1}); e != nil {
+				t.Fatal(e)
+			}
+		}
+		if e := tr.Assoc(n+200, nil); e == nil {
+			t.Error("assoc past the end succeeded")
+		}
+		built := tr.Persistent()
+		want := map[int]int64{}
+		if n > 0 {
+			want[0] = -1
+		}
+		checkVector(t, built, n+100, want)
+		// the vector the transient came from is unchanged
+		checkVector(t, v, n, nil)
+		if e := tr.Conj(nil); e != errTransient {
+			t.Errorf("got %v after persistent, want %v", e, errTransient)
+		}
+		if e := tr.Assoc(0, nil); e != errTransient {
+			t.Errorf("got %v after persistent, want %v", e, errTransient)
+		}
+		// nor is the built vector changed by later updates
+		built.Conj(nil)
+		built.Assoc(0, Int64{-5})
+		checkVector(t, built, n+100, want)
+	}
+}
@@ -0,0 +1,28 @@
+package types
+
+import "regexp"
+
+// Regex is a compiled regular expression, written #"pattern". Whole is the
+// same pattern anchored at both ends, for matching whole strings.
+type Regex struct {
+	Val   *regexp.Regexp
+	Whole *regexp.Regexp
+}
+
+// NewRegex compiles pattern, in the syntax of Go's regexp package.
+func NewRegex(pattern string) (Regex, error) {
+	re, e := regexp.Compile(pattern)
+	if e != nil {
+		return Regex{}, e
+	}
+	whole, e := regexp.Compile(`^(?:` + pattern + `)$`)
+	if e != nil {
+		return Regex{}, e
+	}
+	return Regex{re, whole}, nil
+}
+
+func Regex_Q(obj ParrotType) bool {
+	_, ok := obj.(Regex)
+	return ok
+}
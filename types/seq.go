@@ -0,0 +1,329 @@
+package types
+
+import (
+	"fmt"
+	"sync"
+	"unicode/utf8"
+)
+
+// LazySeq is a sequence whose items are computed by calling its fn the
+// first time they are needed. The fn returns any seqable value, and its
+// result is cached, so the fn runs at most once.
+type LazySeq struct {
+	mu   sync.Mutex
+	fn   func() (ParrotType, error)
+	val  ParrotType
+	err  error
+	done bool
+}
+
+func NewLazySeq(fn func() (ParrotType, error)) *LazySeq {
+	return &LazySeq{fn: fn}
+}
+
+func LazySeq_Q(obj ParrotType) bool {
+	_, ok := obj.(*LazySeq)
+	return ok
+}
+
+// Realized reports whether the fn of l has run.
+func (l *LazySeq) Realized() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.done
+}
+
+// Realize runs the fn of l, unless it has run already, and returns its
+// result. A lazy seq returned by the fn is realized in turn, so the result
+// is never a *LazySeq.
+func (l *LazySeq) Realize() (ParrotType, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.done {
+		val, err := l.fn()
+		for err == nil {
+			inner, ok := val.(*LazySeq)
+			if !ok {
+				break
+			}
+			val, err = inner.Realize()
+		}
+		l.val, l.err, l.done, l.fn = val, err, true, nil
+	}
+	return l.val, l.err
+}
+
+// Cons is a sequence of First followed by the items of More, which may be
+// any seqable value. It is used to put items in front of lazy seqs without
+// realizing them.
+type Cons struct {
+	First ParrotType
+	More  ParrotType
+}
+
+// Seqable_Q reports whether obj is a value that Uncons accepts.
+func Seqable_Q(obj ParrotType) bool {
+	switch obj.(type) {
+	case nil, List, Vector, HashMap, Set, string, Channel, *LazySeq, Cons:
+		return true
+	}
+	return false
+}
+
+// Uncons splits the seqable value coll into its first item and the rest of
+// its items. ok is false when coll has no items. Seqable values are nil,
+// lists, vectors, hash-maps, sets, strings (of chars), channels, lazy seqs
+// and conses.
+func Uncons(coll ParrotType) (first, rest ParrotType, ok bool, err error) {
+	switch obj := coll.(type) {
+	case nil:
+		return nil, nil, false, nil
+	case List:
+		if len(obj.Val) == 0 {
+			return nil, nil, false, nil
+		}
+		return obj.Val[0], List{obj.Val[1:], nil}, true, nil
+	case Vector:
+		if obj.Val.Len() == 0 {
+			return nil, nil, false, nil
+		}
+		return Uncons(List{obj.Val.Slice(), nil})
+	case HashMap:
+		return Uncons(mapEntries(obj))
+	case Set:
+		return Uncons(List{obj.Val.Keys(), nil})
+	case string:
+		if obj == "" {
+			return nil, nil, false, nil
+		}
+		r, n := utf8.DecodeRuneInString(obj)
+		more := obj[n:]
+		// the rest of a string is a seq of chars, not a string
+		return Char{r}, NewLazySeq(func() (ParrotType, error) { return Seq(more) }), true, nil
+	case Channel:
+		return Uncons(channelSeq(obj.Val))
+	case *LazySeq:
+		val, e := obj.Realize()
+		if e != nil {
+			return nil, nil, false, e
+		}
+		return Uncons(val)
+	case Cons:
+		return obj.First, obj.More, true, nil
+	default:
+		return nil, nil, false, fmt.Errorf("cannot make a sequence of %s", _obj_type(obj))
+	}
+}
+
+// Seq returns nil when coll has no items, and a sequence of its items
+// otherwise.
+func Seq(coll ParrotType) (ParrotType, error) {
+	switch obj := coll.(type) {
+	case List:
+		if len(obj.Val) == 0 {
+			return nil, nil
+		}
+		return obj, nil
+	case Vector:
+		if obj.Val.Len() == 0 {
+			return nil, nil
+		}
+		return List{obj.Val.Slice(), nil}, nil
+	case HashMap:
+		return Seq(mapEntries(obj))
+	case Set:
+		return Seq(List{obj.Val.Keys(), nil})
+	case string:
+		if obj == "" {
+			return nil, nil
+		}
+		return ToList(obj)
+	case Channel:
+		return Seq(channelSeq(obj.Val))
+	case *LazySeq:
+		val, e := obj.Realize()
+		if e != nil {
+			return nil, e
+		}
+		return Seq(val)
+	case Cons, nil:
+		return obj, nil
+	default:
+		return nil, fmt.Errorf("cannot make a sequence of %s", _obj_type(obj))
+	}
+}
+
+// ToSlice returns the items of the seqable value coll, realizing all of
+// them.
+func ToSlice(coll ParrotType) ([]ParrotType, error) {
+	switch obj := coll.(type) {
+	case List:
+		return obj.Val, nil
+	case Vector:
+		return obj.Val.Slice(), nil
+	case string:
+		slc := make([]ParrotType, 0, len(obj))
+		for _, r := range obj {
+			slc = append(slc, Char{r})
+		}
+		return slc, nil
+	}
+	slc := []ParrotType{}
+	for {
+		first, rest, ok, e := Uncons(coll)
+		if e != nil {
+			return nil, e
+		}
+		if !ok {
+			return slc, nil
+		}
+		slc = append(slc, first)
+		coll = rest
+	}
+}
+
+// ToList is like ToSlice, but returns a list.
+func ToList(coll ParrotType) (ParrotType, error) {
+	slc, e := ToSlice(coll)
+	if e != nil {
+		return nil, e
+	}
+	return List{slc, nil}, nil
+}
+
+// SplitSeq returns up to n items from the front of coll, and the sequence
+// of the items after them. The rest is an empty list once coll runs out.
+func SplitSeq(coll ParrotType, n int) ([]ParrotType, ParrotType, error) {
+	switch obj := coll.(type) {
+	case List, Vector:
+		slc, _ := GetSlice(obj)
+		if n > len(slc) {
+			n = len(slc)
+		}
+		return slc[:n], List{slc[n:], nil}, nil
+	}
+	items := []ParrotType{}
+	for len(items) < n {
+		first, rest, ok, e := Uncons(coll)
+		if e != nil {
+			return nil, nil, e
+		}
+		if !ok {
+			return items, List{}, nil
+		}
+		items = append(items, first)
+		coll = rest
+	}
+	if coll == nil {
+		coll = List{}
+	}
+	return items, coll, nil
+}
+
+// Realize realizes the lazy seqs in obj and in the collections it holds, so
+// that any error they produce is returned before obj is printed.
+func Realize(obj ParrotType) error {
+	switch obj := obj.(type) {
+	case List, Vector, *LazySeq, Cons:
+		slc, e := GetSlice(obj)
+		if e != nil {
+			return e
+		}
+		for _, item := range slc {
+			if e := Realize(item); e != nil {
+				return e
+			}
+		}
+	case HashMap:
+		var err error
+		obj.Val.Range(func(_, v ParrotType) bool {
+			err = Realize(v)
+			return err == nil
+		})
+		return err
+	}
+	return nil
+}
+
+// Ellipsis stands for the items Abbreviate leaves out of a sequence.
+var Ellipsis = Symbol{"..."}
+
+// Abbreviate is like Realize, but realizes at most length items of each
+// lazy sequence in obj, which may be infinite. It returns obj with the lazy
+// sequences that have more items cut to length items followed by Ellipsis.
+// Lists and vectors keep every item, as does a length of 0 or less.
+func Abbreviate(obj ParrotType, length int) (ParrotType, error) {
+	switch obj := obj.(type) {
+	case List, Vector, *LazySeq, Cons:
+		var items []ParrotType
+		more := false
+		_, list := obj.(List)
+		_, vector := obj.(Vector)
+		if length > 0 && !list && !vector {
+			front, rest, e := SplitSeq(obj, length)
+			if e != nil {
+				return nil, e
+			}
+			if _, _, more, e = Uncons(rest); e != nil {
+				return nil, e
+			}
+			items = append([]ParrotType(nil), front...)
+		} else {
+			slc, e := ToSlice(obj)
+			if e != nil {
+				return nil, e
+			}
+			items = append([]ParrotType(nil), slc...)
+		}
+		for i, item := range items {
+			v, e := Abbreviate(item, length)
+			if e != nil {
+				return nil, e
+			}
+			items[i] = v
+		}
+		if more {
+			items = append(items, Ellipsis)
+		}
+		if _, ok := obj.(Vector); ok {
+			return NewVector(items...), nil
+		}
+		return List{items, nil}, nil
+	case HashMap:
+		hm := PersistentMap{}.Transient()
+		var err error
+		obj.Val.Range(func(k, v ParrotType) bool {
+			if v, err = Abbreviate(v, length); err == nil {
+				err = hm.Assoc(k, v)
+			}
+			return err == nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return HashMap{hm.Persistent(), obj.Meta}, nil
+	}
+	return obj, nil
+}
+
+// mapEntries returns the [key value] vectors of m.
+func mapEntries(m HashMap) List {
+	entries := make([]ParrotType, 0, m.Val.Len())
+	m.Val.Range(func(k, v ParrotType) bool {
+		entries = append(entries, NewVector(k, v))
+		return true
+	})
+	return List{entries, nil}
+}
+
+// channelSeq returns a lazy seq of the values received from ch until it is
+// closed.
+func channelSeq(ch chan ParrotType) *LazySeq {
+	return NewLazySeq(func() (ParrotType, error) {
+		val, ok := <-ch
+		if !ok {
+			return nil, nil
+		}
+		return Cons{val, channelSeq(ch)}, nil
+	})
+}
@@ -0,0 +1,50 @@
+package types
+
+import (
+	"testing"
+)
+
+// naturals returns the infinite lazy seq of the integers from n, counting
+// how many of them have been computed in *realized.
+func naturals(n int64, realized *int) *LazySeq {
+	return NewLazySeq(func() (ParrotType, error) {
+		*realized++
+		return Cons{Int64{n}, naturals(n+1, realized)}, nil
+	})
+}
+
+func TestAbbreviate(t *testing.T) {
+	realized := 0
+	got, e := Abbreviate(NewVector(naturals(0, &realized), "x"), 3)
+	if e != nil {
+		t.Fatal(e)
+	}
+	want := NewVector(List{[]ParrotType{Int64{0}, Int64{1}, Int64{2}, Ellipsis}, nil}, "x")
+	if !Equal_Q(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if realized != 4 {
+		t.Errorf("realized %d items, want 4", realized)
+	}
+	got, _ = Abbreviate(List{[]ParrotType{Int64{1}, Int64{2}}, nil}, 0)
+	if !Equal_Q(got, List{[]ParrotType{Int64{1}, Int64{2}}, nil}) {
+		t.Errorf("a length of 0 abbreviated %v", got)
+	}
+}
+
+func TestUnconsString(t *testing.T) {
+	first, rest, ok, e := Uncons("héllo")
+	if e != nil || !ok || first != (Char{'h'}) {
+		t.Fatalf("Uncons = %v, %v, %v", first, ok, e)
+	}
+	if _, isString := rest.(string); isString {
+		t.Errorf("the rest of a string is a string")
+	}
+	slc, e := ToSlice(rest)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(slc) != 4 || slc[0] != (Char{'é'}) {
+		t.Errorf("rest = %v", slc)
+	}
+}
@@ -3,6 +3,7 @@ package types
 import (
 	"errors"
 	"fmt"
+	"io"
 	"reflect"
 	"strings"
 )
@@ -34,6 +35,12 @@ type String struct {
 	Val string
 }
 
+// Char is a single character, written \a, \newline or \u00e9. The items
+// of a string, as a sequence, are chars.
+type Char struct {
+	Val rune
+}
+
 type Symbol struct {
 	Val string
 }
@@ -43,15 +50,104 @@ type List struct {
 	Meta ParrotType
 }
 
+// Position is a location in Parrot source code. The reader stores the
+// position of every list, vector and hash-map it produces in their Meta field,
+// where meta does not show it.
+type Position struct {
+	File   string
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// GetPosition returns the source position recorded for obj by the reader.
+func GetPosition(obj ParrotType) (Position, bool) {
+	var meta ParrotType
+	switch tobj := obj.(type) {
+	case List:
+		meta = tobj.Meta
+	case Vector:
+		meta = tobj.Meta
+	case HashMap:
+		meta = tobj.Meta
+	case Set:
+		meta = tobj.Meta
+	}
+	pos, ok := meta.(Position)
+	return pos, ok
+}
+
 func (p ParrotError) Error() string {
 	return fmt.Sprintf("%#v", p.Obj)
 }
 
+// Frame is one entry of the Parrot call stack: the function being run and
+// the position it was called from. A tail call replaces the frame of its
+// caller and bumps Tail instead of growing the stack.
+type Frame struct {
+	Name   string
+	Pos    Position
+	Tail   int
+	Caller *Frame
+}
+
+// EvalError is an error raised while evaluating Parrot code, together with
+// the position being evaluated and the call stack at that point.
+type EvalError struct {
+	Err   error
+	Pos   Position
+	Trace []Frame
+}
+
+func (e *EvalError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *EvalError) Unwrap() error {
+	return e.Err
+}
+
+// StackTrace formats the call stack, innermost frame first.
+func (e *EvalError) StackTrace() string {
+	lines := []string{}
+	if e.Pos.Line > 0 {
+		lines = append(lines, "    at "+e.Pos.String())
+	}
+	for _, f := range e.Trace {
+		name := f.Name
+		if name == "" {
+			name = "fn"
+		}
+		line := "    in " + name
+		if f.Pos.Line > 0 {
+			line += ", called at " + f.Pos.String()
+		} else {
+			line += ", called from Go"
+		}
+		if f.Tail > 0 {
+			line += fmt.Sprintf(" (after %d tail calls)", f.Tail)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
 type EnvType interface {
 	Find(key Symbol) EnvType
 	Set(key Symbol, value ParrotType) ParrotType
 	Get(key Symbol) (ParrotType, error)
 	All() (ParrotType, error)
+	Frame() *Frame
+	WithFrame(frame *Frame) EnvType
+	GetStackTrace() []Frame
+	Budget() *Budget
+	WithBudget(budget *Budget) EnvType
 }
 
 func Nil_Q(obj ParrotType) bool {
@@ -69,8 +165,11 @@ func False_Q(obj ParrotType) bool {
 }
 
 func Number_Q(obj ParrotType) bool {
-	_, ok := obj.(int)
-	return ok
+	switch obj.(type) {
+	case int, Int64, Float64, BigInt, Ratio:
+		return true
+	}
+	return false
 }
 
 func Symbol_Q(obj ParrotType) bool {
@@ -94,11 +193,52 @@ func String_Q(obj ParrotType) bool {
 	return ok
 }
 
+func Char_Q(obj ParrotType) bool {
+	_, ok := obj.(Char)
+	return ok
+}
+
+// CharNames are the names of the chars written by name, as in \newline.
+var CharNames = map[rune]string{
+	'\n': "newline",
+	' ':  "space",
+	'\t': "tab",
+	'\r': "return",
+	'\b': "backspace",
+	'\f': "formfeed",
+}
+
 // Functions
 type Func struct {
 	Fn          func([]ParrotType) (ParrotType, error)
 	Meta        ParrotType
 	IsGoroutine bool
+	Budgeted    func([]ParrotType, *Budget) (ParrotType, error) // Fn for a known budget, or nil
+}
+
+// BudgetFunc returns a Func that runs fn under the budget of the code
+// calling it, or under budget when that is not known, as when a Go
+// function calls it. Builtins that block or evaluate are made this way.
+func BudgetFunc(fn func([]ParrotType, *Budget) (ParrotType, error), budget *Budget) Func {
+	return Func{func(a []ParrotType) (ParrotType, error) { return fn(a, budget) }, nil, false, fn}
+}
+
+// Call calls f for code running under budget. The fns in args are called
+// back under budget too, rather than under the budget of the evaluation
+// that made them.
+func (f Func) Call(args []ParrotType, budget *Budget) (ParrotType, error) {
+	if budget == nil {
+		return f.Fn(args)
+	}
+	for i, a := range args {
+		if fn, ok := a.(ParrotFunc); ok {
+			args[i] = fn.WithBudget(budget)
+		}
+	}
+	if f.Budgeted != nil {
+		return f.Budgeted(args, budget)
+	}
+	return f.Fn(args)
 }
 
 func Func_Q(obj ParrotType) bool {
@@ -115,6 +255,41 @@ type ParrotFunc struct {
 	GenEnv      func(EnvType, ParrotType, ParrotType) (EnvType, error)
 	Meta        ParrotType
 	IsGoroutine bool
+	Name        string
+	Arities     []Arity // every arity of a multi-arity fn, else nil
+	Compiled    Compiled
+}
+
+// WithBudget returns f running under budget when it is applied.
+func (f ParrotFunc) WithBudget(budget *Budget) ParrotFunc {
+	if f.Env != nil && f.Env.Budget() != budget {
+		f.Env = f.Env.WithBudget(budget)
+	}
+	return f
+}
+
+// Compiled is the compiled code of a ParrotFunc. Call runs it for args as
+// the call described by frame, counting its work against budget.
+type Compiled interface {
+	Call(args []ParrotType, frame *Frame, budget *Budget) (ParrotType, error)
+}
+
+// Arity is one parameter list of a fn and the body run for it.
+type Arity struct {
+	Params ParrotType
+	Exp    ParrotType
+}
+
+// ParamCount returns how many arguments params requires and whether it
+// takes more after them with &.
+func ParamCount(params ParrotType) (int, bool) {
+	slc, _ := GetSlice(params)
+	for i, p := range slc {
+		if sym, ok := p.(Symbol); ok && sym.Val == "&" {
+			return i, true
+		}
+	}
+	return len(slc), false
 }
 
 type Goroutine struct {
@@ -136,20 +311,72 @@ func (f ParrotFunc) GetMacro() bool {
 	return f.IsMacro
 }
 
+// SelectArity returns the params and body f runs when called with n
+// arguments. A fixed arity is preferred over a variadic one.
+func (f ParrotFunc) SelectArity(n int) (ParrotType, ParrotType, error) {
+	arities := f.Arities
+	if arities == nil {
+		arities = []Arity{{f.Params, f.Exp}}
+	}
+	var variadic *Arity
+	expected := []string{}
+	for i := range arities {
+		required, more := ParamCount(arities[i].Params)
+		if more {
+			if n >= required && variadic == nil {
+				variadic = &arities[i]
+			}
+			expected = append(expected, fmt.Sprintf("at least %d", required))
+			continue
+		}
+		if n == required {
+			return arities[i].Params, arities[i].Exp, nil
+		}
+		expected = append(expected, fmt.Sprint(required))
+	}
+	if variadic != nil {
+		return variadic.Params, variadic.Exp, nil
+	}
+	name := f.Name
+	if name == "" {
+		name = "fn"
+	}
+	return nil, nil, fmt.Errorf("wrong number of args (%d) passed to %s, expected %s",
+		n, name, strings.Join(expected, " or "))
+}
+
 // Take either a MalFunc or regular function and apply it to the
 // arguments
 func Apply(f_mt ParrotType, a []ParrotType, isGoroutine bool) (ParrotType, error) {
 	switch f := f_mt.(type) {
 	case ParrotFunc:
-		env, e := f.GenEnv(f.Env, f.Params, List{a, nil})
+		if f.Compiled != nil {
+			var budget *Budget
+			if f.Env != nil {
+				budget = f.Env.Budget()
+			}
+			frame := &Frame{Name: f.Name}
+			if isGoroutine {
+				go f.Compiled.Call(a, frame, budget.Fork())
+				return nil, nil
+			}
+			return f.Compiled.Call(a, frame, budget)
+		}
+		params, exp, e := f.SelectArity(len(a))
+		if e != nil {
+			return nil, e
+		}
+		env, e := f.GenEnv(f.Env, params, List{a, nil})
 		if e != nil {
 			return nil, e
 		}
+		env = env.WithFrame(&Frame{Name: f.Name})
 		if isGoroutine {
-			go f.Eval(f.Exp, env)
+			env = env.WithBudget(env.Budget().Fork())
+			go f.Eval(exp, env)
 			return nil, nil
 		}
-		return f.Eval(f.Exp, env)
+		return f.Eval(exp, env)
 	case Func:
 		if isGoroutine {
 			go f.Fn(a)
@@ -158,6 +385,8 @@ func Apply(f_mt ParrotType, a []ParrotType, isGoroutine bool) (ParrotType, error
 		return f.Fn(a)
 	case func([]ParrotType) (ParrotType, error):
 		return f(a)
+	case Set:
+		return f.Call(a)
 	default:
 		return nil, errors.New("Invalid function to Apply")
 	}
@@ -173,7 +402,7 @@ func List_Q(obj ParrotType) bool {
 }
 
 type Vector struct {
-	Val  []ParrotType
+	Val  PersistentVector
 	Meta ParrotType
 }
 
@@ -187,14 +416,16 @@ func GetSlice(seq ParrotType) ([]ParrotType, error) {
 	case List:
 		return obj.Val, nil
 	case Vector:
-		return obj.Val, nil
+		return obj.Val.Slice(), nil
+	case *LazySeq, Cons:
+		return ToSlice(obj)
 	default:
 		return nil, errors.New("GetSlice called on non-sequence")
 	}
 }
 
 type HashMap struct {
-	Val  map[string]ParrotType
+	Val  PersistentMap
 	Meta ParrotType
 }
 
@@ -207,15 +438,7 @@ func NewHashMap(seq ParrotType) (ParrotType, error) {
 	if len(lst)%2 == 1 {
 		return nil, errors.New("Odd number of arguments to NewHashMap")
 	}
-	m := map[string]ParrotType{}
-	for i := 0; i < len(lst); i += 2 {
-		str, ok := lst[i].(string)
-		if !ok {
-			return nil, errors.New("expected hash-map key string")
-		}
-		m[str] = lst[i+1]
-	}
-	return HashMap{m, nil}, nil
+	return HashMap{NewMap(lst...), nil}, nil
 }
 
 func HashMap_Q(obj ParrotType) bool {
@@ -223,6 +446,85 @@ func HashMap_Q(obj ParrotType) bool {
 	return ok
 }
 
+// Set is a persistent set, kept as a map from each of its items to itself.
+type Set struct {
+	Val  PersistentMap
+	Meta ParrotType
+}
+
+// NewSet returns a set of items.
+func NewSet(items ...ParrotType) Set {
+	t := PersistentMap{}.Transient()
+	for _, x := range items {
+		t.Assoc(x, x)
+	}
+	return Set{t.Persistent(), nil}
+}
+
+func Set_Q(obj ParrotType) bool {
+	_, ok := obj.(Set)
+	return ok
+}
+
+// Conj returns s with x added.
+func (s Set) Conj(x ParrotType) Set {
+	return Set{s.Val.Assoc(x, x), s.Meta}
+}
+
+// Disj returns s without x.
+func (s Set) Disj(x ParrotType) Set {
+	return Set{s.Val.Dissoc(x), s.Meta}
+}
+
+// Has reports whether s holds x.
+func (s Set) Has(x ParrotType) bool {
+	_, ok := s.Val.Get(x)
+	return ok
+}
+
+// Call makes a set a membership predicate: it returns its one argument as
+// held by s, or nil if s does not hold it.
+func (s Set) Call(a []ParrotType) (ParrotType, error) {
+	if len(a) != 1 {
+		return nil, fmt.Errorf("a set takes 1 argument, got %d", len(a))
+	}
+	x, _ := s.Val.Get(a[0])
+	return x, nil
+}
+
+// GoObject wraps a Go value that has no Parrot counterpart, such as a struct
+// or a pointer, so that its methods and fields can be used from Parrot.
+type GoObject struct {
+	Val interface{}
+}
+
+func GoObject_Q(obj ParrotType) bool {
+	_, ok := obj.(GoObject)
+	return ok
+}
+
+// Writer is a stream Parrot code can write to, such as *out* and *err*. It
+// hides the Go value it writes to, so that interop cannot reach its other
+// methods.
+type Writer struct {
+	name string
+	w    io.Writer
+}
+
+func NewWriter(name string, w io.Writer) *Writer {
+	return &Writer{name, w}
+}
+
+// WriterName returns the name w prints as. It is not a method, which interop
+// would let Parrot code call.
+func WriterName(w *Writer) string {
+	return w.name
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	return w.w.Write(p)
+}
+
 type Atom struct {
 	Val  ParrotType
 	Meta ParrotType
@@ -242,17 +544,23 @@ func _obj_type(obj ParrotType) string {
 	if obj == nil {
 		return "nil"
 	}
-	return reflect.TypeOf(obj).Name()
+	if name := reflect.TypeOf(obj).Name(); name != "" {
+		return name
+	}
+	return reflect.TypeOf(obj).String()
 }
 
 func Sequential_Q(seq ParrotType) bool {
-	if seq == nil {
-		return false
+	switch seq.(type) {
+	case List, Vector, *LazySeq, Cons:
+		return true
 	}
-	return (reflect.TypeOf(seq).Name() == "List") ||
-		(reflect.TypeOf(seq).Name() == "Vector")
+	return false
 }
 func Equal_Q(a ParrotType, b ParrotType) bool {
+	if Number_Q(a) {
+		return Number_Q(b) && numberEqual(a, b)
+	}
 	ota := reflect.TypeOf(a)
 	otb := reflect.TypeOf(b)
 
@@ -263,7 +571,7 @@ func Equal_Q(a ParrotType, b ParrotType) bool {
 	switch a.(type) {
 	case Symbol:
 		return a.(Symbol).Val == b.(Symbol).Val
-	case List:
+	case List, *LazySeq, Cons:
 		as, _ := GetSlice(a)
 		bs, _ := GetSlice(b)
 		if len(as) != len(bs) {
@@ -289,17 +597,33 @@ func Equal_Q(a ParrotType, b ParrotType) bool {
 		return true
 	case HashMap:
 		am := a.(HashMap).Val
-		bm := a.(HashMap).Val
-		if len(am) != len(bm) {
+		bm := b.(HashMap).Val
+		if am.Len() != bm.Len() {
 			return false
 		}
-		for k, v := range am {
-			if !Equal_Q(v, bm[k]) {
-				return false
-			}
+		equal := true
+		am.Range(func(k, v ParrotType) bool {
+			w, ok := bm.Get(k)
+			equal = ok && Equal_Q(v, w)
+			return equal
+		})
+		return equal
+	case Set:
+		as := a.(Set)
+		bs := b.(Set)
+		if as.Val.Len() != bs.Val.Len() {
+			return false
 		}
-		return true
+		equal := true
+		as.Val.Range(func(k, _ ParrotType) bool {
+			equal = bs.Has(k)
+			return equal
+		})
+		return equal
 	default:
+		if ota != nil && !ota.Comparable() {
+			return false
+		}
 		return a == b
 	}
 }
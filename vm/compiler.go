@@ -0,0 +1,895 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sllt/parrot/printer"
+	"github.com/sllt/parrot/types"
+)
+
+// lambdaScope tracks the values a Lambda captures from the frames it is
+// created in.
+type lambdaScope struct {
+	outer   *scope
+	free    []FreeRef
+	freeIdx map[string]int
+	self    string
+}
+
+// arityScope counts the locals of one Proto.
+type arityScope struct {
+	lambda  *lambdaScope
+	nlocals int
+}
+
+// scope maps the names bound by one fn parameter list, let or catch to
+// their locals.
+type scope struct {
+	names map[string]int
+	outer *scope
+	arity *arityScope
+}
+
+func (sc *scope) nest() *scope {
+	return &scope{map[string]int{}, sc, sc.arity}
+}
+
+func (sc *scope) bind(name string) int {
+	slot := sc.arity.nlocals
+	sc.arity.nlocals++
+	sc.names[name] = slot
+	return slot
+}
+
+// resolve finds the local, captured value or self reference a name refers
+// to, capturing it from enclosing fns as needed. It reports false for
+// globals.
+func (sc *scope) resolve(name string) (FreeRef, bool) {
+	for s := sc; s != nil; s = s.outer {
+		if slot, ok := s.names[name]; ok {
+			return FreeRef{RefLocal, slot}, true
+		}
+	}
+	ls := sc.arity.lambda
+	if ls.self != "" && ls.self == name {
+		return FreeRef{Kind: RefSelf}, true
+	}
+	if i, ok := ls.freeIdx[name]; ok {
+		return FreeRef{RefFree, i}, true
+	}
+	if ls.outer == nil {
+		return FreeRef{}, false
+	}
+	r, ok := ls.outer.resolve(name)
+	if !ok {
+		return FreeRef{}, false
+	}
+	ls.free = append(ls.free, r)
+	ls.freeIdx[name] = len(ls.free) - 1
+	return FreeRef{RefFree, len(ls.free) - 1}, true
+}
+
+// recurTarget is the loop or fn a recur jumps to the start of.
+type recurTarget struct {
+	start  int
+	stores []store
+}
+
+// where is the context a form is compiled in.
+type where struct {
+	tail  bool
+	recur *recurTarget
+	pos   types.Position
+}
+
+func (w where) operand() where {
+	return where{false, nil, w.pos}
+}
+
+// emitter collects the code and constants of the Proto being compiled.
+type emitter struct {
+	proto  *Proto
+	consts map[interface{}]int
+}
+
+type compiler struct {
+	env  types.EnvType
+	host *Host
+	em   *emitter
+}
+
+func compileError(pos types.Position, e error) error {
+	var te *types.EvalError
+	if errors.As(e, &te) {
+		if te.Pos.Line == 0 {
+			te.Pos = pos
+		}
+		return e
+	}
+	return &types.EvalError{e, pos, nil}
+}
+
+// Compile compiles form, after expanding the macros defined in env, as the
+// body of a fn without parameters. Run runs the result.
+func Compile(form types.ParrotType, env types.EnvType, host *Host) (*Lambda, error) {
+	c := &compiler{env: env, host: host}
+	ls := &lambdaScope{freeIdx: map[string]int{}}
+	as := &arityScope{lambda: ls}
+	sc := &scope{map[string]int{}, nil, as}
+	p := &Proto{}
+	c.em = &emitter{p, map[interface{}]int{}}
+	w := where{tail: true}
+	if pos, ok := types.GetPosition(form); ok {
+		w.pos = pos
+	}
+	if e := c.compile(form, sc, w); e != nil {
+		return nil, e
+	}
+	c.emit(w.pos, OpReturn)
+	p.NumLocals = as.nlocals
+	return &Lambda{Arities: []*Proto{p}}, nil
+}
+
+// CompileFn compiles a fn from its name and the parameters and body of each
+// of its arities, as they are kept by a ParrotFunc.
+func CompileFn(name string, arities []types.Arity, env types.EnvType, host *Host) (*Lambda, error) {
+	c := &compiler{env: env, host: host}
+	clauses := [][]types.ParrotType{}
+	for _, ar := range arities {
+		clauses = append(clauses, []types.ParrotType{ar.Params, ar.Exp})
+	}
+	return c.lambda(name, clauses, nil, where{})
+}
+
+func (c *compiler) emit(pos types.Position, op Op, operands ...int) int {
+	p := c.em.proto
+	at := len(p.Code)
+	if n := len(p.Lines); pos.Line != 0 && (n == 0 || p.Lines[n-1].Pos != pos) {
+		p.Lines = append(p.Lines, Line{at, pos})
+	}
+	p.Code = append(p.Code, byte(op))
+	for _, o := range operands {
+		p.Code = append(p.Code, byte(o>>8), byte(o))
+	}
+	return at
+}
+
+// patch points the jump at at to the end of the code.
+func (c *compiler) patch(at int) error {
+	target := len(c.em.proto.Code)
+	if target > 0xffff {
+		return errors.New("fn too large to compile")
+	}
+	c.em.proto.Code[at+1], c.em.proto.Code[at+2] = byte(target>>8), byte(target)
+	return nil
+}
+
+// constant returns the index of val among the constants, adding it if
+// needed.
+func (c *compiler) constant(val types.ParrotType, pos types.Position) (int, error) {
+	var key interface{}
+	switch v := val.(type) {
+	case string, types.Symbol, types.Int64, types.Char, float64, int:
+		key = v
+	}
+	if key != nil {
+		if i, ok := c.em.consts[key]; ok {
+			return i, nil
+		}
+	}
+	p := c.em.proto
+	if len(p.Consts) >= noName {
+		return 0, compileError(pos, errors.New("too many constants in one fn"))
+	}
+	p.Consts = append(p.Consts, val)
+	if key != nil {
+		c.em.consts[key] = len(p.Consts) - 1
+	}
+	return len(p.Consts) - 1, nil
+}
+
+func (c *compiler) emitConst(pos types.Position, op Op, val types.ParrotType) error {
+	i, e := c.constant(val, pos)
+	if e != nil {
+		return e
+	}
+	c.emit(pos, op, i)
+	return nil
+}
+
+func (c *compiler) compile(form types.ParrotType, sc *scope, w where) error {
+	switch f := form.(type) {
+	case nil:
+		c.emit(w.pos, OpNil)
+		return nil
+	case bool:
+		if f {
+			c.emit(w.pos, OpTrue)
+		} else {
+			c.emit(w.pos, OpFalse)
+		}
+		return nil
+	case types.Symbol:
+		return c.compileSymbol(f, sc, w)
+	case types.List:
+		return c.compileList(f, sc, w)
+	case *types.LazySeq, types.Cons:
+		// Macros may build their expansions with the seq functions.
+		lst, e := types.ToList(f)
+		if e != nil {
+			return compileError(w.pos, e)
+		}
+		return c.compile(lst, sc, w)
+	case types.Vector:
+		if e := c.compileAll(f.Val.Slice(), sc, w.operand()); e != nil {
+			return e
+		}
+		c.emit(w.pos, OpVector, f.Val.Len())
+		return nil
+	case types.HashMap:
+		var err error
+		f.Val.Range(func(k, v types.ParrotType) bool {
+			if err = c.compile(k, sc, w.operand()); err != nil {
+				return false
+			}
+			err = c.compile(v, sc, w.operand())
+			return err == nil
+		})
+		if err != nil {
+			return err
+		}
+		c.emit(w.pos, OpHashMap, 2*f.Val.Len())
+		return nil
+	case types.Set:
+		if e := c.compileAll(f.Val.Keys(), sc, w.operand()); e != nil {
+			return e
+		}
+		c.emit(w.pos, OpSet, f.Val.Len())
+		return nil
+	}
+	return c.emitConst(w.pos, OpConst, form)
+}
+
+func (c *compiler) compileAll(forms []types.ParrotType, sc *scope, w where) error {
+	for _, f := range forms {
+		if e := c.compile(f, sc, w); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+func (c *compiler) compileSymbol(sym types.Symbol, sc *scope, w where) error {
+	r, ok := sc.resolve(sym.Val)
+	if !ok {
+		return c.emitConst(w.pos, OpGetGlobal, sym)
+	}
+	switch r.Kind {
+	case RefLocal:
+		c.emit(w.pos, OpGetLocal, r.Index)
+	case RefFree:
+		c.emit(w.pos, OpGetFree, r.Index)
+	default:
+		c.emit(w.pos, OpGetSelf)
+	}
+	return nil
+}
+
+// macro returns the macro the head of a call names, if any.
+func (c *compiler) macro(head types.ParrotType, sc *scope) (types.ParrotFunc, bool) {
+	sym, ok := head.(types.Symbol)
+	if !ok {
+		return types.ParrotFunc{}, false
+	}
+	if _, local := sc.resolve(sym.Val); local {
+		return types.ParrotFunc{}, false
+	}
+	v, e := c.env.Get(sym)
+	if e != nil {
+		return types.ParrotFunc{}, false
+	}
+	fn, ok := v.(types.ParrotFunc)
+	return fn, ok && fn.IsMacro
+}
+
+func (c *compiler) compileList(lst types.List, sc *scope, w where) error {
+	if p, ok := types.GetPosition(lst); ok {
+		w.pos = p
+	}
+	if len(lst.Val) == 0 {
+		return c.emitConst(w.pos, OpConst, lst)
+	}
+	head := ""
+	if types.Symbol_Q(lst.Val[0]) {
+		head = lst.Val[0].(types.Symbol).Val
+	}
+	args := lst.Val[1:]
+	switch head {
+	case "def", "defmacro":
+		op, what := OpDef, "a value"
+		if head == "defmacro" {
+			op, what = OpDefMacro, "a fn"
+		}
+		if len(args) != 2 || !types.Symbol_Q(args[0]) {
+			return compileError(w.pos, fmt.Errorf("%s requires a symbol and %s", head, what))
+		}
+		if e := c.compile(args[1], sc, w.operand()); e != nil {
+			return e
+		}
+		return c.emitConst(w.pos, op, args[0])
+	case "let":
+		return c.compileLet(args, sc, w, false)
+	case "loop":
+		return c.compileLet(args, sc, w, true)
+	case "recur":
+		return c.compileRecur(args, sc, w)
+	case "fn":
+		return c.compileFn(args, sc, w)
+	case "if":
+		return c.compileIf(args, sc, w)
+	case "do":
+		return c.compileBody(args, sc, w)
+	case "try":
+		return c.compileTry(args, sc, w)
+	case "quote":
+		var val types.ParrotType
+		if len(args) > 0 {
+			val = args[0]
+		}
+		return c.emitConst(w.pos, OpConst, val)
+	case "quasiquote":
+		var val types.ParrotType
+		if len(args) > 0 {
+			val = args[0]
+		}
+		return c.compile(c.host.Quasiquote(val), sc, w)
+	case "macroexpand", "ns":
+		return c.emitConst(w.pos, OpEval, lst)
+	case ".", ".-":
+		return c.compileInterop(head, args, sc, w)
+	}
+	if mac, ok := c.macro(lst.Val[0], sc); ok {
+		expanded, e := types.Apply(mac, args, false)
+		if e != nil {
+			return compileError(w.pos, extendTrace(e, head, nil, w.pos))
+		}
+		return c.compile(expanded, sc, w)
+	}
+	return c.compileCall(lst, sc, w)
+}
+
+func (c *compiler) compileCall(lst types.List, sc *scope, w where) error {
+	if e := c.compileAll(lst.Val, sc, w.operand()); e != nil {
+		return e
+	}
+	name := noName
+	if sym, ok := lst.Val[0].(types.Symbol); ok {
+		var e error
+		if name, e = c.constant(sym.Val, w.pos); e != nil {
+			return e
+		}
+	}
+	op := OpCall
+	if w.tail {
+		op = OpTailCall
+	}
+	c.emit(w.pos, op, len(lst.Val)-1, name)
+	return nil
+}
+
+// compileBody compiles forms evaluated in order for the value of the last.
+func (c *compiler) compileBody(forms []types.ParrotType, sc *scope, w where) error {
+	if len(forms) == 0 {
+		c.emit(w.pos, OpNil)
+		return nil
+	}
+	for _, f := range forms[:len(forms)-1] {
+		if e := c.compile(f, sc, w.operand()); e != nil {
+			return e
+		}
+		c.emit(w.pos, OpPop)
+	}
+	return c.compile(forms[len(forms)-1], sc, w)
+}
+
+func (c *compiler) compileIf(args []types.ParrotType, sc *scope, w where) error {
+	if len(args) < 1 {
+		return compileError(w.pos, errors.New("if requires a condition"))
+	}
+	if e := c.compile(args[0], sc, w.operand()); e != nil {
+		return e
+	}
+	jumpElse := c.emit(w.pos, OpJumpIfFalse, 0)
+	// a missing then or else form is nil
+	var then types.ParrotType
+	if len(args) > 1 {
+		then = args[1]
+	}
+	if e := c.compile(then, sc, w); e != nil {
+		return e
+	}
+	jumpEnd := c.emit(w.pos, OpJump, 0)
+	if e := c.patch(jumpElse); e != nil {
+		return compileError(w.pos, e)
+	}
+	var alt types.ParrotType
+	if len(args) > 2 {
+		alt = args[2]
+	}
+	if e := c.compile(alt, sc, w); e != nil {
+		return e
+	}
+	if e := c.patch(jumpEnd); e != nil {
+		return compileError(w.pos, e)
+	}
+	return nil
+}
+
+func (c *compiler) compileLet(args []types.ParrotType, sc *scope, w where, isLoop bool) error {
+	form := "let"
+	if isLoop {
+		form = "loop"
+	}
+	if len(args) == 0 {
+		return compileError(w.pos, fmt.Errorf("%s requires a binding vector", form))
+	}
+	binds, e := types.GetSlice(args[0])
+	if e != nil || len(binds)%2 != 0 {
+		return compileError(w.pos, fmt.Errorf("%s requires an even number of forms in its binding vector", form))
+	}
+	inner := sc.nest()
+	stores := []store{}
+	for i := 0; i < len(binds); i += 2 {
+		if e := c.compile(binds[i+1], inner, w.operand()); e != nil {
+			return e
+		}
+		st, e := c.pattern(binds[i], inner, w)
+		if e != nil {
+			return e
+		}
+		if e := st(); e != nil {
+			return e
+		}
+		stores = append(stores, st)
+	}
+	if isLoop {
+		w.recur = &recurTarget{len(c.em.proto.Code), stores}
+	}
+	return c.compileBody(args[1:], inner, w)
+}
+
+func (c *compiler) compileRecur(args []types.ParrotType, sc *scope, w where) error {
+	target := w.recur
+	if target == nil {
+		return compileError(w.pos, errors.New("can only recur from tail position"))
+	}
+	if len(args) != len(target.stores) {
+		return compileError(w.pos, fmt.Errorf("recur expects %d args, got %d", len(target.stores), len(args)))
+	}
+	if e := c.compileAll(args, sc, w.operand()); e != nil {
+		return e
+	}
+	for i := len(target.stores) - 1; i >= 0; i-- {
+		if e := target.stores[i](); e != nil {
+			return e
+		}
+	}
+	c.emit(w.pos, OpLoop, target.start)
+	return nil
+}
+
+func (c *compiler) compileTry(args []types.ParrotType, sc *scope, w where) error {
+	if len(args) == 0 {
+		return compileError(w.pos, errors.New("try requires a body"))
+	}
+	var clause []types.ParrotType
+	if len(args) > 1 {
+		var e error
+		clause, e = types.GetSlice(args[1])
+		if e != nil || !types.List_Q(args[1]) || len(clause) < 2 ||
+			!types.Symbol_Q(clause[0]) || clause[0].(types.Symbol).Val != "catch" || !types.Symbol_Q(clause[1]) {
+			return compileError(w.pos, errors.New("try expects (catch name body*)"))
+		}
+	}
+	if clause == nil {
+		return c.compile(args[0], sc, w.operand())
+	}
+	try := c.emit(w.pos, OpTry, 0)
+	if e := c.compile(args[0], sc, w.operand()); e != nil {
+		return e
+	}
+	c.emit(w.pos, OpEndTry)
+	jumpEnd := c.emit(w.pos, OpJump, 0)
+	if e := c.patch(try); e != nil {
+		return compileError(w.pos, e)
+	}
+	inner := sc.nest()
+	c.emit(w.pos, OpSetLocal, inner.bind(clause[1].(types.Symbol).Val))
+	hw := w
+	hw.recur = nil
+	if e := c.compileBody(clause[2:], inner, hw); e != nil {
+		return e
+	}
+	if e := c.patch(jumpEnd); e != nil {
+		return compileError(w.pos, e)
+	}
+	return nil
+}
+
+func (c *compiler) compileInterop(head string, args []types.ParrotType, sc *scope, w where) error {
+	if len(args) < 2 || !types.Symbol_Q(args[1]) {
+		return compileError(w.pos, errors.New(head+" requires an object and a member name"))
+	}
+	member, e := c.constant(args[1].(types.Symbol).Val, w.pos)
+	if e != nil {
+		return e
+	}
+	if e := c.compileAll(append([]types.ParrotType{args[0]}, args[2:]...), sc, w.operand()); e != nil {
+		return e
+	}
+	if head == ".-" {
+		c.emit(w.pos, OpField, member)
+	} else {
+		c.emit(w.pos, OpCallMethod, member, len(args)-2)
+	}
+	return nil
+}
+
+func isArityClause(form types.ParrotType) bool {
+	lst, ok := form.(types.List)
+	return ok && len(lst.Val) > 0 && (types.Vector_Q(lst.Val[0]) || types.List_Q(lst.Val[0]))
+}
+
+func fnBody(forms []types.ParrotType) types.ParrotType {
+	switch len(forms) {
+	case 0:
+		return nil
+	case 1:
+		return forms[0]
+	}
+	return types.List{append([]types.ParrotType{types.Symbol{"do"}}, forms...), nil}
+}
+
+// compileFn compiles (fn name? [params] body*) and the multi-arity
+// (fn name? ([params] body*)+) to a Lambda and the OpClosure that makes it.
+func (c *compiler) compileFn(args []types.ParrotType, sc *scope, w where) error {
+	name := ""
+	if len(args) > 0 && types.Symbol_Q(args[0]) {
+		name = args[0].(types.Symbol).Val
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return compileError(w.pos, errors.New("fn requires a parameter vector"))
+	}
+	clauses := [][]types.ParrotType{{args[0], fnBody(args[1:])}}
+	if isArityClause(args[0]) {
+		clauses = nil
+		for _, cl := range args {
+			if !isArityClause(cl) {
+				return compileError(w.pos, fmt.Errorf("expected an arity like ([params] body), got %s", printer.PrintStr(cl, true)))
+			}
+			lst := cl.(types.List).Val
+			clauses = append(clauses, []types.ParrotType{lst[0], fnBody(lst[1:])})
+		}
+	}
+	l, e := c.lambda(name, clauses, sc, w)
+	if e != nil {
+		return e
+	}
+	return c.emitConst(w.pos, OpClosure, l)
+}
+
+// lambda compiles the arities of a fn, each given as its parameters and
+// body, into a Proto of its own.
+func (c *compiler) lambda(name string, clauses [][]types.ParrotType, sc *scope, w where) (*Lambda, error) {
+	ls := &lambdaScope{sc, nil, map[string]int{}, name}
+	l := &Lambda{Name: name}
+	fixed := map[int]bool{}
+	variadic := false
+	outer := c.em
+	defer func() { c.em = outer }()
+	for _, cl := range clauses {
+		params, e := types.GetSlice(cl[0])
+		if e != nil {
+			return nil, compileError(w.pos, fmt.Errorf("fn parameters must be a vector, got %s", printer.PrintStr(cl[0], true)))
+		}
+		p := &Proto{}
+		c.em = &emitter{p, map[interface{}]int{}}
+		psc := &scope{map[string]int{}, nil, &arityScope{lambda: ls}}
+		patterns := map[int]types.ParrotType{}
+		stores := []store{}
+		for _, param := range params {
+			if sym, ok := param.(types.Symbol); ok && sym.Val == "&" {
+				p.Variadic = true
+				continue
+			}
+			if !p.Variadic {
+				p.Required++
+			}
+			slot := psc.arity.nlocals
+			psc.arity.nlocals++
+			if sym, ok := param.(types.Symbol); ok {
+				psc.names[sym.Val] = slot
+			} else {
+				patterns[slot] = param
+			}
+			stores = append(stores, c.setLocal(slot, w.pos))
+		}
+		switch {
+		case p.Variadic && variadic:
+			return nil, compileError(w.pos, errors.New("fn can have only one variadic arity"))
+		case p.Variadic:
+			variadic = true
+		case fixed[p.Required]:
+			return nil, compileError(w.pos, fmt.Errorf("fn has two arities taking %d args", p.Required))
+		default:
+			fixed[p.Required] = true
+		}
+		for slot := 0; slot < len(stores); slot++ {
+			pattern, ok := patterns[slot]
+			if !ok {
+				continue
+			}
+			c.emit(w.pos, OpGetLocal, slot)
+			st, e := c.pattern(pattern, psc, w)
+			if e != nil {
+				return nil, e
+			}
+			if e := st(); e != nil {
+				return nil, e
+			}
+		}
+		bw := where{true, &recurTarget{0, stores}, w.pos}
+		if e := c.compile(cl[1], psc, bw); e != nil {
+			return nil, e
+		}
+		c.emit(w.pos, OpReturn)
+		p.NumLocals = psc.arity.nlocals
+		l.Arities = append(l.Arities, p)
+		l.Forms = append(l.Forms, types.Arity{cl[0], cl[1]})
+	}
+	l.Free = ls.free
+	l.Params, l.Exp = l.Forms[0].Params, l.Forms[0].Exp
+	return l, nil
+}
+
+// store emits the code that pops a value and binds the locals of a
+// pattern to it. Loops and fns emit it again for each recur.
+type store func() error
+
+func (c *compiler) setLocal(slot int, pos types.Position) store {
+	return func() error {
+		c.emit(pos, OpSetLocal, slot)
+		return nil
+	}
+}
+
+func keyword(name string) string {
+	kw, _ := types.NewKeyword(name)
+	return kw.(string)
+}
+
+func keywordIs(form types.ParrotType, name string) bool {
+	s, ok := form.(string)
+	return ok && s == keyword(name)
+}
+
+// pattern allocates locals in sc for the symbols of a binding pattern: a
+// symbol, a sequential pattern [a b & rest :as all] or an associative
+// pattern {:keys [a b] :strs [c] x :x :or {a 1} :as m}.
+func (c *compiler) pattern(pattern types.ParrotType, sc *scope, w where) (store, error) {
+	switch p := pattern.(type) {
+	case types.Symbol:
+		return c.setLocal(sc.bind(p.Val), w.pos), nil
+	case types.Vector:
+		return c.seqPattern(p.Val.Slice(), sc, w)
+	case types.HashMap:
+		return c.mapPattern(p, sc, w)
+	}
+	return nil, compileError(w.pos, fmt.Errorf("invalid binding form %s", printer.PrintStr(pattern, true)))
+}
+
+func (c *compiler) seqPattern(pattern []types.ParrotType, sc *scope, w where) (store, error) {
+	var rest, as store
+	positional := []store{}
+	for i := 0; i < len(pattern); i++ {
+		p := pattern[i]
+		isRest := types.Symbol_Q(p) && p.(types.Symbol).Val == "&"
+		if !isRest && !keywordIs(p, "as") {
+			st, e := c.pattern(p, sc, w)
+			if e != nil {
+				return nil, e
+			}
+			positional = append(positional, st)
+			continue
+		}
+		if i+1 >= len(pattern) {
+			return nil, compileError(w.pos, fmt.Errorf("missing binding form after %s", printer.PrintStr(p, true)))
+		}
+		i++
+		st, e := c.pattern(pattern[i], sc, w)
+		if e != nil {
+			return nil, e
+		}
+		if isRest {
+			rest = st
+		} else {
+			as = st
+		}
+	}
+	return func() error {
+		for i, st := range positional {
+			c.emit(w.pos, OpDup)
+			c.emit(w.pos, OpNth, i)
+			if e := st(); e != nil {
+				return e
+			}
+		}
+		if rest != nil {
+			c.emit(w.pos, OpDup)
+			c.emit(w.pos, OpRest, len(positional))
+			if e := rest(); e != nil {
+				return e
+			}
+		}
+		if as != nil {
+			c.emit(w.pos, OpDup)
+			if e := as(); e != nil {
+				return e
+			}
+		}
+		c.emit(w.pos, OpPop)
+		return nil
+	}, nil
+}
+
+// keyBinding stores the value a map holds for key, or def if has is set and
+// the map holds none.
+type keyBinding struct {
+	key   types.ParrotType
+	store store
+	def   types.ParrotType
+	has   bool
+}
+
+func (c *compiler) mapPattern(pattern types.HashMap, sc *scope, w where) (store, error) {
+	defaults := map[string]types.ParrotType{}
+	if or, ok := pattern.Val.Get(keyword("or")); ok {
+		hm, ok := or.(types.HashMap)
+		if !ok {
+			return nil, compileError(w.pos, fmt.Errorf(":or requires a map, got %s", printer.PrintStr(or, true)))
+		}
+		var err error
+		hm.Val.Range(func(k, d types.ParrotType) bool {
+			switch k := k.(type) {
+			case types.Symbol:
+				defaults[k.Val] = d
+				return true
+			case string:
+				if types.Keyword_Q(k) {
+					defaults[strings.TrimPrefix(k, keyword(""))] = d
+					return true
+				}
+			}
+			err = compileError(w.pos, fmt.Errorf(":or keys must be symbols, got %s", printer.PrintStr(k, true)))
+			return false
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	// the :keys, :strs and :as directives, in a fixed order, and then the
+	// {pattern key} entries
+	directives := []string{}
+	entries := []types.ParrotType{}
+	for _, k := range pattern.Val.Keys() {
+		switch k.(type) {
+		case string:
+			directives = append(directives, k.(string))
+		case types.Symbol, types.Vector, types.HashMap:
+			entries = append(entries, k)
+		default:
+			return nil, compileError(w.pos, fmt.Errorf("unsupported map binding key %s", printer.PrintStr(k, true)))
+		}
+	}
+	sort.Strings(directives)
+	bindings := []keyBinding{}
+	// bind adds a binding of the value of key to p, with the default :or
+	// gives when p is a symbol.
+	bind := func(p, key types.ParrotType) error {
+		st, e := c.pattern(p, sc, w)
+		if e != nil {
+			return e
+		}
+		kb := keyBinding{key: key, store: st}
+		if sym, ok := p.(types.Symbol); ok {
+			kb.def, kb.has = defaults[sym.Val]
+		}
+		bindings = append(bindings, kb)
+		return nil
+	}
+	var as store
+	for _, key := range directives {
+		names, _ := pattern.Val.Get(key)
+		switch key {
+		case keyword("keys"), keyword("strs"):
+			syms, e := types.GetSlice(names)
+			if e != nil {
+				return nil, compileError(w.pos, fmt.Errorf("%s requires a vector of symbols", printer.PrintStr(key, true)))
+			}
+			for _, s := range syms {
+				sym, ok := s.(types.Symbol)
+				if !ok {
+					return nil, compileError(w.pos, fmt.Errorf("%s requires a vector of symbols", printer.PrintStr(key, true)))
+				}
+				var k types.ParrotType = sym.Val
+				if key == keyword("keys") {
+					k = keyword(sym.Val)
+				}
+				if e := bind(sym, k); e != nil {
+					return nil, e
+				}
+			}
+		case keyword("as"):
+			st, e := c.pattern(names, sc, w)
+			if e != nil {
+				return nil, e
+			}
+			as = st
+		case keyword("or"):
+		default:
+			return nil, compileError(w.pos, fmt.Errorf("unsupported map binding key %s", printer.PrintStr(key, true)))
+		}
+	}
+	for _, p := range entries {
+		key, _ := pattern.Val.Get(p)
+		if e := bind(p, key); e != nil {
+			return nil, e
+		}
+	}
+	return func() error {
+		for _, kb := range bindings {
+			key, e := c.constant(kb.key, w.pos)
+			if e != nil {
+				return e
+			}
+			if !kb.has {
+				c.emit(w.pos, OpDup)
+				c.emit(w.pos, OpGetKey, key)
+				if e := kb.store(); e != nil {
+					return e
+				}
+				continue
+			}
+			c.emit(w.pos, OpDup)
+			c.emit(w.pos, OpHasKey, key)
+			jumpDef := c.emit(w.pos, OpJumpIfFalse, 0)
+			c.emit(w.pos, OpDup)
+			c.emit(w.pos, OpGetKey, key)
+			jumpEnd := c.emit(w.pos, OpJump, 0)
+			if e := c.patch(jumpDef); e != nil {
+				return compileError(w.pos, e)
+			}
+			if e := c.compile(kb.def, sc, w.operand()); e != nil {
+				return e
+			}
+			if e := c.patch(jumpEnd); e != nil {
+				return compileError(w.pos, e)
+			}
+			if e := kb.store(); e != nil {
+				return e
+			}
+		}
+		if as != nil {
+			c.emit(w.pos, OpDup)
+			if e := as(); e != nil {
+				return e
+			}
+		}
+		c.emit(w.pos, OpPop)
+		return nil
+	}, nil
+}
@@ -0,0 +1,66 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sllt/parrot/printer"
+)
+
+// Disassemble lists the instructions of each arity of l, followed by those
+// of the fns it creates.
+func Disassemble(l *Lambda) string {
+	var b strings.Builder
+	disassemble(&b, l)
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func disassemble(b *strings.Builder, l *Lambda) {
+	name := l.Name
+	if name == "" {
+		name = "fn"
+	}
+	nested := []*Lambda{}
+	for i, p := range l.Arities {
+		params := "[]"
+		if i < len(l.Forms) {
+			params = printer.PrintStr(l.Forms[i].Params, true)
+		}
+		fmt.Fprintf(b, "%s %s locals: %d\n", name, params, p.NumLocals)
+		for ip := 0; ip < len(p.Code); {
+			op := Op(p.Code[ip])
+			n := 0
+			if int(op) < len(opInfos) {
+				n = opInfos[op].operands
+			}
+			if n == 0 {
+				fmt.Fprintf(b, "  %04d  %s", ip, op)
+			} else {
+				fmt.Fprintf(b, "  %04d  %-13s", ip, op)
+			}
+			operands := make([]int, n)
+			for j := range operands {
+				operands[j] = operand(p.Code, ip+1+2*j)
+				fmt.Fprintf(b, " %d", operands[j])
+			}
+			switch op {
+			case OpConst, OpGetGlobal, OpDef, OpDefMacro, OpGetKey, OpHasKey, OpField, OpCallMethod, OpEval:
+				fmt.Fprintf(b, "\t; %s", printer.PrintStr(p.Consts[operands[0]], true))
+			case OpCall, OpTailCall:
+				if operands[1] != noName {
+					fmt.Fprintf(b, "\t; %s", p.Consts[operands[1]])
+				}
+			case OpClosure:
+				inner := p.Consts[operands[0]].(*Lambda)
+				nested = append(nested, inner)
+				fmt.Fprintf(b, "\t; %s", printer.PrintStr(inner.Params, true))
+			}
+			b.WriteString("\n")
+			ip += 1 + 2*n
+		}
+	}
+	for _, inner := range nested {
+		b.WriteString("\n")
+		disassemble(b, inner)
+	}
+}
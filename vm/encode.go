@@ -0,0 +1,536 @@
+package vm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"os"
+
+	"github.com/sllt/parrot/types"
+)
+
+// magic starts every file of compiled code, followed by the version of
+// its format.
+const magic = "PRC\x06"
+
+const (
+	tagNil = iota
+	tagFalse
+	tagTrue
+	tagInt64
+	tagInt
+	tagFloat
+	tagString
+	tagSymbol
+	tagList
+	tagVector
+	tagHashMap
+	tagSet
+	tagPosition
+	tagLambda
+	tagFloat64
+	tagBigInt
+	tagRatio
+	tagChar
+	tagRegex
+)
+
+type encoder struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+}
+
+func (en *encoder) uint(n uint64) {
+	en.w.Write(en.buf[:binary.PutUvarint(en.buf[:], n)])
+}
+
+func (en *encoder) int(n int64) {
+	en.w.Write(en.buf[:binary.PutVarint(en.buf[:], n)])
+}
+
+func (en *encoder) bytes(b []byte) {
+	en.uint(uint64(len(b)))
+	en.w.Write(b)
+}
+
+func (en *encoder) value(val types.ParrotType) error {
+	switch v := val.(type) {
+	case nil:
+		en.uint(tagNil)
+	case bool:
+		if v {
+			en.uint(tagTrue)
+		} else {
+			en.uint(tagFalse)
+		}
+	case types.Int64:
+		en.uint(tagInt64)
+		en.int(v.Val)
+	case int:
+		en.uint(tagInt)
+		en.int(int64(v))
+	case float64:
+		en.uint(tagFloat)
+		en.uint(math.Float64bits(v))
+	case types.Float64:
+		en.uint(tagFloat64)
+		en.uint(math.Float64bits(v.Val))
+	case types.BigInt:
+		en.uint(tagBigInt)
+		en.bytes([]byte(v.Val.String()))
+	case types.Ratio:
+		en.uint(tagRatio)
+		en.bytes([]byte(v.Val.String()))
+	case types.Char:
+		en.uint(tagChar)
+		en.int(int64(v.Val))
+	case types.Regex:
+		en.uint(tagRegex)
+		en.bytes([]byte(v.Val.String()))
+	case string:
+		en.uint(tagString)
+		en.bytes([]byte(v))
+	case types.Symbol:
+		en.uint(tagSymbol)
+		en.bytes([]byte(v.Val))
+	case types.List:
+		en.uint(tagList)
+		return en.seq(v.Val, v.Meta)
+	case types.Vector:
+		en.uint(tagVector)
+		return en.seq(v.Val.Slice(), v.Meta)
+	case *types.LazySeq, types.Cons:
+		slc, e := types.ToSlice(v)
+		if e != nil {
+			return e
+		}
+		en.uint(tagList)
+		return en.seq(slc, nil)
+	case types.HashMap:
+		en.uint(tagHashMap)
+		en.uint(uint64(v.Val.Len()))
+		var err error
+		v.Val.Range(func(k, item types.ParrotType) bool {
+			if err = en.value(k); err != nil {
+				return false
+			}
+			err = en.value(item)
+			return err == nil
+		})
+		if err != nil {
+			return err
+		}
+		return en.value(v.Meta)
+	case types.Set:
+		en.uint(tagSet)
+		return en.seq(v.Val.Keys(), v.Meta)
+	case types.Position:
+		en.uint(tagPosition)
+		en.position(v)
+	case *Lambda:
+		en.uint(tagLambda)
+		return en.lambda(v)
+	default:
+		return fmt.Errorf("cannot serialize %T", val)
+	}
+	return nil
+}
+
+func (en *encoder) seq(items []types.ParrotType, meta types.ParrotType) error {
+	en.uint(uint64(len(items)))
+	for _, item := range items {
+		if e := en.value(item); e != nil {
+			return e
+		}
+	}
+	return en.value(meta)
+}
+
+func (en *encoder) position(pos types.Position) {
+	en.bytes([]byte(pos.File))
+	en.uint(uint64(pos.Line))
+	en.uint(uint64(pos.Column))
+}
+
+func (en *encoder) lambda(l *Lambda) error {
+	en.bytes([]byte(l.Name))
+	en.uint(uint64(len(l.Free)))
+	for _, r := range l.Free {
+		en.uint(uint64(r.Kind))
+		en.uint(uint64(r.Index))
+	}
+	en.uint(uint64(len(l.Forms)))
+	for _, ar := range l.Forms {
+		if e := en.value(ar.Params); e != nil {
+			return e
+		}
+		if e := en.value(ar.Exp); e != nil {
+			return e
+		}
+	}
+	en.uint(uint64(len(l.Arities)))
+	for _, p := range l.Arities {
+		en.uint(uint64(p.Required))
+		if p.Variadic {
+			en.uint(1)
+		} else {
+			en.uint(0)
+		}
+		en.uint(uint64(p.NumLocals))
+		en.bytes(p.Code)
+		en.uint(uint64(len(p.Consts)))
+		for _, c := range p.Consts {
+			if e := en.value(c); e != nil {
+				return e
+			}
+		}
+		en.uint(uint64(len(p.Lines)))
+		for _, ln := range p.Lines {
+			en.uint(uint64(ln.Offset))
+			en.position(ln.Pos)
+		}
+	}
+	return nil
+}
+
+// Write writes the compiled top-level forms ls to w.
+func Write(w io.Writer, ls []*Lambda) error {
+	en := &encoder{w: bufio.NewWriter(w)}
+	en.w.WriteString(magic)
+	en.uint(uint64(len(ls)))
+	for _, l := range ls {
+		if e := en.lambda(l); e != nil {
+			return e
+		}
+	}
+	return en.w.Flush()
+}
+
+// WriteFile writes the compiled top-level forms ls to the named file.
+func WriteFile(file string, ls []*Lambda) error {
+	f, e := os.Create(file)
+	if e != nil {
+		return e
+	}
+	if e := Write(f, ls); e != nil {
+		f.Close()
+		return e
+	}
+	return f.Close()
+}
+
+var errFormat = errors.New("not a file of compiled Parrot code")
+
+type decoder struct {
+	r *bufio.Reader
+}
+
+func (de *decoder) uint() (uint64, error) {
+	n, e := binary.ReadUvarint(de.r)
+	if e != nil {
+		return 0, errFormat
+	}
+	return n, nil
+}
+
+func (de *decoder) len() (int, error) {
+	n, e := de.uint()
+	if e == nil && n > math.MaxInt32 {
+		e = errFormat
+	}
+	return int(n), e
+}
+
+func (de *decoder) int() (int64, error) {
+	n, e := binary.ReadVarint(de.r)
+	if e != nil {
+		return 0, errFormat
+	}
+	return n, nil
+}
+
+func (de *decoder) bytes() ([]byte, error) {
+	n, e := de.len()
+	if e != nil {
+		return nil, e
+	}
+	b := make([]byte, n)
+	if _, e := io.ReadFull(de.r, b); e != nil {
+		return nil, errFormat
+	}
+	return b, nil
+}
+
+func (de *decoder) string() (string, error) {
+	b, e := de.bytes()
+	return string(b), e
+}
+
+func (de *decoder) value() (types.ParrotType, error) {
+	tag, e := de.uint()
+	if e != nil {
+		return nil, e
+	}
+	switch tag {
+	case tagNil:
+		return nil, nil
+	case tagFalse:
+		return false, nil
+	case tagTrue:
+		return true, nil
+	case tagInt64:
+		n, e := de.int()
+		return types.Int64{n}, e
+	case tagInt:
+		n, e := de.int()
+		return int(n), e
+	case tagFloat:
+		n, e := de.uint()
+		return math.Float64frombits(n), e
+	case tagFloat64:
+		n, e := de.uint()
+		return types.Float64{math.Float64frombits(n)}, e
+	case tagBigInt:
+		s, e := de.string()
+		if e != nil {
+			return nil, e
+		}
+		n, ok := new(big.Int).SetString(s, 10)
+		if !ok {
+			return nil, errFormat
+		}
+		return types.BigInt{n}, nil
+	case tagRatio:
+		s, e := de.string()
+		if e != nil {
+			return nil, e
+		}
+		r, ok := new(big.Rat).SetString(s)
+		if !ok {
+			return nil, errFormat
+		}
+		return types.Ratio{r}, nil
+	case tagChar:
+		n, e := de.int()
+		return types.Char{rune(n)}, e
+	case tagRegex:
+		s, e := de.string()
+		if e != nil {
+			return nil, e
+		}
+		re, e := types.NewRegex(s)
+		if e != nil {
+			return nil, errFormat
+		}
+		return re, nil
+	case tagString:
+		return de.string()
+	case tagSymbol:
+		s, e := de.string()
+		return types.Symbol{s}, e
+	case tagList:
+		items, meta, e := de.seq()
+		return types.List{items, meta}, e
+	case tagVector:
+		items, meta, e := de.seq()
+		vec := types.NewVector(items...)
+		vec.Meta = meta
+		return vec, e
+	case tagHashMap:
+		n, e := de.len()
+		if e != nil {
+			return nil, e
+		}
+		t := types.PersistentMap{}.Transient()
+		for i := 0; i < n; i++ {
+			k, e := de.value()
+			if e != nil {
+				return nil, e
+			}
+			v, e := de.value()
+			if e != nil {
+				return nil, e
+			}
+			t.Assoc(k, v)
+		}
+		hm := types.HashMap{t.Persistent(), nil}
+		hm.Meta, e = de.value()
+		return hm, e
+	case tagSet:
+		items, meta, e := de.seq()
+		set := types.NewSet(items...)
+		set.Meta = meta
+		return set, e
+	case tagPosition:
+		return de.position()
+	case tagLambda:
+		return de.lambda()
+	}
+	return nil, errFormat
+}
+
+func (de *decoder) seq() ([]types.ParrotType, types.ParrotType, error) {
+	n, e := de.len()
+	if e != nil {
+		return nil, nil, e
+	}
+	items := []types.ParrotType{}
+	for i := 0; i < n; i++ {
+		item, e := de.value()
+		if e != nil {
+			return nil, nil, e
+		}
+		items = append(items, item)
+	}
+	meta, e := de.value()
+	return items, meta, e
+}
+
+func (de *decoder) position() (types.Position, error) {
+	file, e := de.string()
+	if e != nil {
+		return types.Position{}, e
+	}
+	line, e := de.len()
+	if e != nil {
+		return types.Position{}, e
+	}
+	col, e := de.len()
+	return types.Position{file, line, col}, e
+}
+
+func (de *decoder) lambda() (*Lambda, error) {
+	var e error
+	l := &Lambda{}
+	if l.Name, e = de.string(); e != nil {
+		return nil, e
+	}
+	n, e := de.len()
+	if e != nil {
+		return nil, e
+	}
+	for i := 0; i < n; i++ {
+		var r FreeRef
+		if r.Kind, e = de.len(); e != nil {
+			return nil, e
+		}
+		if r.Index, e = de.len(); e != nil {
+			return nil, e
+		}
+		l.Free = append(l.Free, r)
+	}
+	if n, e = de.len(); e != nil {
+		return nil, e
+	}
+	for i := 0; i < n; i++ {
+		var ar types.Arity
+		if ar.Params, e = de.value(); e != nil {
+			return nil, e
+		}
+		if ar.Exp, e = de.value(); e != nil {
+			return nil, e
+		}
+		l.Forms = append(l.Forms, ar)
+	}
+	if len(l.Forms) > 0 {
+		l.Params, l.Exp = l.Forms[0].Params, l.Forms[0].Exp
+	}
+	if n, e = de.len(); e != nil {
+		return nil, e
+	}
+	for i := 0; i < n; i++ {
+		p, e := de.proto()
+		if e != nil {
+			return nil, e
+		}
+		if !p.verify(len(l.Free)) {
+			return nil, errFormat
+		}
+		l.Arities = append(l.Arities, p)
+	}
+	return l, nil
+}
+
+func (de *decoder) proto() (*Proto, error) {
+	var e error
+	p := &Proto{}
+	if p.Required, e = de.len(); e != nil {
+		return nil, e
+	}
+	variadic, e := de.uint()
+	if e != nil {
+		return nil, e
+	}
+	p.Variadic = variadic == 1
+	if p.NumLocals, e = de.len(); e != nil {
+		return nil, e
+	}
+	if p.Code, e = de.bytes(); e != nil {
+		return nil, e
+	}
+	n, e := de.len()
+	if e != nil {
+		return nil, e
+	}
+	for i := 0; i < n; i++ {
+		c, e := de.value()
+		if e != nil {
+			return nil, e
+		}
+		p.Consts = append(p.Consts, c)
+	}
+	if n, e = de.len(); e != nil {
+		return nil, e
+	}
+	for i := 0; i < n; i++ {
+		var ln Line
+		if ln.Offset, e = de.len(); e != nil {
+			return nil, e
+		}
+		if ln.Pos, e = de.position(); e != nil {
+			return nil, e
+		}
+		p.Lines = append(p.Lines, ln)
+	}
+	return p, nil
+}
+
+// Read reads compiled top-level forms written by Write.
+func Read(r io.Reader) ([]*Lambda, error) {
+	de := &decoder{bufio.NewReader(r)}
+	head := make([]byte, len(magic))
+	if _, e := io.ReadFull(de.r, head); e != nil || string(head) != magic {
+		return nil, errFormat
+	}
+	n, e := de.len()
+	if e != nil {
+		return nil, e
+	}
+	ls := []*Lambda{}
+	for i := 0; i < n; i++ {
+		l, e := de.lambda()
+		if e != nil {
+			return nil, e
+		}
+		ls = append(ls, l)
+	}
+	return ls, nil
+}
+
+// ReadFile reads the compiled top-level forms in the named file.
+func ReadFile(file string) ([]*Lambda, error) {
+	f, e := os.Open(file)
+	if e != nil {
+		return nil, e
+	}
+	defer f.Close()
+	ls, e := Read(f)
+	if e != nil {
+		return nil, fmt.Errorf("%s: %w", file, e)
+	}
+	return ls, nil
+}
@@ -0,0 +1,94 @@
+package vm
+
+// Op is a bytecode instruction. Its operands follow it in the code as
+// big-endian uint16s.
+type Op byte
+
+const (
+	OpConst       Op = iota // idx: push Consts[idx]
+	OpNil                   // push nil
+	OpTrue                  // push true
+	OpFalse                 // push false
+	OpPop                   // drop the top of the stack
+	OpDup                   // push the top of the stack again
+	OpGetLocal              // slot: push a local
+	OpSetLocal              // slot: pop into a local
+	OpGetFree               // idx: push a value captured by the closure
+	OpGetSelf               // push the running fn
+	OpGetGlobal             // idx: push the global named by the symbol Consts[idx]
+	OpDef                   // idx: define the global named by Consts[idx] as the top of the stack
+	OpDefMacro              // idx: like OpDef, making the fn on top a macro
+	OpJump                  // target: continue at target
+	OpJumpIfFalse           // target: pop, and continue at target if it was nil or false
+	OpLoop                  // target: jump back to the start of a loop
+	OpCall                  // argc, name: call the fn below argc args; name is the Consts index of its name
+	OpTailCall              // argc, name: call in tail position, reusing the frame
+	OpReturn                // return the top of the stack
+	OpClosure               // idx: push a closure of the Lambda Consts[idx]
+	OpVector                // n: replace n values by a vector of them
+	OpHashMap               // n: replace n values, keys and values in turn, by a hash-map
+	OpSet                   // n: replace n values by a set of them
+	OpTry                   // target: handle errors up to OpEndTry by continuing at target
+	OpEndTry                // drop the innermost handler
+	OpNth                   // i: replace a sequence by its i-th item
+	OpRest                  // i: replace a sequence by a list of its items from i on
+	OpGetKey                // idx: replace a hash-map by its value for Consts[idx]
+	OpHasKey                // idx: replace a hash-map by whether it has Consts[idx]
+	OpField                 // idx: replace a Go value by its field named Consts[idx]
+	OpCallMethod            // idx, argc: call the method named Consts[idx] of the Go value below argc args
+	OpEval                  // idx: have the host evaluate the form Consts[idx]
+)
+
+type opInfo struct {
+	name     string
+	operands int
+}
+
+var opInfos = [...]opInfo{
+	OpConst:       {"CONST", 1},
+	OpNil:         {"NIL", 0},
+	OpTrue:        {"TRUE", 0},
+	OpFalse:       {"FALSE", 0},
+	OpPop:         {"POP", 0},
+	OpDup:         {"DUP", 0},
+	OpGetLocal:    {"GET_LOCAL", 1},
+	OpSetLocal:    {"SET_LOCAL", 1},
+	OpGetFree:     {"GET_FREE", 1},
+	OpGetSelf:     {"GET_SELF", 0},
+	OpGetGlobal:   {"GET_GLOBAL", 1},
+	OpDef:         {"DEF", 1},
+	OpDefMacro:    {"DEF_MACRO", 1},
+	OpJump:        {"JUMP", 1},
+	OpJumpIfFalse: {"JUMP_IF_FALSE", 1},
+	OpLoop:        {"LOOP", 1},
+	OpCall:        {"CALL", 2},
+	OpTailCall:    {"TAIL_CALL", 2},
+	OpReturn:      {"RETURN", 0},
+	OpClosure:     {"CLOSURE", 1},
+	OpVector:      {"VECTOR", 1},
+	OpHashMap:     {"HASH_MAP", 1},
+	OpSet:         {"SET", 1},
+	OpTry:         {"TRY", 1},
+	OpEndTry:      {"END_TRY", 0},
+	OpNth:         {"NTH", 1},
+	OpRest:        {"REST", 1},
+	OpGetKey:      {"GET_KEY", 1},
+	OpHasKey:      {"HAS_KEY", 1},
+	OpField:       {"FIELD", 1},
+	OpCallMethod:  {"CALL_METHOD", 2},
+	OpEval:        {"EVAL", 1},
+}
+
+func (op Op) String() string {
+	if int(op) < len(opInfos) {
+		return opInfos[op].name
+	}
+	return "UNKNOWN"
+}
+
+// noName is the name operand of a call whose callee has no name.
+const noName = 0xffff
+
+func operand(code []byte, at int) int {
+	return int(code[at])<<8 | int(code[at+1])
+}
@@ -0,0 +1,123 @@
+package vm
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/sllt/parrot/types"
+)
+
+// Proto is the bytecode of one arity of a fn. Its first Required locals
+// hold the arguments, followed by a list of the rest if it is Variadic.
+type Proto struct {
+	Required  int
+	Variadic  bool
+	NumLocals int
+	Code      []byte
+	Consts    []types.ParrotType
+	Lines     []Line
+
+	once    sync.Once
+	globals []globalCache
+}
+
+// Line records that the code from Offset on was compiled from the form at
+// Pos.
+type Line struct {
+	Offset int
+	Pos    types.Position
+}
+
+// pos returns the position of the form the instruction at ip came from.
+func (p *Proto) pos(ip int) types.Position {
+	i := sort.Search(len(p.Lines), func(i int) bool { return p.Lines[i].Offset > ip })
+	if i == 0 {
+		return types.Position{}
+	}
+	return p.Lines[i-1].Pos
+}
+
+func (p *Proto) cache(idx int) *globalCache {
+	p.once.Do(func() { p.globals = make([]globalCache, len(p.Consts)) })
+	return &p.globals[idx]
+}
+
+const (
+	RefLocal = iota // a local of the defining frame
+	RefFree         // a value captured by the defining closure
+	RefSelf         // the defining fn itself
+)
+
+// FreeRef says where the frame that creates a closure keeps a value the
+// closure captures.
+type FreeRef struct {
+	Kind  int
+	Index int
+}
+
+// Lambda is a compiled fn form. Params and Exp keep the source of its first
+// arity and Forms that of all of them, for printing.
+type Lambda struct {
+	Name    string
+	Arities []*Proto
+	Free    []FreeRef
+	Params  types.ParrotType
+	Exp     types.ParrotType
+	Forms   []types.Arity
+}
+
+func (l *Lambda) arity(n int) *Proto {
+	var variadic *Proto
+	for _, p := range l.Arities {
+		if !p.Variadic && p.Required == n {
+			return p
+		}
+		if p.Variadic && n >= p.Required && variadic == nil {
+			variadic = p
+		}
+	}
+	return variadic
+}
+
+// Host is what compiled code needs from the evaluator that embeds it.
+type Host struct {
+	// Quasiquote turns the body of a quasiquote into a form that builds it.
+	Quasiquote func(form types.ParrotType) types.ParrotType
+	// Eval evaluates the forms the compiler leaves to the host, such as ns.
+	Eval func(form types.ParrotType, env types.EnvType) (types.ParrotType, error)
+}
+
+// Closure is a Lambda together with the values it captured. It is the
+// Compiled code of the ParrotFunc it makes.
+type Closure struct {
+	Lambda *Lambda
+	Free   []types.ParrotType
+	Env    types.EnvType
+	Fn     types.ParrotFunc
+	host   *Host
+}
+
+func newClosure(l *Lambda, free []types.ParrotType, env types.EnvType, host *Host) types.ParrotFunc {
+	cl := &Closure{l, free, env, types.ParrotFunc{}, host}
+	var forms []types.Arity
+	if len(l.Forms) > 1 {
+		forms = l.Forms
+	}
+	cl.Fn = types.ParrotFunc{nil, l.Exp, env, l.Params, false, nil, nil, false, l.Name, forms, cl}
+	return cl.Fn
+}
+
+// Call runs the closure for args on a new machine.
+func (cl *Closure) Call(args []types.ParrotType, frame *types.Frame, budget *types.Budget) (types.ParrotType, error) {
+	m := &machine{budget: budget}
+	if e := m.enter(cl, args, frame); e != nil {
+		return nil, e
+	}
+	return m.run()
+}
+
+// Run runs a Lambda compiled by Compile in env.
+func Run(l *Lambda, env types.EnvType, host *Host) (types.ParrotType, error) {
+	fn := newClosure(l, nil, env, host)
+	return fn.Compiled.Call(nil, env.Frame(), env.Budget())
+}
@@ -0,0 +1,151 @@
+package vm
+
+import "github.com/sllt/parrot/types"
+
+// effect is the state of a frame before an instruction: the values on its
+// stack above the locals and the handlers its try blocks pushed.
+type effect struct {
+	stack int
+	tries int
+}
+
+// verify checks that every path through the code of p stays within its
+// operands, stack and handlers and ends in a return. Compiled code always
+// passes; it keeps a damaged file from crashing the machine.
+func (p *Proto) verify(nfree int) bool {
+	if len(p.Code) == 0 || p.Required > p.NumLocals || p.Variadic && p.Required >= p.NumLocals {
+		return false
+	}
+	seen := map[int]effect{}
+	work := []int{0}
+	seen[0] = effect{}
+	// flow records that control reaches target in state s.
+	flow := func(target int, s effect) bool {
+		if target < 0 || target >= len(p.Code) {
+			return false
+		}
+		if prev, ok := seen[target]; ok {
+			return prev == s
+		}
+		seen[target] = s
+		work = append(work, target)
+		return true
+	}
+	for len(work) > 0 {
+		ip := work[len(work)-1]
+		work = work[:len(work)-1]
+		s := seen[ip]
+		op := Op(p.Code[ip])
+		if int(op) >= len(opInfos) || ip+1+2*opInfos[op].operands > len(p.Code) {
+			return false
+		}
+		next := ip + 1 + 2*opInfos[op].operands
+		var arg, arg2 int
+		if opInfos[op].operands > 0 {
+			arg = operand(p.Code, ip+1)
+		}
+		if opInfos[op].operands > 1 {
+			arg2 = operand(p.Code, ip+3)
+		}
+		isConst := func(ok func(types.ParrotType) bool) bool {
+			return arg < len(p.Consts) && ok(p.Consts[arg])
+		}
+		need, push, ok := 0, 0, true
+		switch op {
+		case OpConst, OpEval:
+			push, ok = 1, arg < len(p.Consts)
+		case OpNil, OpTrue, OpFalse, OpGetSelf:
+			push = 1
+		case OpPop:
+			need = 1
+		case OpDup:
+			need, push = 1, 2
+		case OpGetLocal:
+			push, ok = 1, arg < p.NumLocals
+		case OpSetLocal:
+			need, ok = 1, arg < p.NumLocals
+		case OpGetFree:
+			push, ok = 1, arg < nfree
+		case OpGetGlobal:
+			push, ok = 1, isConst(types.Symbol_Q)
+		case OpDef, OpDefMacro:
+			need, push, ok = 1, 1, isConst(types.Symbol_Q)
+		case OpJump, OpLoop:
+			if !flow(arg, s) {
+				return false
+			}
+			continue
+		case OpJumpIfFalse:
+			if s.stack < 1 {
+				return false
+			}
+			s.stack--
+			if !flow(arg, s) || !flow(next, s) {
+				return false
+			}
+			continue
+		case OpCall, OpTailCall:
+			need, push = arg+1, 1
+			ok = arg2 == noName || arg2 < len(p.Consts) && types.String_Q(p.Consts[arg2])
+		case OpCallMethod:
+			need, push, ok = arg2+1, 1, isConst(types.String_Q)
+		case OpReturn:
+			if s.stack < 1 {
+				return false
+			}
+			continue
+		case OpClosure:
+			push, ok = 1, isConst(func(c types.ParrotType) bool {
+				l, ok := c.(*Lambda)
+				return ok && p.captures(l, nfree)
+			})
+		case OpVector, OpSet:
+			need, push = arg, 1
+		case OpHashMap:
+			need, push, ok = arg, 1, arg%2 == 0
+		case OpTry:
+			if !flow(arg, effect{s.stack + 1, s.tries}) {
+				return false
+			}
+			s.tries++
+		case OpEndTry:
+			if s.tries == 0 {
+				return false
+			}
+			s.tries--
+		case OpNth, OpRest:
+			need, push = 1, 1
+		case OpGetKey, OpHasKey, OpField:
+			need, push, ok = 1, 1, isConst(types.String_Q)
+		}
+		if !ok || s.stack < need {
+			return false
+		}
+		s.stack += push - need
+		if !flow(next, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// captures checks that the values the closures of l capture are in the
+// frames of p that create them.
+func (p *Proto) captures(l *Lambda, nfree int) bool {
+	for _, r := range l.Free {
+		switch r.Kind {
+		case RefLocal:
+			if r.Index >= p.NumLocals {
+				return false
+			}
+		case RefFree:
+			if r.Index >= nfree {
+				return false
+			}
+		case RefSelf:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,465 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/sllt/parrot/env"
+	"github.com/sllt/parrot/interop"
+	"github.com/sllt/parrot/printer"
+	"github.com/sllt/parrot/types"
+)
+
+// globalCache remembers where a global was found, so that it is looked up
+// once and then read from where it is defined, seeing redefinitions, until
+// a new definition may shadow it.
+type globalCache struct {
+	binding atomic.Value
+}
+
+type resolver interface {
+	Resolve(name string) *env.Binding
+}
+
+type handler struct {
+	target int
+	sp     int
+}
+
+type frame struct {
+	cl       *Closure
+	proto    *Proto
+	ip       int
+	base     int // index of the first local on the stack
+	call     *types.Frame
+	handlers []handler
+}
+
+// machine runs closures. Calls between closures push frames here instead
+// of growing the Go stack.
+type machine struct {
+	stack  []types.ParrotType
+	frames []frame
+	budget *types.Budget
+	slab   []types.ParrotType // where the args of calls are cut from
+}
+
+// slabSize is how many args are allocated at once. Builtins may keep the
+// args they are called with, so the args of a call are never reused; a
+// slab is freed once no call keeps any of its args.
+const slabSize = 128
+
+// args moves the top argc values of the stack to a slice of their own.
+func (m *machine) args(argc int) []types.ParrotType {
+	var args []types.ParrotType
+	if argc > slabSize/4 {
+		args = make([]types.ParrotType, argc)
+	} else {
+		if argc > len(m.slab) {
+			m.slab = make([]types.ParrotType, slabSize)
+		}
+		args = m.slab[:argc:argc]
+		m.slab = m.slab[argc:]
+	}
+	copy(args, m.stack[len(m.stack)-argc:])
+	m.stack = m.stack[:len(m.stack)-argc]
+	return args
+}
+
+func stackTrace(f *types.Frame) []types.Frame {
+	trace := []types.Frame{}
+	for ; f != nil; f = f.Caller {
+		trace = append(trace, *f)
+	}
+	return trace
+}
+
+func traceError(e error, call *types.Frame, pos types.Position) error {
+	var te *types.EvalError
+	if errors.As(e, &te) {
+		if te.Pos.Line == 0 {
+			te.Pos = pos
+		}
+		return e
+	}
+	return &types.EvalError{e, pos, stackTrace(call)}
+}
+
+func extendTrace(e error, name string, call *types.Frame, pos types.Position) error {
+	var te *types.EvalError
+	if errors.As(e, &te) {
+		te.Trace = append(te.Trace, types.Frame{Name: name, Pos: pos})
+		te.Trace = append(te.Trace, stackTrace(call)...)
+	}
+	return e
+}
+
+// enter pushes a frame running cl for args. call is nil for the code of a
+// top-level form.
+func (m *machine) enter(cl *Closure, args []types.ParrotType, call *types.Frame) error {
+	var caller *types.Frame
+	var pos types.Position
+	if call != nil {
+		caller, pos = call.Caller, call.Pos
+	}
+	if m.budget != nil {
+		if e := m.budget.Enter(); e != nil {
+			return traceError(e, caller, pos)
+		}
+		if e := m.budget.Step(); e != nil {
+			m.budget.Leave()
+			return traceError(e, call, pos)
+		}
+	}
+	p := cl.Lambda.arity(len(args))
+	if p == nil {
+		if m.budget != nil {
+			m.budget.Leave()
+		}
+		fn := cl.Fn
+		if call != nil {
+			fn.Name = call.Name
+		}
+		_, _, e := fn.SelectArity(len(args))
+		return traceError(e, caller, pos)
+	}
+	base := len(m.stack)
+	m.stack = append(m.stack, args[:p.Required]...)
+	if p.Variadic {
+		m.stack = append(m.stack, types.List{append([]types.ParrotType{}, args[p.Required:]...), nil})
+	}
+	for len(m.stack) < base+p.NumLocals {
+		m.stack = append(m.stack, nil)
+	}
+	m.frames = append(m.frames, frame{cl, p, 0, base, call, nil})
+	return nil
+}
+
+// leave pops the innermost frame and its stack.
+func (m *machine) leave() {
+	f := &m.frames[len(m.frames)-1]
+	m.stack = m.stack[:f.base]
+	m.frames = m.frames[:len(m.frames)-1]
+	if m.budget != nil {
+		m.budget.Leave()
+	}
+}
+
+func (m *machine) push(v types.ParrotType) {
+	m.stack = append(m.stack, v)
+}
+
+func (m *machine) pop() types.ParrotType {
+	v := m.stack[len(m.stack)-1]
+	m.stack = m.stack[:len(m.stack)-1]
+	return v
+}
+
+// fail unwinds the frames of the machine to the innermost handler of e. It
+// returns e if no frame handles it.
+func (m *machine) fail(e error) error {
+	if types.IsInterrupt(e) || types.IsEscape(e) {
+		for len(m.frames) > 0 {
+			m.leave()
+		}
+		return e
+	}
+	var exc types.ParrotType = e.Error()
+	var perr types.ParrotError
+	if errors.As(e, &perr) {
+		exc = perr.Obj
+	}
+	for len(m.frames) > 0 {
+		f := &m.frames[len(m.frames)-1]
+		if n := len(f.handlers); n > 0 {
+			h := f.handlers[n-1]
+			f.handlers = f.handlers[:n-1]
+			m.stack = m.stack[:h.sp]
+			m.push(exc)
+			f.ip = h.target
+			return nil
+		}
+		m.leave()
+	}
+	return e
+}
+
+// run runs the frames of the machine until the outermost one returns.
+func (m *machine) run() (types.ParrotType, error) {
+	for {
+		res, e := m.step()
+		if e == nil {
+			return res, nil
+		}
+		if e = m.fail(e); e != nil {
+			return nil, e
+		}
+	}
+}
+
+func (m *machine) step() (types.ParrotType, error) {
+	f := &m.frames[len(m.frames)-1]
+	for {
+		code := f.proto.Code
+		start := f.ip
+		op := Op(code[start])
+		f.ip += 1 + 2*opInfos[op].operands
+		var arg int
+		if opInfos[op].operands > 0 {
+			arg = operand(code, start+1)
+		}
+		switch op {
+		case OpConst:
+			m.push(f.proto.Consts[arg])
+		case OpNil:
+			m.push(nil)
+		case OpTrue:
+			m.push(true)
+		case OpFalse:
+			m.push(false)
+		case OpPop:
+			m.pop()
+		case OpDup:
+			m.push(m.stack[len(m.stack)-1])
+		case OpGetLocal:
+			m.push(m.stack[f.base+arg])
+		case OpSetLocal:
+			m.stack[f.base+arg] = m.pop()
+		case OpGetFree:
+			m.push(f.cl.Free[arg])
+		case OpGetSelf:
+			m.push(f.cl.Fn)
+		case OpGetGlobal:
+			v, e := m.global(f, arg)
+			if e != nil {
+				return nil, traceError(e, f.call, f.proto.pos(start))
+			}
+			m.push(v)
+		case OpDef:
+			sym := f.proto.Consts[arg].(types.Symbol)
+			v := m.pop()
+			if fn, ok := v.(types.ParrotFunc); ok && fn.Name == "" {
+				fn.Name = sym.Val
+				v = fn
+			}
+			m.push(f.cl.Env.Set(sym, v))
+		case OpDefMacro:
+			sym := f.proto.Consts[arg].(types.Symbol)
+			mac, ok := m.pop().(types.ParrotFunc)
+			if !ok {
+				return nil, traceError(errors.New("defmacro requires a fn"), f.call, f.proto.pos(start))
+			}
+			if mac.Name == "" {
+				mac.Name = sym.Val
+			}
+			m.push(f.cl.Env.Set(sym, mac.SetMacro()))
+		case OpJump:
+			f.ip = arg
+		case OpJumpIfFalse:
+			if v := m.pop(); v == nil || v == false {
+				f.ip = arg
+			}
+		case OpLoop:
+			if m.budget != nil {
+				if e := m.budget.Step(); e != nil {
+					return nil, traceError(e, f.call, f.proto.pos(start))
+				}
+			}
+			f.ip = arg
+		case OpCall, OpTailCall:
+			argc := arg
+			name := ""
+			if n := operand(code, start+3); n != noName {
+				name = f.proto.Consts[n].(string)
+			}
+			args := m.args(argc)
+			callee := m.pop()
+			// builtins are called straight away, and need the position
+			// only when they fail
+			if fn, ok := callee.(types.Func); ok {
+				res, e := fn.Call(args, m.budget)
+				if e != nil {
+					pos := f.proto.pos(start)
+					return nil, traceError(extendTrace(e, name, f.call, pos), f.call, pos)
+				}
+				m.push(res)
+				continue
+			}
+			pos := f.proto.pos(start)
+			fn, ok := callee.(types.ParrotFunc)
+			if cl, isVM := fn.Compiled.(*Closure); ok && isVM {
+				if fn.Name != "" {
+					name = fn.Name
+				}
+				call := &types.Frame{Name: name, Pos: pos, Caller: f.call}
+				if op == OpTailCall {
+					if f.call != nil {
+						call = &types.Frame{name, pos, f.call.Tail + 1, f.call.Caller}
+					}
+					m.leave()
+				}
+				if e := m.enter(cl, args, call); e != nil {
+					return nil, e
+				}
+				f = &m.frames[len(m.frames)-1]
+				continue
+			}
+			res, e := m.call(f, callee, args, name, pos)
+			if e != nil {
+				return nil, e
+			}
+			m.push(res)
+		case OpReturn:
+			res := m.pop()
+			m.leave()
+			if len(m.frames) == 0 {
+				return res, nil
+			}
+			m.push(res)
+			f = &m.frames[len(m.frames)-1]
+		case OpClosure:
+			l := f.proto.Consts[arg].(*Lambda)
+			free := make([]types.ParrotType, len(l.Free))
+			for i, r := range l.Free {
+				switch r.Kind {
+				case RefLocal:
+					free[i] = m.stack[f.base+r.Index]
+				case RefFree:
+					free[i] = f.cl.Free[r.Index]
+				default:
+					free[i] = f.cl.Fn
+				}
+			}
+			m.push(newClosure(l, free, f.cl.Env, f.cl.host))
+		case OpVector:
+			vec := types.NewVector(m.stack[len(m.stack)-arg:]...)
+			m.stack = m.stack[:len(m.stack)-arg]
+			m.push(vec)
+		case OpHashMap:
+			hm := types.PersistentMap{}.Transient()
+			kvs := m.stack[len(m.stack)-arg:]
+			for i := 0; i < len(kvs); i += 2 {
+				hm.Assoc(kvs[i], kvs[i+1])
+			}
+			m.stack = m.stack[:len(m.stack)-arg]
+			m.push(types.HashMap{hm.Persistent(), nil})
+		case OpSet:
+			set := types.NewSet(m.stack[len(m.stack)-arg:]...)
+			m.stack = m.stack[:len(m.stack)-arg]
+			m.push(set)
+		case OpTry:
+			f.handlers = append(f.handlers, handler{arg, len(m.stack)})
+		case OpEndTry:
+			f.handlers = f.handlers[:len(f.handlers)-1]
+		case OpNth, OpRest:
+			val := m.pop()
+			if !types.Seqable_Q(val) {
+				e := fmt.Errorf("cannot destructure %s as a sequence", printer.PrintStr(val, true))
+				return nil, traceError(e, f.call, f.proto.pos(start))
+			}
+			n := arg
+			if op == OpNth {
+				n++
+			}
+			slc, more, e := types.SplitSeq(val, n)
+			if e != nil {
+				return nil, traceError(e, f.call, f.proto.pos(start))
+			}
+			if op == OpRest {
+				m.push(more)
+			} else if arg < len(slc) {
+				m.push(slc[arg])
+			} else {
+				m.push(nil)
+			}
+		case OpGetKey, OpHasKey:
+			var hm types.PersistentMap
+			switch v := m.pop().(type) {
+			case nil:
+			case types.HashMap:
+				hm = v.Val
+			default:
+				e := fmt.Errorf("cannot destructure %s as a map", printer.PrintStr(v, true))
+				return nil, traceError(e, f.call, f.proto.pos(start))
+			}
+			v, ok := hm.Get(f.proto.Consts[arg])
+			if op == OpHasKey {
+				m.push(ok)
+			} else {
+				m.push(v)
+			}
+		case OpField:
+			res, e := interop.Field(m.pop(), f.proto.Consts[arg].(string))
+			if e != nil {
+				return nil, traceError(e, f.call, f.proto.pos(start))
+			}
+			m.push(res)
+		case OpCallMethod:
+			argc := operand(code, start+3)
+			vals := append([]types.ParrotType{}, m.stack[len(m.stack)-argc-1:]...)
+			m.stack = m.stack[:len(m.stack)-argc-1]
+			res, e := interop.CallMethod(vals[0], f.proto.Consts[arg].(string), vals[1:])
+			if e != nil {
+				return nil, traceError(e, f.call, f.proto.pos(start))
+			}
+			m.push(res)
+		case OpEval:
+			res, e := f.cl.host.Eval(f.proto.Consts[arg], f.cl.Env)
+			if e != nil {
+				return nil, traceError(e, f.call, f.proto.pos(start))
+			}
+			m.push(res)
+		default:
+			return nil, fmt.Errorf("invalid opcode %d", op)
+		}
+	}
+}
+
+func (m *machine) global(f *frame, idx int) (types.ParrotType, error) {
+	sym := f.proto.Consts[idx].(types.Symbol)
+	cache := f.proto.cache(idx)
+	if b, ok := cache.binding.Load().(*env.Binding); ok && b.Valid() {
+		if v, ok := b.Data[b.Key]; ok {
+			return v, nil
+		}
+	}
+	if r, ok := f.cl.Env.(resolver); ok {
+		if b := r.Resolve(sym.Val); b != nil {
+			cache.binding.Store(b)
+			return b.Data[b.Key], nil
+		}
+	}
+	return f.cl.Env.Get(sym)
+}
+
+// call calls a fn that does not run on this machine.
+func (m *machine) call(f *frame, callee types.ParrotType, args []types.ParrotType, name string, pos types.Position) (types.ParrotType, error) {
+	switch fn := callee.(type) {
+	case types.ParrotFunc:
+		if fn.Compiled == nil {
+			res, e := types.Apply(fn, args, false)
+			if e != nil {
+				return nil, traceError(e, f.call, pos)
+			}
+			return res, nil
+		}
+		if fn.Name != "" {
+			name = fn.Name
+		}
+		return fn.Compiled.Call(args, &types.Frame{Name: name, Pos: pos, Caller: f.call}, m.budget)
+	case types.Func:
+		res, e := fn.Call(args, m.budget)
+		if e != nil {
+			return nil, traceError(extendTrace(e, name, f.call, pos), f.call, pos)
+		}
+		return res, nil
+	case types.Set:
+		res, e := fn.Call(args)
+		if e != nil {
+			return nil, traceError(e, f.call, pos)
+		}
+		return res, nil
+	}
+	return nil, traceError(errors.New("attempt to call non-function"), f.call, pos)
+}
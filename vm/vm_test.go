@@ -0,0 +1,170 @@
+package vm
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sllt/parrot/env"
+	"github.com/sllt/parrot/printer"
+	"github.com/sllt/parrot/reader"
+	"github.com/sllt/parrot/types"
+)
+
+var testHost = &Host{
+	func(form types.ParrotType) types.ParrotType { return form },
+	func(form types.ParrotType, _ types.EnvType) (types.ParrotType, error) {
+		return nil, errors.New("no host")
+	},
+}
+
+// builtins are the fns the programs below call.
+var builtins = map[string]func([]types.ParrotType) (types.ParrotType, error){
+	"+": func(a []types.ParrotType) (types.ParrotType, error) {
+		var n int64
+		for _, x := range a {
+			n += x.(types.Int64).Val
+		}
+		return types.Int64{n}, nil
+	},
+	"<": func(a []types.ParrotType) (types.ParrotType, error) {
+		return a[0].(types.Int64).Val < a[1].(types.Int64).Val, nil
+	},
+	"count": func(a []types.ParrotType) (types.ParrotType, error) {
+		s, e := types.GetSlice(a[0])
+		return types.Int64{int64(len(s))}, e
+	},
+	"throw": func(a []types.ParrotType) (types.ParrotType, error) {
+		return nil, types.ParrotError{a[0]}
+	},
+}
+
+func testEnv(t *testing.T) types.EnvType {
+	t.Helper()
+	e, err := env.NewEnv(nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, fn := range builtins {
+		e.Set(types.Symbol{name}, types.Func{fn, nil, false, nil})
+	}
+	return e
+}
+
+func compileString(t *testing.T, src string, e types.EnvType) *Lambda {
+	t.Helper()
+	form, err := reader.NewReader(strings.NewReader(src), "test.pr").Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := Compile(form, e, testHost)
+	if err != nil {
+		t.Fatalf("%s: %v", src, err)
+	}
+	return l
+}
+
+var programs = map[string]string{
+	`(+ 1 2 3)`:                         "6",
+	`(let [a 1 [b c] [2 3]] (+ a b c))`: "6",
+	`(loop [i 0 n 0] (if (< i 5) (recur (+ i 1) (+ n i)) n))`: "10",
+	`((fn [x] ((fn [y] (+ x y)) 2)) 1)`:                       "3",
+	`((fn ([] 0) ([x & more] (+ x (count more)))) 5 6 7)`:     "7",
+	`(try (throw "boom") (catch e e))`:                        `"boom"`,
+	`(do (def sq (fn [x] (+ x x))) (sq 21))`:                  "42",
+	`(if nil :no (if false :no "yes"))`:                       `"yes"`,
+	`'(a "b" :c 1.5 [nil true] {:k #{1}})`:                    `(a "b" :c 1.5 [nil true] {:k #{1}})`,
+}
+
+func TestRun(t *testing.T) {
+	for src, want := range programs {
+		e := testEnv(t)
+		res, err := Run(compileString(t, src, e), e, testHost)
+		if err != nil {
+			t.Errorf("%s: %v", src, err)
+			continue
+		}
+		if got := printer.PrintStr(res, true); got != want {
+			t.Errorf("%s: got %s, want %s", src, got, want)
+		}
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	e := testEnv(t)
+	srcs := []string{}
+	ls := []*Lambda{}
+	for src := range programs {
+		srcs = append(srcs, src)
+		ls = append(ls, compileString(t, src, e))
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, ls); err != nil {
+		t.Fatal(err)
+	}
+	read, err := Read(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != len(ls) {
+		t.Fatalf("read %d forms, wrote %d", len(read), len(ls))
+	}
+	for i, l := range read {
+		if got, want := Disassemble(l), Disassemble(ls[i]); got != want {
+			t.Errorf("%s: read back as\n%s\nwant\n%s", srcs[i], got, want)
+		}
+		res, err := Run(l, e, testHost)
+		if err != nil {
+			t.Errorf("%s: %v", srcs[i], err)
+			continue
+		}
+		if got := printer.PrintStr(res, true); got != programs[srcs[i]] {
+			t.Errorf("%s: got %s after reading it back", srcs[i], got)
+		}
+	}
+}
+
+func TestReadRejectsDamagedCode(t *testing.T) {
+	l := compileString(t, `(loop [i 0] (if (< i 3) (recur (+ i 1)) i))`, testEnv(t))
+	var buf bytes.Buffer
+	if err := Write(&buf, []*Lambda{l}); err != nil {
+		t.Fatal(err)
+	}
+	good := buf.Bytes()
+	damaged := map[string][]byte{
+		"empty":     nil,
+		"magic":     append([]byte("XRC\x06"), good[len(magic):]...),
+		"truncated": good[:len(good)-3],
+	}
+	for name, b := range damaged {
+		if _, err := Read(bytes.NewReader(b)); !errors.Is(err, errFormat) {
+			t.Errorf("%s: got %v, want %v", name, err, errFormat)
+		}
+	}
+	// a jump past the end of its code must not reach the machine
+	p := l.Arities[0]
+	for ip := 0; ip < len(p.Code); ip += 1 + 2*opInfos[p.Code[ip]].operands {
+		if op := Op(p.Code[ip]); op == OpJump || op == OpJumpIfFalse {
+			p.Code[ip+1], p.Code[ip+2] = 0x7f, 0xff
+			break
+		}
+	}
+	buf.Reset()
+	if err := Write(&buf, []*Lambda{l}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(bytes.NewReader(buf.Bytes())); !errors.Is(err, errFormat) {
+		t.Errorf("bad jump: got %v, want %v", err, errFormat)
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	l := compileString(t, `(fn add1 [x] (+ x 1))`, testEnv(t))
+	got := Disassemble(l)
+	for _, want := range []string{"CLOSURE", "add1 [x] locals: ", "GET_GLOBAL", "; +", "TAIL_CALL", "RETURN"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("%q is missing from\n%s", want, got)
+		}
+	}
+}